@@ -3,6 +3,7 @@ package main
 import (
 	"butter-time/internal/handler"
 	"butter-time/internal/hub"
+	"butter-time/internal/storage"
 	"fmt"
 	"log"
 	"net/http"
@@ -25,6 +26,46 @@ func main() {
 	http.HandleFunc("/human-agent", func(w http.ResponseWriter, r *http.Request) {
 		handler.HumanAgentHandler(h, w, r)
 	})
+	//customers whose proxies block websockets: sse or long-poll down, POST up
+	http.HandleFunc("/customer/session", func(w http.ResponseWriter, r *http.Request) {
+		handler.FallbackSessionHandler(h, w, r)
+	})
+	http.HandleFunc("/customer/events", handler.FallbackEventsHandler)
+	http.HandleFunc("/customer/poll", handler.FallbackPollHandler)
+	http.HandleFunc("/customer/send", handler.FallbackSendHandler)
+	//knowledge base upload (agent token)
+	http.HandleFunc("/ingest", handler.IngestHandler)
+
+	//cache hit/miss counters for the ai pipeline (X-Admin-Key)
+	http.HandleFunc("/stats/llm-cache", handler.CacheStatsHandler)
+	//chat attachments: upload (agent or ?as=customer token), signed downloads
+	http.HandleFunc("/uploads", handler.UploadHandler)
+	http.HandleFunc(storage.DownloadPath, handler.FileHandler)
+	//token usage / cost per company (X-Admin-Key)
+	http.HandleFunc("/admin/usage", handler.UsageHandler)
+	//edits and deletes of chat messages, for supervisors (X-Admin-Key)
+	http.HandleFunc("/admin/message-history", func(w http.ResponseWriter, r *http.Request) {
+		handler.MessageHistoryHandler(h, w, r)
+	})
+	//hub queues over http for dashboards (agent token or X-Admin-Key)
+	http.HandleFunc("/api/conversations/pending", func(w http.ResponseWriter, r *http.Request) {
+		handler.PendingConversationsHandler(h, w, r)
+	})
+	http.HandleFunc("/api/conversations/active", func(w http.ResponseWriter, r *http.Request) {
+		handler.ActiveConversationsHandler(h, w, r)
+	})
+	http.HandleFunc("/api/conversation", func(w http.ResponseWriter, r *http.Request) {
+		handler.ConversationHandler(h, w, r)
+	})
+	http.HandleFunc("/api/conversation/accept", func(w http.ResponseWriter, r *http.Request) {
+		handler.AcceptConversationHandler(h, w, r)
+	})
+	http.HandleFunc("/api/conversation/reassign", func(w http.ResponseWriter, r *http.Request) {
+		handler.ReassignConversationHandler(h, w, r)
+	})
+	http.HandleFunc("/api/conversation/close", func(w http.ResponseWriter, r *http.Request) {
+		handler.CloseConversationHandler(h, w, r)
+	})
 	//
 	// Start server
 	addr := "0.0.0.0:4646"
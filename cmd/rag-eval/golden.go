@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// goldenCase is one question with what a good answer is built from.
+type goldenCase struct {
+	CompanyID string `json:"company_id"`
+	Question  string `json:"question"`
+	// any chunk whose id, source url, file name or page title matches counts as a hit
+	ExpectedSources []string `json:"expected_sources"`
+	ExpectedSource  string   `json:"expected_source"` // single-source shorthand
+	ExpectedAnswer  string   `json:"expected_answer"`
+	// whether the relevance gate should pass; defaults to true when a source
+	// or answer is expected, false otherwise (out-of-scope questions)
+	ExpectRelevant *bool `json:"expect_relevant"`
+}
+
+func (c goldenCase) expectRelevant() bool {
+	if c.ExpectRelevant != nil {
+		return *c.ExpectRelevant
+	}
+	return len(c.ExpectedSources) > 0 || c.ExpectedAnswer != ""
+}
+
+// loadGolden reads a .json array or a .csv file with a header row:
+//
+//	company_id,question,expected_sources,expected_answer,expect_relevant
+//
+// Several sources in one csv cell are separated with "|".
+func loadGolden(path string) ([]goldenCase, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var cases []goldenCase
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		if err := json.NewDecoder(f).Decode(&cases); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	case ".csv":
+		cases, err = readGoldenCSV(f)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	default:
+		return nil, fmt.Errorf("%s: golden set must be .json or .csv", path)
+	}
+
+	for i := range cases {
+		c := &cases[i]
+		if c.ExpectedSource != "" {
+			c.ExpectedSources = append(c.ExpectedSources, c.ExpectedSource)
+		}
+		if c.CompanyID == "" || strings.TrimSpace(c.Question) == "" {
+			return nil, fmt.Errorf("%s: case %d needs company_id and question", path, i+1)
+		}
+	}
+	return cases, nil
+}
+
+func readGoldenCSV(r io.Reader) ([]goldenCase, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+
+	col := make(map[string]int)
+	for i, name := range rows[0] {
+		col[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	get := func(row []string, names ...string) string {
+		for _, name := range names {
+			if i, ok := col[name]; ok && i < len(row) {
+				return strings.TrimSpace(row[i])
+			}
+		}
+		return ""
+	}
+
+	cases := make([]goldenCase, 0, len(rows)-1)
+	for n, row := range rows[1:] {
+		c := goldenCase{
+			CompanyID:      get(row, "company_id"),
+			Question:       get(row, "question"),
+			ExpectedAnswer: get(row, "expected_answer"),
+		}
+		for _, s := range strings.Split(get(row, "expected_sources", "expected_source"), "|") {
+			if s = strings.TrimSpace(s); s != "" {
+				c.ExpectedSources = append(c.ExpectedSources, s)
+			}
+		}
+		if v := get(row, "expect_relevant"); v != "" {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return nil, fmt.Errorf("row %d: expect_relevant: %w", n+2, err)
+			}
+			c.ExpectRelevant = &b
+		}
+		cases = append(cases, c)
+	}
+	return cases, nil
+}
@@ -0,0 +1,248 @@
+// rag-eval scores retrieval (and optionally generation) against a golden set.
+//
+// Offline, as in CI — fake embeddings and an in-memory store loaded from a
+// corpus directory (one sub-directory of .md/.html/.txt files per company):
+//
+//	go run ./cmd/rag-eval -golden cmd/rag-eval/testdata/golden.json -corpus cmd/rag-eval/testdata/corpus -generate
+//
+// Against the real stack (OPENAI_API_KEY, QDRANT_URL):
+//
+//	go run ./cmd/rag-eval -golden golden.csv -provider openai -store qdrant -generate -judge
+package main
+
+import (
+	"butter-time/internal/ingest"
+	"butter-time/internal/llm"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+func main() {
+	goldenPath := flag.String("golden", "", "golden set (.json or .csv)")
+	corpusDir := flag.String("corpus", "", "corpus to ingest first: <dir>/<company_id>/*.{md,html,txt}")
+	providerName := flag.String("provider", "fake", "model provider: fake | openai")
+	storeName := flag.String("store", "memory", "vector store: memory | qdrant")
+	k := flag.Int("k", 5, "cutoff for recall@k")
+	generate := flag.Bool("generate", false, "also generate answers through RetrieveAndAnswer and grade them")
+	judge := flag.Bool("judge", false, "grade answers with a model too (needs a real provider)")
+	jsonOut := flag.String("json", "", "write the full report as json to this file")
+	verbose := flag.Bool("v", false, "print every case")
+	minRecall := flag.Float64("min-recall", 0, "exit 1 if recall@k is below this")
+	minMRR := flag.Float64("min-mrr", 0, "exit 1 if mrr is below this")
+	minGate := flag.Float64("min-gate", 0, "exit 1 if relevance-gate accuracy is below this")
+	timeout := flag.Duration("timeout", 10*time.Minute, "overall time limit")
+	flag.Parse()
+
+	if *goldenPath == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	switch *providerName {
+	case "fake":
+		llm.SetProvider(llm.NewFakeProvider())
+	case "openai":
+		llm.LLM_KEY = os.Getenv("OPENAI_API_KEY")
+		if llm.LLM_KEY == "" {
+			log.Fatal("OPENAI_API_KEY is required for -provider openai")
+		}
+	default:
+		log.Fatalf("unknown provider %q", *providerName)
+	}
+	switch *storeName {
+	case "memory":
+		llm.SetVectorStore(llm.NewMemoryStore())
+	case "qdrant":
+	default:
+		log.Fatalf("unknown store %q", *storeName)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	cases, err := loadGolden(*goldenPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *corpusDir != "" {
+		if err := ingestCorpus(ctx, *corpusDir); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	results := make([]caseResult, 0, len(cases))
+	for _, c := range cases {
+		res := runCase(ctx, c, *generate, *judge)
+		results = append(results, res)
+		if *verbose {
+			printCase(res)
+		}
+	}
+
+	rep := summarise(results, *k)
+	printReport(rep, *generate)
+
+	if *jsonOut != "" {
+		b, _ := json.MarshalIndent(rep, "", "  ")
+		if err := os.WriteFile(*jsonOut, b, 0o644); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	failed := false
+	for _, check := range []struct {
+		name      string
+		got, want float64
+	}{
+		{"recall@k", rep.RecallK, *minRecall},
+		{"mrr", rep.MRR, *minMRR},
+		{"gate accuracy", rep.GateAccuracy, *minGate},
+	} {
+		if check.got < check.want {
+			fmt.Printf("FAIL: %s %.3f < %.3f\n", check.name, check.got, check.want)
+			failed = true
+		}
+	}
+	if failed || rep.Errors > 0 {
+		os.Exit(1)
+	}
+}
+
+// ingestCorpus loads <dir>/<company_id>/* through the same pipeline as /ingest.
+func ingestCorpus(ctx context.Context, dir string) error {
+	companies, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, company := range companies {
+		if !company.IsDir() {
+			continue
+		}
+		files, err := os.ReadDir(filepath.Join(dir, company.Name()))
+		if err != nil {
+			return err
+		}
+		for _, file := range files {
+			if file.IsDir() {
+				continue
+			}
+			content, err := os.ReadFile(filepath.Join(dir, company.Name(), file.Name()))
+			if err != nil {
+				return err
+			}
+			format, err := ingest.DetectFormat("", file.Name(), "", string(content))
+			if err != nil {
+				return fmt.Errorf("%s/%s: %w", company.Name(), file.Name(), err)
+			}
+			_, err = ingest.Ingest(ctx, company.Name(), ingest.Document{
+				Content:  string(content),
+				Format:   format,
+				FileName: file.Name(),
+			})
+			if err != nil {
+				return fmt.Errorf("%s/%s: %w", company.Name(), file.Name(), err)
+			}
+		}
+	}
+	return nil
+}
+
+func runCase(ctx context.Context, c goldenCase, generate, judge bool) caseResult {
+	res := caseResult{
+		CompanyID:      c.CompanyID,
+		Question:       c.Question,
+		Expected:       c.ExpectedSources,
+		ExpectRelevant: c.expectRelevant(),
+	}
+
+	retrieval, err := llm.Retrieve(ctx, c.CompanyID, c.Question)
+	if err != nil && err != llm.ErrCollectionNotFound {
+		res.Error = err.Error()
+		return res
+	}
+	res.Relevant = retrieval.Relevant
+	res.Retrieved = []string{}
+	for _, chunk := range retrieval.Chunks {
+		res.Retrieved = append(res.Retrieved, chunkLabel(chunk))
+	}
+	if len(c.ExpectedSources) > 0 {
+		res.Rank = firstHit(retrieval.Chunks, c.ExpectedSources)
+	}
+
+	if !generate {
+		return res
+	}
+	answer, err := llm.RetrieveAndAnswerSync(ctx, c.CompanyID, c.Question)
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	res.Answer = answer.Answer
+	res.Intent = string(answer.Intent)
+	if answer.Relevant && len(answer.Chunks) > 0 {
+		g := groundedness(answer.Answer, answer.Chunks)
+		res.Grounded = &g
+	}
+	if c.ExpectedAnswer != "" {
+		f1 := tokenF1(answer.Answer, c.ExpectedAnswer)
+		res.F1 = &f1
+		if judge {
+			score, err := llm.GradeAnswer(ctx, c.Question, c.ExpectedAnswer, answer.Answer)
+			if err != nil {
+				log.Printf("judge failed for %q: %v", c.Question, err)
+			} else {
+				res.Judge = &score
+			}
+		}
+	}
+	return res
+}
+
+func chunkLabel(c llm.RetrievedChunk) string {
+	for _, s := range []string{c.SourceURL, c.FileName, c.PageTitle, c.ID} {
+		if s != "" {
+			return s
+		}
+	}
+	return "?"
+}
+
+func printCase(r caseResult) {
+	status := "ok"
+	switch {
+	case r.Error != "":
+		status = "ERROR " + r.Error
+	case len(r.Expected) > 0 && r.Rank == 0:
+		status = "miss"
+	case r.Relevant != r.ExpectRelevant:
+		status = "gate"
+	}
+	fmt.Printf("[%s] %s: %q rank=%d relevant=%v\n", status, r.CompanyID, r.Question, r.Rank, r.Relevant)
+	if r.Answer != "" {
+		fmt.Printf("    answer: %s\n", strings.TrimSpace(r.Answer))
+	}
+}
+
+func printReport(r report, generate bool) {
+	fmt.Printf("cases           %d (%d with expected sources, %d errors)\n", r.Cases, r.WithSource, r.Errors)
+	fmt.Printf("recall@1        %.3f\n", r.Recall1)
+	fmt.Printf("recall@3        %.3f\n", r.Recall3)
+	fmt.Printf("recall@%-8d %.3f\n", r.K, r.RecallK)
+	fmt.Printf("mrr             %.3f\n", r.MRR)
+	fmt.Printf("gate accuracy   %.3f (%d false pass, %d false block)\n", r.GateAccuracy, r.GateFalsePositives, r.GateFalseNegatives)
+	if generate {
+		fmt.Printf("answered        %d\n", r.Answered)
+		fmt.Printf("answer f1       %.3f\n", r.AnswerF1)
+		fmt.Printf("groundedness    %.3f\n", r.Groundedness)
+		if r.Judged > 0 {
+			fmt.Printf("judge score     %.3f (%d judged)\n", r.JudgeScore, r.Judged)
+		}
+	}
+}
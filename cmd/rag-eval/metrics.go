@@ -0,0 +1,195 @@
+package main
+
+import (
+	"butter-time/internal/llm"
+	"strings"
+	"unicode"
+)
+
+// caseResult is what one golden case scored.
+type caseResult struct {
+	CompanyID      string   `json:"company_id"`
+	Question       string   `json:"question"`
+	Expected       []string `json:"expected_sources,omitempty"`
+	Retrieved      []string `json:"retrieved"`
+	Rank           int      `json:"rank"` // first matching chunk, 1-based; 0 = not retrieved
+	Relevant       bool     `json:"relevant"`
+	ExpectRelevant bool     `json:"expect_relevant"`
+	Answer         string   `json:"answer,omitempty"`
+	Intent         string   `json:"intent,omitempty"`
+	F1             *float64 `json:"f1,omitempty"`
+	Grounded       *float64 `json:"grounded,omitempty"`
+	Judge          *float64 `json:"judge,omitempty"`
+	Error          string   `json:"error,omitempty"`
+}
+
+// report is the summary over all cases.
+type report struct {
+	Cases      int     `json:"cases"`
+	Errors     int     `json:"errors"`
+	K          int     `json:"k"`
+	WithSource int     `json:"with_source"` // cases that count for recall/mrr
+	Recall1    float64 `json:"recall_at_1"`
+	Recall3    float64 `json:"recall_at_3"`
+	RecallK    float64 `json:"recall_at_k"`
+	MRR        float64 `json:"mrr"`
+
+	GateAccuracy       float64 `json:"gate_accuracy"`
+	GateFalsePositives int     `json:"gate_false_positives"` // passed but shouldn't have
+	GateFalseNegatives int     `json:"gate_false_negatives"` // blocked but shouldn't have
+
+	Answered     int     `json:"answered"`
+	AnswerF1     float64 `json:"answer_f1"`
+	Groundedness float64 `json:"groundedness"`
+	JudgeScore   float64 `json:"judge_score"`
+	Judged       int     `json:"judged"`
+
+	Results []caseResult `json:"results"`
+}
+
+// sourceMatches reports whether chunk c is one of the expected sources.
+func sourceMatches(c llm.RetrievedChunk, expected []string) bool {
+	for _, want := range expected {
+		for _, have := range []string{c.ID, c.SourceURL, c.FileName, c.PageTitle} {
+			if have != "" && strings.EqualFold(strings.TrimSpace(have), want) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func firstHit(chunks []llm.RetrievedChunk, expected []string) int {
+	for i, c := range chunks {
+		if sourceMatches(c, expected) {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+func summarise(results []caseResult, k int) report {
+	r := report{Cases: len(results), K: k, Results: results}
+	var gated, gateOK int
+	var f1s, grounded, judged int
+	for _, res := range results {
+		if res.Error != "" {
+			r.Errors++
+			continue
+		}
+
+		gated++
+		switch {
+		case res.Relevant == res.ExpectRelevant:
+			gateOK++
+		case res.Relevant:
+			r.GateFalsePositives++
+		default:
+			r.GateFalseNegatives++
+		}
+
+		if len(res.Expected) > 0 {
+			r.WithSource++
+			if res.Rank > 0 {
+				r.MRR += 1 / float64(res.Rank)
+			}
+			if res.Rank == 1 {
+				r.Recall1++
+			}
+			if res.Rank > 0 && res.Rank <= 3 {
+				r.Recall3++
+			}
+			if res.Rank > 0 && res.Rank <= k {
+				r.RecallK++
+			}
+		}
+		if res.Answer != "" {
+			r.Answered++
+		}
+		if res.F1 != nil {
+			r.AnswerF1 += *res.F1
+			f1s++
+		}
+		if res.Grounded != nil {
+			r.Groundedness += *res.Grounded
+			grounded++
+		}
+		if res.Judge != nil {
+			r.JudgeScore += *res.Judge
+			judged++
+		}
+	}
+	if r.WithSource > 0 {
+		n := float64(r.WithSource)
+		r.Recall1, r.Recall3, r.RecallK, r.MRR = r.Recall1/n, r.Recall3/n, r.RecallK/n, r.MRR/n
+	}
+	if gated > 0 {
+		r.GateAccuracy = float64(gateOK) / float64(gated)
+	}
+	if f1s > 0 {
+		r.AnswerF1 /= float64(f1s)
+	}
+	if grounded > 0 {
+		r.Groundedness /= float64(grounded)
+	}
+	if judged > 0 {
+		r.JudgeScore /= float64(judged)
+	}
+	r.Judged = judged
+	return r
+}
+
+// ── Answer grading without a model ────────────────────────────────────────────
+
+func words(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && !unicode.Is(unicode.Mn, r) && !unicode.Is(unicode.Mc, r)
+	})
+}
+
+// tokenF1 is the SQuAD-style overlap between an answer and the reference.
+func tokenF1(answer, expected string) float64 {
+	got, want := words(answer), words(expected)
+	if len(got) == 0 || len(want) == 0 {
+		return 0
+	}
+	counts := make(map[string]int)
+	for _, w := range want {
+		counts[w]++
+	}
+	common := 0
+	for _, w := range got {
+		if counts[w] > 0 {
+			counts[w]--
+			common++
+		}
+	}
+	if common == 0 {
+		return 0
+	}
+	precision := float64(common) / float64(len(got))
+	recall := float64(common) / float64(len(want))
+	return 2 * precision * recall / (precision + recall)
+}
+
+// groundedness is the share of the answer's words found in the retrieved
+// chunks — a cheap hallucination signal.
+func groundedness(answer string, chunks []llm.RetrievedChunk) float64 {
+	got := words(answer)
+	if len(got) == 0 {
+		return 0
+	}
+	seen := make(map[string]bool)
+	for _, c := range chunks {
+		for _, w := range words(c.Text) {
+			seen[w] = true
+		}
+	}
+	hits := 0
+	for _, w := range got {
+		if seen[w] {
+			hits++
+		}
+	}
+	return float64(hits) / float64(len(got))
+}
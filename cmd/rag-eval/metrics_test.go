@@ -0,0 +1,121 @@
+package main
+
+import (
+	"butter-time/internal/llm"
+	"context"
+	"math"
+	"testing"
+)
+
+func TestTokenF1(t *testing.T) {
+	cases := []struct {
+		answer, expected string
+		want             float64
+	}{
+		{"Returns within 30 days.", "returns within 30 days", 1},
+		{"30 days", "returns within 30 days", 2 * 1 * 0.5 / 1.5},
+		{"we ship anywhere", "returns within 30 days", 0},
+		{"", "returns", 0},
+		{"ফেরত ৭ দিনের মধ্যে", "৭ দিনের মধ্যে ফেরত", 1},
+	}
+	for _, c := range cases {
+		if got := tokenF1(c.answer, c.expected); math.Abs(got-c.want) > 1e-9 {
+			t.Errorf("tokenF1(%q, %q) = %v, want %v", c.answer, c.expected, got, c.want)
+		}
+	}
+}
+
+func TestGroundedness(t *testing.T) {
+	chunks := []llm.RetrievedChunk{{Text: "Returns are accepted within 30 days."}, {Text: "Delivery is free."}}
+	if got := groundedness("Returns are free within 30 days", chunks); got != 1 {
+		t.Errorf("grounded answer scored %v", got)
+	}
+	if got := groundedness("Returns cost ten dollars", chunks); got != 0.25 {
+		t.Errorf("made-up answer scored %v, want 0.25", got)
+	}
+}
+
+func TestSummarise(t *testing.T) {
+	f1, half := 1.0, 0.5
+	results := []caseResult{
+		{Expected: []string{"a"}, Rank: 1, Relevant: true, ExpectRelevant: true, Answer: "x", F1: &f1},
+		{Expected: []string{"a"}, Rank: 3, Relevant: true, ExpectRelevant: true, Answer: "x", F1: &half},
+		{Expected: []string{"a"}, Rank: 0, Relevant: false, ExpectRelevant: true},
+		{Relevant: true, ExpectRelevant: false},
+		{Error: "boom"},
+	}
+	r := summarise(results, 2)
+	want := report{
+		Cases: 5, Errors: 1, K: 2, WithSource: 3,
+		Recall1: 1.0 / 3, Recall3: 2.0 / 3, RecallK: 1.0 / 3, MRR: (1 + 1.0/3) / 3,
+		GateAccuracy: 0.5, GateFalsePositives: 1, GateFalseNegatives: 1,
+		Answered: 2, AnswerF1: 0.75,
+	}
+	for _, m := range []struct {
+		name      string
+		got, want float64
+	}{
+		{"cases", float64(r.Cases), float64(want.Cases)},
+		{"errors", float64(r.Errors), float64(want.Errors)},
+		{"with source", float64(r.WithSource), float64(want.WithSource)},
+		{"recall@1", r.Recall1, want.Recall1},
+		{"recall@3", r.Recall3, want.Recall3},
+		{"recall@k", r.RecallK, want.RecallK},
+		{"mrr", r.MRR, want.MRR},
+		{"gate accuracy", r.GateAccuracy, want.GateAccuracy},
+		{"false pass", float64(r.GateFalsePositives), float64(want.GateFalsePositives)},
+		{"false block", float64(r.GateFalseNegatives), float64(want.GateFalseNegatives)},
+		{"answered", float64(r.Answered), float64(want.Answered)},
+		{"answer f1", r.AnswerF1, want.AnswerF1},
+	} {
+		if math.Abs(m.got-m.want) > 1e-9 {
+			t.Errorf("%s = %v, want %v", m.name, m.got, m.want)
+		}
+	}
+}
+
+// TestGoldenSet is the CI run: the checked-in corpus and golden set through
+// the offline provider, with the floors the pipeline currently clears.
+func TestGoldenSet(t *testing.T) {
+	llm.SetProvider(llm.NewFakeProvider())
+	llm.SetVectorStore(llm.NewMemoryStore())
+	ctx := context.Background()
+
+	cases, err := loadGolden("testdata/golden.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ingestCorpus(ctx, "testdata/corpus"); err != nil {
+		t.Fatal(err)
+	}
+	results := make([]caseResult, 0, len(cases))
+	for _, c := range cases {
+		results = append(results, runCase(ctx, c, true, false))
+	}
+	r := summarise(results, 5)
+
+	if r.Errors > 0 {
+		for _, res := range results {
+			if res.Error != "" {
+				t.Errorf("%s: %q: %s", res.CompanyID, res.Question, res.Error)
+			}
+		}
+	}
+	for _, floor := range []struct {
+		name      string
+		got, want float64
+	}{
+		{"recall@5", r.RecallK, 0.9},
+		{"mrr", r.MRR, 0.9},
+		{"gate accuracy", r.GateAccuracy, 0.8},
+		{"answer f1", r.AnswerF1, 0.4},
+		{"groundedness", r.Groundedness, 0.95},
+	} {
+		if floor.got < floor.want {
+			t.Errorf("%s %.3f below %.3f", floor.name, floor.got, floor.want)
+		}
+	}
+	if r.Answered != r.Cases {
+		t.Errorf("answered %d of %d cases", r.Answered, r.Cases)
+	}
+}
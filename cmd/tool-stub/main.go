@@ -0,0 +1,153 @@
+// tool-stub is a local stand-in for a company's own systems, to try AI tools
+// without a real backend. Register it in the company's AI config:
+//
+//	"tools": [
+//	  {
+//	    "name": "order_status",
+//	    "description": "Look up the status of a customer's order by order number.",
+//	    "url": "http://localhost:4700/orders/status",
+//	    "headers": {"Authorization": "Bearer dev-token"},
+//	    "parameters": {
+//	      "type": "object",
+//	      "properties": {"order_id": {"type": "string", "pattern": "^[0-9]{4,8}$"}},
+//	      "required": ["order_id"],
+//	      "additionalProperties": false
+//	    }
+//	  },
+//	  {
+//	    "name": "booking_lookup",
+//	    "description": "Find a table booking by the phone number it was made with.",
+//	    "url": "http://localhost:4700/bookings/lookup",
+//	    "parameters": {
+//	      "type": "object",
+//	      "properties": {"phone": {"type": "string", "minLength": 6}},
+//	      "required": ["phone"]
+//	    }
+//	  }
+//	]
+//
+// then run it, and start the server with TOOL_ALLOW_PRIVATE=true — tool
+// webhooks must otherwise be public https addresses, and these plain http
+// localhost ones would be dropped from the config:
+//
+//	go run ./cmd/tool-stub -token dev-token
+//	TOOL_ALLOW_PRIVATE=true go run ./cmd
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// what the server POSTs for every tool call
+type toolRequest struct {
+	Tool           string         `json:"tool"`
+	CompanyID      string         `json:"company_id"`
+	ConversationID string         `json:"conversation_id"`
+	Arguments      map[string]any `json:"arguments"`
+}
+
+type order struct {
+	ID        string `json:"order_id"`
+	Status    string `json:"status"`
+	Items     string `json:"items"`
+	ETA       string `json:"estimated_delivery,omitempty"`
+	Courier   string `json:"courier,omitempty"`
+	UpdatedAt string `json:"updated_at"`
+}
+
+type booking struct {
+	Name   string `json:"name"`
+	Phone  string `json:"phone"`
+	Date   string `json:"date"`
+	Time   string `json:"time"`
+	Guests int    `json:"guests"`
+	Status string `json:"status"`
+}
+
+var orders = map[string]order{
+	"1001": {ID: "1001", Status: "delivered", Items: "2x cotton t-shirt", UpdatedAt: "2026-10-12"},
+	"1002": {ID: "1002", Status: "shipped", Items: "running shoes", ETA: "2026-10-21", Courier: "Pathao", UpdatedAt: "2026-10-18"},
+	"1003": {ID: "1003", Status: "processing", Items: "winter jacket", ETA: "2026-10-24", UpdatedAt: "2026-10-19"},
+	"1004": {ID: "1004", Status: "cancelled", Items: "backpack", UpdatedAt: "2026-10-15"},
+}
+
+var bookings = []booking{
+	{Name: "Rahim", Phone: "01711000001", Date: "2026-10-20", Time: "20:00", Guests: 4, Status: "confirmed"},
+	{Name: "Nadia", Phone: "01811000002", Date: "2026-10-22", Time: "13:30", Guests: 2, Status: "pending"},
+}
+
+func main() {
+	addr := flag.String("addr", ":4700", "listen address")
+	token := flag.String("token", "", "require this bearer token (empty = no auth)")
+	delay := flag.Duration("delay", 0, "wait this long before answering, to try timeouts")
+	flag.Parse()
+
+	handle := func(path string, fn func(toolRequest) (int, any)) {
+		http.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost {
+				writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "POST only"})
+				return
+			}
+			if *token != "" && r.Header.Get("Authorization") != "Bearer "+*token {
+				writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+				return
+			}
+			var req toolRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid json"})
+				return
+			}
+			log.Printf("%s company=%s conversation=%s args=%v", req.Tool, req.CompanyID, req.ConversationID, req.Arguments)
+			if *delay > 0 {
+				time.Sleep(*delay)
+			}
+			status, body := fn(req)
+			writeJSON(w, status, body)
+		})
+	}
+
+	handle("/orders/status", func(req toolRequest) (int, any) {
+		id, _ := req.Arguments["order_id"].(string)
+		o, ok := orders[strings.TrimPrefix(strings.TrimSpace(id), "#")]
+		if !ok {
+			return http.StatusOK, map[string]any{"found": false, "message": "no order with that number"}
+		}
+		return http.StatusOK, map[string]any{"found": true, "order": o}
+	})
+
+	handle("/bookings/lookup", func(req toolRequest) (int, any) {
+		phone, _ := req.Arguments["phone"].(string)
+		phone = digitsOnly(phone)
+		matches := []booking{}
+		for _, b := range bookings {
+			if phone != "" && strings.HasSuffix(phone, digitsOnly(b.Phone)[1:]) {
+				matches = append(matches, b)
+			}
+		}
+		return http.StatusOK, map[string]any{"bookings": matches}
+	})
+
+	log.Printf("tool stub listening on %s", *addr)
+	log.Fatal(http.ListenAndServe(*addr, nil))
+}
+
+func digitsOnly(s string) string {
+	var sb strings.Builder
+	for _, r := range s {
+		if r >= '0' && r <= '9' {
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String()
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,86 @@
+package codec
+
+import (
+	"encoding/json"
+	"slices"
+
+	"github.com/gorilla/websocket"
+)
+
+// ── Wire formats ──────────────────────────────────────────────────────────────
+//
+// A websocket client picks its format with a subprotocol:
+//
+//	new WebSocket(url, ["butter.msgpack.v1", "butter.json.v1"])
+//
+// The first one offered that we know wins. No subprotocol (old clients)
+// means JSON. Every event looks the same in both formats: msgpack frames are
+// the JSON document (same keys, same omitted fields) in msgpack form.
+
+const (
+	JSONProtocol    = "butter.json.v1"
+	MsgPackProtocol = "butter.msgpack.v1"
+)
+
+// Codec encodes and decodes whole websocket events.
+type Codec interface {
+	// Name is the subprotocol the codec is negotiated by.
+	Name() string
+	// FrameType is websocket.TextMessage or websocket.BinaryMessage.
+	FrameType() int
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+	// Array joins already encoded values into one encoded array.
+	Array(items [][]byte) []byte
+}
+
+var (
+	JSON    Codec = jsonCodec{}
+	MsgPack Codec = msgpackCodec{}
+)
+
+// supported in order of preference when a client doesn't care
+var codecs = []Codec{JSON, MsgPack}
+
+// Subprotocols lists every subprotocol we can speak.
+func Subprotocols() []string {
+	names := make([]string, 0, len(codecs))
+	for _, c := range codecs {
+		names = append(names, c.Name())
+	}
+	return names
+}
+
+// Negotiate picks the codec for the subprotocols a client offered, in the
+// client's order. ok is false when it offered some but none we speak.
+func Negotiate(offered []string) (c Codec, ok bool) {
+	if len(offered) == 0 {
+		return JSON, true
+	}
+	for _, name := range offered {
+		if i := slices.IndexFunc(codecs, func(c Codec) bool { return c.Name() == name }); i >= 0 {
+			return codecs[i], true
+		}
+	}
+	return JSON, false
+}
+
+// ── JSON ──────────────────────────────────────────────────────────────────────
+
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string                       { return JSONProtocol }
+func (jsonCodec) FrameType() int                     { return websocket.TextMessage }
+func (jsonCodec) Marshal(v any) ([]byte, error)      { return json.Marshal(v) }
+func (jsonCodec) Unmarshal(data []byte, v any) error { return json.Unmarshal(data, v) }
+
+func (jsonCodec) Array(items [][]byte) []byte {
+	out := []byte{'['}
+	for i, item := range items {
+		if i > 0 {
+			out = append(out, ',')
+		}
+		out = append(out, item...)
+	}
+	return append(out, ']')
+}
@@ -0,0 +1,39 @@
+package codec
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ── Framing ───────────────────────────────────────────────────────────────────
+//
+// How events are put into websocket frames, picked per connection with
+// ?framing=:
+//
+//	single  one event per frame (default)
+//	array   several events per frame as one array: [event, event]
+//	ndjson  several events per frame, one per line (json only)
+//
+// Batched frames never split an event; see writePump for the limits.
+
+const (
+	FrameSingle = "single"
+	FrameArray  = "array"
+	FrameLines  = "ndjson"
+)
+
+// ParseFraming checks a requested framing mode against the wire format.
+func ParseFraming(mode string, c Codec) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(mode)) {
+	case "", FrameSingle:
+		return FrameSingle, nil
+	case FrameArray:
+		return FrameArray, nil
+	case FrameLines:
+		if c.Name() != JSONProtocol {
+			return "", fmt.Errorf("framing %s needs %s", FrameLines, JSONProtocol)
+		}
+		return FrameLines, nil
+	}
+	return "", fmt.Errorf("framing must be %s, %s or %s", FrameSingle, FrameArray, FrameLines)
+}
@@ -0,0 +1,341 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/gorilla/websocket"
+)
+
+// ── MessagePack ───────────────────────────────────────────────────────────────
+//
+// Values go through their JSON form on the way in and out, so json tags,
+// omitempty and custom marshalers apply exactly as they do for JSON clients.
+// Only the subset JSON can express is produced: nil, bool, int, float64,
+// str, array and map with string keys. Decoding also takes bin (as base64,
+// like []byte in JSON) and non-string map keys.
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) Name() string   { return MsgPackProtocol }
+func (msgpackCodec) FrameType() int { return websocket.BinaryMessage }
+
+func (msgpackCodec) Marshal(v any) ([]byte, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var doc any
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := writeValue(&buf, doc); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (msgpackCodec) Unmarshal(data []byte, v any) error {
+	r := &reader{data: data}
+	doc, err := r.value(0)
+	if err != nil {
+		return err
+	}
+	if r.pos != len(data) {
+		return errors.New("msgpack: trailing bytes after value")
+	}
+	raw, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, v)
+}
+
+func (msgpackCodec) Array(items [][]byte) []byte {
+	var buf bytes.Buffer
+	writeHeader(&buf, len(items), 0x90, 15, 0xdc, 0xdd)
+	for _, item := range items {
+		buf.Write(item)
+	}
+	return buf.Bytes()
+}
+
+func writeValue(buf *bytes.Buffer, v any) error {
+	switch v := v.(type) {
+	case nil:
+		buf.WriteByte(0xc0)
+	case bool:
+		if v {
+			buf.WriteByte(0xc3)
+		} else {
+			buf.WriteByte(0xc2)
+		}
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			writeInt(buf, i)
+			return nil
+		}
+		f, err := v.Float64()
+		if err != nil {
+			return fmt.Errorf("msgpack: number %s: %w", v, err)
+		}
+		buf.WriteByte(0xcb)
+		binary.Write(buf, binary.BigEndian, math.Float64bits(f))
+	case string:
+		writeString(buf, v)
+	case []any:
+		writeHeader(buf, len(v), 0x90, 15, 0xdc, 0xdd)
+		for _, item := range v {
+			if err := writeValue(buf, item); err != nil {
+				return err
+			}
+		}
+	case map[string]any:
+		writeHeader(buf, len(v), 0x80, 15, 0xde, 0xdf)
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			writeString(buf, k)
+			if err := writeValue(buf, v[k]); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("msgpack: unexpected %T", v)
+	}
+	return nil
+}
+
+func writeInt(buf *bytes.Buffer, i int64) {
+	switch {
+	case i >= 0 && i <= 127:
+		buf.WriteByte(byte(i))
+	case i < 0 && i >= -32:
+		buf.WriteByte(byte(int8(i)))
+	case i >= math.MinInt8 && i <= math.MaxInt8:
+		buf.WriteByte(0xd0)
+		buf.WriteByte(byte(int8(i)))
+	case i >= math.MinInt16 && i <= math.MaxInt16:
+		buf.WriteByte(0xd1)
+		binary.Write(buf, binary.BigEndian, int16(i))
+	case i >= math.MinInt32 && i <= math.MaxInt32:
+		buf.WriteByte(0xd2)
+		binary.Write(buf, binary.BigEndian, int32(i))
+	default:
+		buf.WriteByte(0xd3)
+		binary.Write(buf, binary.BigEndian, i)
+	}
+}
+
+func writeString(buf *bytes.Buffer, s string) {
+	n := len(s)
+	switch {
+	case n <= 31:
+		buf.WriteByte(0xa0 | byte(n))
+	case n <= math.MaxUint8:
+		buf.WriteByte(0xd9)
+		buf.WriteByte(byte(n))
+	case n <= math.MaxUint16:
+		buf.WriteByte(0xda)
+		binary.Write(buf, binary.BigEndian, uint16(n))
+	default:
+		buf.WriteByte(0xdb)
+		binary.Write(buf, binary.BigEndian, uint32(n))
+	}
+	buf.WriteString(s)
+}
+
+// writeHeader writes an array or map header: fix form up to fixMax,
+// then the 16 and 32 bit forms.
+func writeHeader(buf *bytes.Buffer, n int, fix byte, fixMax int, code16, code32 byte) {
+	switch {
+	case n <= fixMax:
+		buf.WriteByte(fix | byte(n))
+	case n <= math.MaxUint16:
+		buf.WriteByte(code16)
+		binary.Write(buf, binary.BigEndian, uint16(n))
+	default:
+		buf.WriteByte(code32)
+		binary.Write(buf, binary.BigEndian, uint32(n))
+	}
+}
+
+// ── decoding ──
+
+// deeper than any event we send; stops stack exhaustion on hostile input
+const maxDepth = 64
+
+var errShort = errors.New("msgpack: unexpected end of data")
+
+type reader struct {
+	data []byte
+	pos  int
+}
+
+func (r *reader) next(n int) ([]byte, error) {
+	if n < 0 || len(r.data)-r.pos < n {
+		return nil, errShort
+	}
+	b := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return b, nil
+}
+
+func (r *reader) uint(size int) (uint64, error) {
+	b, err := r.next(size)
+	if err != nil {
+		return 0, err
+	}
+	var u uint64
+	for _, c := range b {
+		u = u<<8 | uint64(c)
+	}
+	return u, nil
+}
+
+func (r *reader) value(depth int) (any, error) {
+	if depth > maxDepth {
+		return nil, errors.New("msgpack: nested too deep")
+	}
+	b, err := r.next(1)
+	if err != nil {
+		return nil, err
+	}
+	c := b[0]
+	switch {
+	case c <= 0x7f:
+		return int64(c), nil
+	case c >= 0xe0:
+		return int64(int8(c)), nil
+	case c&0xe0 == 0xa0:
+		return r.str(int(c & 0x1f))
+	case c&0xf0 == 0x90:
+		return r.array(int(c&0x0f), depth)
+	case c&0xf0 == 0x80:
+		return r.mapOf(int(c&0x0f), depth)
+	}
+
+	switch c {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		u, err := r.uint(1 << (c - 0xcc))
+		if err != nil {
+			return nil, err
+		}
+		return u, nil
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		size := 1 << (c - 0xd0)
+		u, err := r.uint(size)
+		if err != nil {
+			return nil, err
+		}
+		// sign-extend from size bytes
+		shift := 64 - 8*size
+		return int64(u<<shift) >> shift, nil
+	case 0xca:
+		u, err := r.uint(4)
+		if err != nil {
+			return nil, err
+		}
+		return float64(math.Float32frombits(uint32(u))), nil
+	case 0xcb:
+		u, err := r.uint(8)
+		if err != nil {
+			return nil, err
+		}
+		return math.Float64frombits(u), nil
+	case 0xd9, 0xda, 0xdb:
+		n, err := r.uint(1 << (c - 0xd9))
+		if err != nil {
+			return nil, err
+		}
+		return r.str(int(n))
+	case 0xc4, 0xc5, 0xc6:
+		n, err := r.uint(1 << (c - 0xc4))
+		if err != nil {
+			return nil, err
+		}
+		bin, err := r.next(int(n))
+		if err != nil {
+			return nil, err
+		}
+		return base64.StdEncoding.EncodeToString(bin), nil
+	case 0xdc, 0xdd:
+		n, err := r.uint(2 << (c - 0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return r.array(int(n), depth)
+	case 0xde, 0xdf:
+		n, err := r.uint(2 << (c - 0xde))
+		if err != nil {
+			return nil, err
+		}
+		return r.mapOf(int(n), depth)
+	}
+	return nil, fmt.Errorf("msgpack: unsupported type 0x%02x", c)
+}
+
+func (r *reader) str(n int) (any, error) {
+	b, err := r.next(n)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+func (r *reader) array(n, depth int) (any, error) {
+	// every element is at least one byte
+	if n > len(r.data)-r.pos {
+		return nil, errShort
+	}
+	items := make([]any, 0, n)
+	for i := 0; i < n; i++ {
+		v, err := r.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, v)
+	}
+	return items, nil
+}
+
+func (r *reader) mapOf(n, depth int) (any, error) {
+	if 2*n > len(r.data)-r.pos {
+		return nil, errShort
+	}
+	m := make(map[string]any, n)
+	for i := 0; i < n; i++ {
+		k, err := r.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		v, err := r.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		key, ok := k.(string)
+		if !ok {
+			key = fmt.Sprint(k)
+		}
+		m[key] = v
+	}
+	return m, nil
+}
@@ -0,0 +1,181 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMsgPackSizeClasses(t *testing.T) {
+	keys := func(n int) map[string]any {
+		m := make(map[string]any, n)
+		for i := 0; i < n; i++ {
+			m[fmt.Sprintf("k%02d", i)] = i
+		}
+		return m
+	}
+	items := func(n int) []any {
+		a := make([]any, n)
+		for i := range a {
+			a[i] = "x"
+		}
+		return a
+	}
+
+	cases := []struct {
+		name   string
+		value  any
+		header []byte // how the encoding must start
+	}{
+		{"nil", nil, []byte{0xc0}},
+		{"true", true, []byte{0xc3}},
+		{"false", false, []byte{0xc2}},
+		{"positive fixint", 5, []byte{0x05}},
+		{"negative fixint", -3, []byte{0xfd}},
+		{"int8", -100, []byte{0xd0, 0x9c}},
+		{"int16", 1000, []byte{0xd1, 0x03, 0xe8}},
+		{"int32", 100000, []byte{0xd2, 0x00, 0x01, 0x86, 0xa0}},
+		{"int64", int64(1) << 40, []byte{0xd3, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00}},
+		{"float64", 1.5, []byte{0xcb, 0x3f, 0xf8}},
+		{"fixstr", "hello", []byte{0xa5, 'h'}},
+		{"str8", strings.Repeat("a", 40), []byte{0xd9, 40}},
+		{"str16", strings.Repeat("a", 300), []byte{0xda, 0x01, 0x2c}},
+		{"str32", strings.Repeat("a", 70000), []byte{0xdb, 0x00, 0x01, 0x11, 0x70}},
+		{"fixarray", items(3), []byte{0x93}},
+		{"array16", items(20), []byte{0xdc, 0x00, 0x14}},
+		{"fixmap", keys(2), []byte{0x82}},
+		{"map16", keys(20), []byte{0xde, 0x00, 0x14}},
+		{"nested", map[string]any{"type": "message", "payload": map[string]any{"id": 7, "tags": []any{"a", nil}}}, []byte{0x82}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			data, err := MsgPack.Marshal(c.value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.HasPrefix(data, c.header) {
+				t.Fatalf("encoding starts % x, want % x", data[:min(len(data), len(c.header))], c.header)
+			}
+
+			var got any
+			if err := MsgPack.Unmarshal(data, &got); err != nil {
+				t.Fatal(err)
+			}
+			if want := viaJSON(t, c.value); !reflect.DeepEqual(got, want) {
+				t.Errorf("round trip = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+// viaJSON is what a JSON client would decode the value to.
+func viaJSON(t *testing.T, v any) any {
+	t.Helper()
+	raw, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out any
+	if err := json.Unmarshal(raw, &out); err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestMsgPackDecodeOnlyForms(t *testing.T) {
+	cases := []struct {
+		name string
+		data []byte
+		want any
+	}{
+		{"uint8", []byte{0xcc, 0xff}, float64(255)},
+		{"uint16", []byte{0xcd, 0x01, 0x00}, float64(256)},
+		{"uint32", []byte{0xce, 0x00, 0x01, 0x00, 0x00}, float64(65536)},
+		{"float32", []byte{0xca, 0x3f, 0xc0, 0x00, 0x00}, 1.5},
+		{"bin8 as base64", []byte{0xc4, 0x03, 'a', 'b', 'c'}, "YWJj"},
+		{"int key", []byte{0x81, 0x01, 0xa1, 'x'}, map[string]any{"1": "x"}},
+		{"array32", []byte{0xdd, 0x00, 0x00, 0x00, 0x01, 0xc3}, []any{true}},
+		{"map32", []byte{0xdf, 0x00, 0x00, 0x00, 0x01, 0xa1, 'k', 0x02}, map[string]any{"k": float64(2)}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var got any
+			if err := MsgPack.Unmarshal(c.data, &got); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("got %#v, want %#v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestMsgPackRejectsBadInput(t *testing.T) {
+	deep := append(bytes.Repeat([]byte{0x91}, maxDepth+2), 0xc0)
+	cases := map[string][]byte{
+		"empty":          {},
+		"short str8":     {0xd9, 0x05, 'a'},
+		"short array16":  {0xdc, 0x00, 0x05, 0xc0},
+		"trailing bytes": {0xc0, 0xc0},
+		"unsupported":    {0xc1},
+		"too deep":       deep,
+		"huge map count": {0xdf, 0xff, 0xff, 0xff, 0xff},
+	}
+	for name, data := range cases {
+		var v any
+		if err := MsgPack.Unmarshal(data, &v); err == nil {
+			t.Errorf("%s: decoded %v, want an error", name, v)
+		}
+	}
+}
+
+func TestArrayJoinsEncodedEvents(t *testing.T) {
+	events := []any{
+		map[string]any{"type": "a"},
+		map[string]any{"type": "b", "payload": 1},
+	}
+	for _, c := range []Codec{JSON, MsgPack} {
+		t.Run(c.Name(), func(t *testing.T) {
+			items := make([][]byte, len(events))
+			for i, e := range events {
+				data, err := c.Marshal(e)
+				if err != nil {
+					t.Fatal(err)
+				}
+				items[i] = data
+			}
+			var got any
+			if err := c.Unmarshal(c.Array(items), &got); err != nil {
+				t.Fatal(err)
+			}
+			if want := viaJSON(t, events); !reflect.DeepEqual(got, want) {
+				t.Errorf("array = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestParseFraming(t *testing.T) {
+	cases := []struct {
+		mode    string
+		codec   Codec
+		want    string
+		wantErr bool
+	}{
+		{"", JSON, FrameSingle, false},
+		{"single", MsgPack, FrameSingle, false},
+		{"ARRAY", MsgPack, FrameArray, false},
+		{"ndjson", JSON, FrameLines, false},
+		{"ndjson", MsgPack, "", true},
+		{"lines", JSON, "", true},
+	}
+	for _, c := range cases {
+		got, err := ParseFraming(c.mode, c.codec)
+		if (err != nil) != c.wantErr || got != c.want {
+			t.Errorf("ParseFraming(%q, %s) = %q, %v", c.mode, c.codec.Name(), got, err)
+		}
+	}
+}
@@ -2,23 +2,13 @@ package constructor
 
 import (
 	"butter-time/internal/model"
-	"encoding/json"
 	"errors"
 	"time"
 
 	"github.com/google/uuid"
 )
 
-func ConversationPayloadConstructor(payload any, transfer bool) (model.ConversationPayload, error) {
-	var conversation model.ConversationPayload
-	conversationByte, err := json.Marshal(payload)
-	if err != nil {
-		return model.ConversationPayload{}, err
-	}
-	err = json.Unmarshal(conversationByte, &conversation)
-	if err != nil {
-		return model.ConversationPayload{}, err
-	}
+func ConversationPayloadConstructor(conversation model.ConversationPayload, transfer bool) (model.ConversationPayload, error) {
 	//checkpost of conversation payload// (todo)
 	//---logics for the conversation payload is authentic---//
 	//required: companyid, customer id and info,last (1-n [1<n<50] customer message)
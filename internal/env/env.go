@@ -0,0 +1,40 @@
+// Package env reads the server's settings from the environment. Unset or
+// malformed values give the fallback.
+package env
+
+import (
+	"os"
+	"strconv"
+	"time"
+)
+
+func String(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+// Int reads a count or size; zero and negative values give fallback too.
+func Int(key string, fallback int) int {
+	if n, err := strconv.Atoi(os.Getenv(key)); err == nil && n > 0 {
+		return n
+	}
+	return fallback
+}
+
+// Duration reads a duration such as "90s" or "15m". Zero is kept, negative
+// values give fallback.
+func Duration(key string, fallback time.Duration) time.Duration {
+	if d, err := time.ParseDuration(os.Getenv(key)); err == nil && d >= 0 {
+		return d
+	}
+	return fallback
+}
+
+func Bool(key string, fallback bool) bool {
+	if b, err := strconv.ParseBool(os.Getenv(key)); err == nil {
+		return b
+	}
+	return fallback
+}
@@ -5,17 +5,13 @@ import (
 	"butter-time/internal/llm"
 	"butter-time/internal/model"
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 )
 
-func handleAiStream(client *hub.Client, payload any) {
-
-	payloadBytes, _ := json.Marshal(payload)
-	var msgIn model.MsgInOut
-	json.Unmarshal(payloadBytes, &msgIn)
-
+// trigger name: butter_chat (agents only)
+func handleAiStream(client *hub.Client, msgIn model.MsgInOut) error {
 	//Cancel previous AI if still running
 	if client.CancelAI != nil {
 		client.CancelAI()
@@ -24,30 +20,71 @@ func handleAiStream(client *hub.Client, payload any) {
 	//Create cancellable context
 	ctx, cancel := context.WithCancel(context.Background())
 	client.CancelAI = cancel
+	ctx = llm.WithConversation(ctx, msgIn.ConversationId)
 
-	//Tell frontend: AI started typing
-	sendMessage(client, "butter_typing_start", nil)
+	//Tell frontend: AI started typing (refreshed by every token)
+	aiTyping(client, true)
 	var fullReply string
 	//Start streaming AI
-	_, err := llm.RetrieveAndAnswer(ctx, client.HumanAgentPass.CompanyId, msgIn.Content, func(token string) {
+	result, err := llm.RetrieveAndAnswer(ctx, client.HumanAgentPass.CompanyId, msgIn.Content, func(token string) {
 		fullReply += token
+		aiTyping(client, true)
 		//Send token immediately
 		sendMessage(client, "butter_stream", model.MsgInOut{
-			SenderType:  "AI-AGENT",
+			SenderType:  hub.SenderAI,
 			Content:     token,
 			ContentType: "text",
 			CreatedAt:   time.Now().Format(time.RFC3339),
 		})
 	})
 
+	if errors.Is(err, llm.ErrQuotaExceeded) {
+		//out of quota -> polite fixed reply instead of an error
+		reply := llm.QuotaExceededMessage(client.HumanAgentPass.CompanyId)
+		sendMessage(client, "butter_stream", model.MsgInOut{
+			SenderType:  hub.SenderAI,
+			Content:     reply,
+			ContentType: "text",
+			CreatedAt:   time.Now().Format(time.RFC3339),
+		})
+		sendMessage(client, "butter_stream_full_reply", reply)
+		aiTyping(client, false)
+		return nil
+	}
 	if err != nil {
-		sendError(client, "AI error")
-		sendMessage(client, "message", "ai is unavailable to response")
+		aiTyping(client, false)
 		fmt.Println(err.Error())
-		return
+		return fail(codeAIUnavailable)
 	}
 	//Tell frontend: AI finished
 	sendMessage(client, "butter_stream_full_reply", fullReply)
-	sendMessage(client, "butter_typing_end", nil)
+	//sources behind the answer -> "Sources" chips in the frontend
+	sendMessage(client, "butter_sources", model.SourcesPayload{
+		AnswerId: result.AnswerID,
+		Sources:  llm.Citations(result),
+	})
+	//chips the ai offered under its answer ("Talk to a human"...); kept in
+	//the transcript so their postbacks can be checked like an agent's
+	if len(result.QuickReplies) > 0 && msgIn.ConversationId != "" {
+		reply := model.MsgInOut{
+			ConversationId: msgIn.ConversationId,
+			SenderId:       client.HumanAgentPass.Id,
+			ReceiverId:     msgIn.ReceiverId,
+			SenderType:     hub.SenderAI,
+			Content:        fullReply,
+			ContentType:    "text",
+			QuickReplies:   result.QuickReplies,
+			CreatedAt:      time.Now().Format(time.RFC3339),
+		}
+		// receipts go to the agent the assistant wrote for
+		reply.Id, reply.Status = client.Hub.NewMessage(reply.ConversationId, hub.RoleHumanAgent, reply.SenderId, reply.ReceiverId)
+		client.Hub.AddMessageToHumanAgentQueue(client.HumanAgentPass.Id, &model.WSMessage{
+			Type:    "message",
+			Payload: reply,
+		})
+		sendMessage(client, "butter_quick_replies", reply)
+	}
+	aiTyping(client, false)
 	//Save fullReply to DB ---later....---///
+	return nil
 }
@@ -0,0 +1,160 @@
+package handler
+
+import (
+	"butter-time/internal/model"
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// authError carries how a failed authentication is reported on each
+// transport: a websocket close code or an http status.
+type authError struct {
+	closeCode  int
+	httpStatus int
+	msg        string
+}
+
+func (e *authError) Error() string { return e.msg }
+
+var authHTTPClient = &http.Client{
+	Timeout: 5 * time.Second,
+}
+
+// authenticateHumanAgent resolves an agent token through the auth service.
+func authenticateHumanAgent(userToken string) (model.User, *authError) {
+	if userToken == "" {
+		log.Println("Missing token parameter")
+		return model.User{}, &authError{websocket.ClosePolicyViolation, http.StatusUnauthorized, "missing token"}
+	}
+	log.Printf("Employee connection attempt with token: %s...", userToken[:min(10, len(userToken))])
+
+	// request to auth service
+	req, err := http.NewRequest(
+		http.MethodGet,
+		"https://api.studiobutterfly.io/users/socket/essential",
+		// "http://localhost:5599/users/socket/essential",
+		bytes.NewBuffer([]byte(`{}`)),
+	)
+	if err != nil {
+		log.Println("Request creation failed:", err)
+		return model.User{}, &authError{websocket.CloseInternalServerErr, http.StatusInternalServerError, "internal error"}
+	}
+
+	req.Header.Set("Authorization", "Bearer "+userToken)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := authHTTPClient.Do(req)
+	if err != nil {
+		log.Println("Auth API error:", err)
+		return model.User{}, &authError{websocket.CloseTryAgainLater, http.StatusServiceUnavailable, "auth service unavailable"}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		log.Printf("Auth failed with status: %d", resp.StatusCode)
+		return model.User{}, &authError{websocket.ClosePolicyViolation, http.StatusUnauthorized, "unauthorized"}
+	}
+
+	var result model.EssentialResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		log.Println("Decode error:", err)
+		return model.User{}, &authError{websocket.CloseInternalServerErr, http.StatusBadGateway, "invalid auth response"}
+	}
+
+	// Validate response User
+	if result.User.UserID == "" {
+		log.Println("No user ID in response")
+		return model.User{}, &authError{websocket.ClosePolicyViolation, http.StatusUnauthorized, "invalid user User"}
+	}
+
+	if len(result.User.Departments) == 0 {
+		log.Println("No departments found for user")
+		return model.User{}, &authError{websocket.ClosePolicyViolation, http.StatusForbidden, "no departments assigned"}
+	}
+
+	log.Printf("Employee authenticated: %s, Company: %s, Departments: %d",
+		result.User.UserID, result.User.CompanyID, len(result.User.Departments))
+
+	return result.User, nil
+}
+
+// authenticateCustomer resolves a customer token through the customer profile api.
+func authenticateCustomer(customerToken string) (model.CustomerProfileResponse, *authError) {
+	var result model.CustomerProfileResponse
+	if customerToken == "" {
+		log.Println("Missing token parameter")
+		return result, &authError{websocket.ClosePolicyViolation, http.StatusUnauthorized, "missing token"}
+	}
+	log.Printf("Customer connection attempt with token: %s...", customerToken[:min(10, len(customerToken))])
+
+	// Call customer profile API
+	req, err := http.NewRequest(
+		http.MethodGet,
+		"https://api.studiobutterfly.io/customer/profile",
+		nil,
+	)
+	if err != nil {
+		log.Println("Request creation failed:", err)
+		return result, &authError{websocket.CloseInternalServerErr, http.StatusInternalServerError, "internal error"}
+	}
+
+	req.Header.Set("Authorization", "Bearer "+customerToken)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := authHTTPClient.Do(req)
+	if err != nil {
+		log.Println("Customer auth API error:", err)
+		return result, &authError{websocket.CloseTryAgainLater, http.StatusServiceUnavailable, "auth service unavailable"}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		log.Printf("Customer auth failed with status: %d", resp.StatusCode)
+		return result, &authError{websocket.ClosePolicyViolation, http.StatusUnauthorized, "unauthorized"}
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		log.Println("Decode error:", err)
+		return result, &authError{websocket.CloseInternalServerErr, http.StatusBadGateway, "invalid auth response"}
+	}
+
+	// Validate response
+	if !result.Success || result.Data.ID == "" {
+		log.Println("Invalid customer profile response")
+		return result, &authError{websocket.ClosePolicyViolation, http.StatusUnauthorized, "invalid customer data"}
+	}
+
+	log.Printf("Customer authenticated: %s, Company: %s",
+		result.Data.ID,
+		result.Data.CompanyID,
+	)
+	return result, nil
+}
+
+// bearerToken reads "Authorization: Bearer <token>", falling back to ?token=
+// like the websocket endpoints.
+func bearerToken(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimSpace(strings.TrimPrefix(auth, "Bearer "))
+	}
+	return r.URL.Query().Get("token")
+}
+
+// writeJSON answers http endpoints in the same envelope as the main api.
+func writeJSON(w http.ResponseWriter, r *http.Request, status int, message string, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]any{
+		"success":   status < 400,
+		"message":   message,
+		"data":      data,
+		"timestamp": time.Now().Format(time.RFC3339),
+		"path":      r.URL.Path,
+	})
+}
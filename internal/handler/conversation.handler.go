@@ -0,0 +1,322 @@
+package handler
+
+import (
+	"butter-time/internal/hub"
+	"butter-time/internal/model"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// ── Conversations REST api ────────────────────────────────────────────────────
+//
+// The hub's queues for dashboards and back-office scripts. Callers are
+// agents (Authorization: Bearer <agent token>), held to the same rules as
+// on the websocket, or supervisors (X-Admin-Key), who see every company.
+//
+//	GET  /api/conversations/pending?company_id=&department_id=   waiting, per company
+//	GET  /api/conversations/active?agent_id=                     accepted, per agent
+//	GET  /api/conversation?id=<conversation id>&limit=N          one, with its messages
+//	POST /api/conversation/accept    {"conversation_id"}               agents only
+//	POST /api/conversation/reassign  {"conversation_id", "agent_id"}   to an online agent
+//	POST /api/conversation/close     {"conversation_id"}
+//
+// Agents see their own company's queue and act on their own conversations.
+// Failures come back with the websocket error codes in data.code.
+
+// apiCaller is who a request acts as: a supervisor or one agent.
+type apiCaller struct {
+	admin bool
+	agent *model.HumanAgentPass
+}
+
+func authenticateAPICaller(w http.ResponseWriter, r *http.Request) (apiCaller, bool) {
+	if isAdmin(r) {
+		return apiCaller{admin: true}, true
+	}
+	user, authErr := authenticateHumanAgent(bearerToken(r))
+	if authErr != nil {
+		writeJSON(w, r, authErr.httpStatus, authErr.msg, nil)
+		return apiCaller{}, false
+	}
+	return apiCaller{agent: &model.HumanAgentPass{
+		Id:          user.UserID,
+		CompanyId:   user.CompanyID,
+		Departments: user.Departments,
+	}}, true
+}
+
+// canSeeCompany: supervisors see every company, agents their own.
+func (c apiCaller) canSeeCompany(companyID string) bool {
+	return c.admin || c.agent.CompanyId == companyID
+}
+
+// checkActive: the caller may act on an active conversation held by agentID.
+// Another company's conversations don't exist for an agent.
+func (c apiCaller) checkActive(agentID string, conv model.ConversationPayload) *eventError {
+	if c.admin {
+		return nil
+	}
+	if conv.CustomerPass == nil || !c.canSeeCompany(conv.CustomerPass.CompanyId) {
+		return fail(codeConvNotFound).with("conversation_id", conv.Id)
+	}
+	if agentID != c.agent.Id {
+		return fail(codeConvMismatch).with("conversation_id", conv.Id)
+	}
+	return nil
+}
+
+// PendingConversationsHandler lists a company's waiting conversations,
+// optionally one department's.
+func PendingConversationsHandler(h *hub.Hub, w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, r, http.StatusMethodNotAllowed, "method not allowed", nil)
+		return
+	}
+	caller, ok := authenticateAPICaller(w, r)
+	if !ok {
+		return
+	}
+
+	companyID := r.URL.Query().Get("company_id")
+	switch {
+	case !caller.admin && companyID == "":
+		companyID = caller.agent.CompanyId
+	case companyID == "":
+		writeError(w, r, fail(codeInvalidPayload, "company_id is required").with("field", "company_id"))
+		return
+	case !caller.canSeeCompany(companyID):
+		writeError(w, r, fail(codeNotAllowed).with("company_id", companyID))
+		return
+	}
+
+	departmentID := r.URL.Query().Get("department_id")
+	list := []model.ConversationPayload{}
+	for _, conv := range h.PendingChats(companyID) {
+		if departmentID != "" && (conv.Department == nil || conv.Department.DepartmentID != departmentID) {
+			continue
+		}
+		list = append(list, conv)
+	}
+	writeJSON(w, r, http.StatusOK, "pending conversations", list)
+}
+
+// ActiveConversationsHandler lists the conversations an agent has accepted.
+func ActiveConversationsHandler(h *hub.Hub, w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, r, http.StatusMethodNotAllowed, "method not allowed", nil)
+		return
+	}
+	caller, ok := authenticateAPICaller(w, r)
+	if !ok {
+		return
+	}
+
+	agentID := r.URL.Query().Get("agent_id")
+	switch {
+	case !caller.admin && agentID == "":
+		agentID = caller.agent.Id
+	case agentID == "":
+		writeError(w, r, fail(codeInvalidPayload, "agent_id is required").with("field", "agent_id"))
+		return
+	case !caller.admin && agentID != caller.agent.Id:
+		writeError(w, r, fail(codeNotAllowed).with("agent_id", agentID))
+		return
+	}
+	writeJSON(w, r, http.StatusOK, "active conversations", h.ActiveChats(agentID))
+}
+
+// ConversationHandler returns one conversation, pending or active, with the
+// messages exchanged so far (the last ?limit=N).
+func ConversationHandler(h *hub.Hub, w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, r, http.StatusMethodNotAllowed, "method not allowed", nil)
+		return
+	}
+	caller, ok := authenticateAPICaller(w, r)
+	if !ok {
+		return
+	}
+	conversationID := r.URL.Query().Get("id")
+	if conversationID == "" {
+		writeError(w, r, fail(codeInvalidPayload, "id is required").with("field", "id"))
+		return
+	}
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+
+	if agentID, conv, ok := h.FindActiveChat(conversationID); ok {
+		if err := caller.checkActive(agentID, conv); err != nil {
+			writeError(w, r, err)
+			return
+		}
+		messages := h.ConversationMessages(agentID, conversationID, limit)
+		if messages == nil {
+			messages = []model.MsgInOut{}
+		}
+		writeJSON(w, r, http.StatusOK, "conversation", model.ConversationDetail{
+			Conversation: conv,
+			State:        "active",
+			AgentId:      agentID,
+			Messages:     messages,
+		})
+		return
+	}
+	if companyID, conv, ok := h.FindPendingChat(conversationID); ok && caller.canSeeCompany(companyID) {
+		writeJSON(w, r, http.StatusOK, "conversation", model.ConversationDetail{
+			Conversation: conv,
+			State:        "pending",
+			Messages:     []model.MsgInOut{},
+		})
+		return
+	}
+	writeError(w, r, fail(codeConvNotFound).with("conversation_id", conversationID))
+}
+
+// AcceptConversationHandler assigns a waiting conversation to the calling
+// agent, exactly like accept_chat.
+func AcceptConversationHandler(h *hub.Hub, w http.ResponseWriter, r *http.Request) {
+	caller, body, ok := readConversationAction(w, r)
+	if !ok {
+		return
+	}
+	if caller.admin {
+		writeError(w, r, fail(codeNotAllowed, "only agents can accept conversations"))
+		return
+	}
+
+	exists, chat := h.FindFromPendingChat(caller.agent.CompanyId, body.ConversationId)
+	if !exists {
+		code := codeConvNotFound
+		if acceptedElsewhere(h, caller.agent.CompanyId, body.ConversationId) {
+			code = codeAlreadyAccepted
+		}
+		writeError(w, r, fail(code).with("conversation_id", body.ConversationId))
+		return
+	}
+	conv, online, err := acceptChat(h, caller.agent, chat)
+	if err != nil {
+		writeError(w, r, asEventError(err))
+		return
+	}
+	writeJSON(w, r, http.StatusOK, "conversation accepted", map[string]any{
+		"conversation":    conv,
+		"customer_online": online,
+	})
+}
+
+// ReassignConversationHandler hands an active conversation to another
+// online agent of the same company.
+func ReassignConversationHandler(h *hub.Hub, w http.ResponseWriter, r *http.Request) {
+	caller, body, ok := readConversationAction(w, r)
+	if !ok {
+		return
+	}
+	if body.AgentId == "" {
+		writeError(w, r, fail(codeInvalidPayload, "agent_id is required").with("field", "agent_id"))
+		return
+	}
+
+	fromID, conv, found := h.FindActiveChat(body.ConversationId)
+	if !found {
+		writeError(w, r, fail(codeConvNotFound).with("conversation_id", body.ConversationId))
+		return
+	}
+	if err := caller.checkActive(fromID, conv); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if body.AgentId == fromID {
+		writeError(w, r, fail(codeInvalidPayload, "conversation is already with that agent").with("agent_id", body.AgentId))
+		return
+	}
+	var companyID string
+	if conv.CustomerPass != nil {
+		companyID = conv.CustomerPass.CompanyId
+	}
+	to, online := h.OnlineAgent(companyID, body.AgentId)
+	if !online {
+		writeError(w, r, fail(codeAgentOffline).with("agent_id", body.AgentId))
+		return
+	}
+
+	conv, err := reassignChat(h, fromID, to, body.ConversationId)
+	if err != nil {
+		writeError(w, r, asEventError(err))
+		return
+	}
+	writeJSON(w, r, http.StatusOK, "conversation reassigned", conv)
+}
+
+// CloseConversationHandler ends an active conversation, exactly like end_chat
+// from the agent holding it.
+func CloseConversationHandler(h *hub.Hub, w http.ResponseWriter, r *http.Request) {
+	caller, body, ok := readConversationAction(w, r)
+	if !ok {
+		return
+	}
+
+	agentID, conv, found := h.FindActiveChat(body.ConversationId)
+	if !found {
+		writeError(w, r, fail(codeConvNotFound).with("conversation_id", body.ConversationId))
+		return
+	}
+	if err := caller.checkActive(agentID, conv); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if conv.CustomerPass == nil {
+		writeError(w, r, fail(codeInternal, "conversation has no customer"))
+		return
+	}
+	writeJSON(w, r, http.StatusOK, "conversation closed", endChat(h, agentID, conv))
+}
+
+// readConversationAction authenticates a POST and decodes its body.
+func readConversationAction(w http.ResponseWriter, r *http.Request) (apiCaller, model.ConversationActionPayload, bool) {
+	var body model.ConversationActionPayload
+	if r.Method != http.MethodPost {
+		writeJSON(w, r, http.StatusMethodNotAllowed, "method not allowed", nil)
+		return apiCaller{}, body, false
+	}
+	caller, ok := authenticateAPICaller(w, r)
+	if !ok {
+		return apiCaller{}, body, false
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxMessageSize)).Decode(&body); err != nil {
+		writeError(w, r, fail(codeInvalidPayload, "invalid json body"))
+		return apiCaller{}, body, false
+	}
+	if err := body.Validate(); err != nil {
+		writeError(w, r, fail(codeInvalidPayload, err.Error()))
+		return apiCaller{}, body, false
+	}
+	return caller, body, true
+}
+
+// reassignChat moves the conversation in the hub and tells everyone: the old
+// agent's devices drop it, the new agent's get it in their inbox and the
+// customer's devices switch over.
+func reassignChat(h *hub.Hub, fromID string, to *model.HumanAgentPass, conversationID string) (model.ConversationPayload, error) {
+	conv, err := h.ReassignChat(fromID, to, conversationID)
+	if err != nil {
+		return conv, err
+	}
+	log.Printf("conversation %s reassigned: %s -> %s", conversationID, fromID, to.Id)
+
+	for _, v := range h.GetHumanAgentById(fromID) {
+		sendMessage(v, "chat_reassigned", conv)
+	}
+	for _, v := range h.GetHumanAgentById(to.Id) {
+		sendMessage(v, "accept_chat", conv)
+	}
+	if conv.CustomerPass == nil {
+		return conv, nil
+	}
+	// the customer's clients find their agent through the hub's assignment,
+	// which ReassignChat updated; they only need telling
+	for _, v := range h.GetCustomerById(conv.CustomerPass.Id) {
+		sendMessage(v, "agent_changed", conv.AssignedTo)
+	}
+	return conv, nil
+}
@@ -0,0 +1,102 @@
+package handler
+
+import (
+	"butter-time/internal/hub"
+	"butter-time/internal/llm"
+	"butter-time/internal/model"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	// how long a suggestion may take before it's stale
+	copilotTimeout = 30 * time.Second
+	// conversation lines given to the copilot as context
+	copilotHistory = 10
+	copilotDrafts  = 3
+)
+
+// one in-flight suggestion per conversation; a newer customer message cancels the older run
+type copilotRun struct {
+	cancel context.CancelFunc
+}
+
+var (
+	copilotMu   sync.Mutex
+	copilotRuns = make(map[string]*copilotRun)
+)
+
+// suggestReplies drafts replies to a customer message and pushes them to the
+// assigned agent's devices only. Nothing reaches the customer.
+func suggestReplies(h *hub.Hub, companyID string, agentID string, msg model.MsgInOut) {
+	if msg.ConversationId == "" || msg.Content == "" {
+		return
+	}
+	// nobody to show drafts to: don't spend quota on them
+	if len(h.GetHumanAgentById(agentID)) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), copilotTimeout)
+	run := &copilotRun{cancel: cancel}
+	copilotMu.Lock()
+	if prev, ok := copilotRuns[msg.ConversationId]; ok {
+		prev.cancel()
+	}
+	copilotRuns[msg.ConversationId] = run
+	copilotMu.Unlock()
+
+	defer func() {
+		cancel()
+		copilotMu.Lock()
+		if copilotRuns[msg.ConversationId] == run {
+			delete(copilotRuns, msg.ConversationId)
+		}
+		copilotMu.Unlock()
+	}()
+
+	var history []string
+	for _, m := range h.ConversationMessages(agentID, msg.ConversationId, copilotHistory+1) {
+		history = append(history, fmt.Sprintf("%s: %s", copilotSpeaker(m.SenderType), m.Content))
+	}
+	// the latest message is already in the queue; keep it out of the history
+	if len(history) > 0 {
+		history = history[:len(history)-1]
+	}
+
+	ctx = llm.WithConversation(ctx, msg.ConversationId)
+	suggestion, err := llm.SuggestReplies(ctx, companyID, history, msg.Content, copilotDrafts)
+	if err != nil {
+		//no quota -> no suggestions, the agent just types
+		if ctx.Err() == nil && !errors.Is(err, llm.ErrQuotaExceeded) {
+			fmt.Println("copilot error:", err)
+		}
+		return
+	}
+	if ctx.Err() != nil || len(suggestion.Drafts) == 0 {
+		return
+	}
+
+	payload := model.SuggestedReplyPayload{
+		AnswerId:       suggestion.Result.AnswerID,
+		ConversationId: msg.ConversationId,
+		CustomerId:     msg.SenderId,
+		InReplyTo:      msg.Content,
+		Drafts:         suggestion.Drafts,
+		Sources:        llm.Citations(suggestion.Result),
+	}
+	//agent devices only -> suggestions are never queued for offline agents
+	for _, device := range h.GetHumanAgentById(agentID) {
+		sendMessage(device, "suggested_reply", payload)
+	}
+}
+
+func copilotSpeaker(senderType string) string {
+	if senderType == "Customer" {
+		return "Customer"
+	}
+	return "Agent"
+}
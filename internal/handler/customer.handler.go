@@ -3,7 +3,6 @@ package handler
 import (
 	"butter-time/internal/hub"
 	"butter-time/internal/model"
-	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
@@ -13,7 +12,7 @@ import (
 )
 
 func CustomerHandler(h *hub.Hub, w http.ResponseWriter, r *http.Request) {
-	conn, err := upgrader.Upgrade(w, r, nil)
+	conn, format, err := upgrade(w, r)
 	if err != nil {
 		log.Println("Error while upgrading connection:", err)
 		return
@@ -28,67 +27,27 @@ func CustomerHandler(h *hub.Hub, w http.ResponseWriter, r *http.Request) {
 		conn.Close()
 	}
 
-	customerToken := r.URL.Query().Get("token")
-	if customerToken == "" {
-		log.Println("Missing token parameter")
-		closeConn(websocket.ClosePolicyViolation, "missing token")
+	result, authErr := authenticateCustomer(r.URL.Query().Get("token"))
+	if authErr != nil {
+		closeConn(authErr.closeCode, authErr.msg)
 		return
 	}
 
-	log.Printf("Customer connection attempt with token: %s...", customerToken[:min(10, len(customerToken))])
+	wsClient := newCustomerClient(h, result)
+	wsClient.Conn = conn
+	wsClient.Codec = format.Codec
+	wsClient.Framing = format.Framing
 
-	// Call customer profile API
-	req, err := http.NewRequest(
-		http.MethodGet,
-		"https://api.studiobutterfly.io/customer/profile",
-		nil,
-	)
-	if err != nil {
-		log.Println("Request creation failed:", err)
-		closeConn(websocket.CloseInternalServerErr, "internal error")
-		return
-	}
-
-	req.Header.Set("Authorization", "Bearer "+customerToken)
-	req.Header.Set("Content-Type", "application/json")
-
-	client := &http.Client{
-		Timeout: 5 * time.Second,
-	}
-
-	resp, err := client.Do(req)
-	if err != nil {
-		log.Println("Customer auth API error:", err)
-		closeConn(websocket.CloseTryAgainLater, "auth service unavailable")
-		return
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		log.Printf("Customer auth failed with status: %d", resp.StatusCode)
-		closeConn(websocket.ClosePolicyViolation, "unauthorized")
-		return
-	}
-
-	var result model.CustomerProfileResponse
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		log.Println("Decode error:", err)
-		closeConn(websocket.CloseInternalServerErr, "invalid auth response")
-		return
-	}
-
-	// Validate response
-	if !result.Success || result.Data.ID == "" {
-		log.Println("Invalid customer profile response")
-		closeConn(websocket.ClosePolicyViolation, "invalid customer data")
-		return
-	}
+	h.RegisterClient(wsClient)
 
-	log.Printf("Customer authenticated: %s, Company: %s",
-		result.Data.ID,
-		result.Data.CompanyID,
-	)
+	go writePump(wsClient)
+	go readPump(wsClient)
+}
 
+// newCustomerClient builds the hub client for an authenticated customer,
+// picking up the conversation they're already in. The transport fills in
+// how events reach the device (Conn or a fallback session).
+func newCustomerClient(h *hub.Hub, result model.CustomerProfileResponse) *hub.Client {
 	fmt.Printf("Incoming ID: '%s'\n", result.Data.ID)
 
 	//checking exits.....<<<<()())))
@@ -109,11 +68,10 @@ func CustomerHandler(h *hub.Hub, w http.ResponseWriter, r *http.Request) {
 	} else if h.SosStatus[result.Data.ID] {
 		sosFlag = true
 	}
-	wsClient := &hub.Client{
-		Type: "Customer",
+	client := &hub.Client{
+		Type: hub.RoleCustomer,
 		Hub:  h,
-		Conn: conn,
-		Send: make(chan []byte, 256),
+		Send: make(chan hub.Outbound, 256),
 		CustomerPass: &model.CustomerPass{
 			Id:        result.Data.ID,
 			Name:      result.Data.Name,
@@ -126,10 +84,6 @@ func CustomerHandler(h *hub.Hub, w http.ResponseWriter, r *http.Request) {
 		FlagRevealed:   flagRevealed,
 		HumanAgentPass: humanAgentPass,
 	}
-	fmt.Println("after ws client creation: ", wsClient.SosFlag, " ", wsClient.FlagRevealed, " ", *wsClient.HumanAgentPass)
-
-	h.RegisterClient(wsClient)
-
-	go writePump(wsClient)
-	go readPump(wsClient)
+	fmt.Println("after client creation: ", client.SosFlag, " ", client.FlagRevealed, " ", *client.HumanAgentPass)
+	return client
 }
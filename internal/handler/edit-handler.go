@@ -0,0 +1,139 @@
+package handler
+
+import (
+	"butter-time/internal/env"
+	"butter-time/internal/hub"
+	"butter-time/internal/llm"
+	"butter-time/internal/model"
+	"net/http"
+	"time"
+)
+
+// defaultEditWindow applies when the company's config leaves edit_window_seconds unset.
+var defaultEditWindow = env.Duration("MESSAGE_EDIT_WINDOW", 15*time.Minute)
+
+// trigger name: edit_message
+// -> the sender replaces a message's text; both sides' devices get
+// message_edited with the updated message
+func handleEditMessage(client *hub.Client, payload model.EditMessagePayload) error {
+	return changeMessage(client, payload.ConversationId, payload.MessageId, "edit", func(msg *model.MsgInOut) {
+		msg.Content = payload.Content
+	})
+}
+
+// trigger name: delete_message
+// -> the sender removes a message (text, attachment, chips and cards); both sides' devices
+// get message_deleted. The message keeps its id so receipts still line up.
+func handleDeleteMessage(client *hub.Client, payload model.DeleteMessagePayload) error {
+	return changeMessage(client, payload.ConversationId, payload.MessageId, "delete", func(msg *model.MsgInOut) {
+		msg.Content = ""
+		msg.Attachment = nil
+		msg.QuickReplies, msg.Buttons, msg.Cards = nil, nil, nil
+		msg.Deleted = true
+	})
+}
+
+// changeMessage checks the client sent the message within the company's edit
+// window, applies apply to every stored copy, records the revision and
+// broadcasts the result.
+func changeMessage(client *hub.Client, conversationID string, messageID int64, action string, apply func(*model.MsgInOut)) error {
+	agent := conversationAgent(client)
+	if agent == nil || agent.Id == "" {
+		return fail(codeNoConversation)
+	}
+	agentID := agent.Id
+	senderID := agent.Id
+	if client.Type == hub.RoleCustomer {
+		// customers only have the one conversation
+		conversationID = agent.ConversationSeal
+		senderID = client.CustomerPass.Id
+	}
+	if conversationID == "" {
+		return fail(codeInvalidPayload, "conversation_id is required").with("field", "conversation_id")
+	}
+
+	window := editWindow(senderCompany(client))
+	sentAt, tracked := client.Hub.MessageSentAt(conversationID, messageID)
+	if !tracked || window == 0 || time.Since(sentAt) > window {
+		return fail(codeEditWindow).with("message_id", messageID)
+	}
+
+	var previous model.MsgInOut
+	updated, err := client.Hub.UpdateMessage(agentID, conversationID, messageID, func(msg *model.MsgInOut) error {
+		if msg.SenderId != senderID || msg.SenderType != client.Type {
+			return fail(codeNotSender)
+		}
+		if msg.Deleted {
+			return fail(codeMsgDeleted)
+		}
+		previous = *msg
+		apply(msg)
+		msg.EditedAt = time.Now().String()
+		return nil
+	})
+	if err != nil {
+		return asEventError(err).with("message_id", messageID)
+	}
+
+	client.Hub.RecordRevision(model.MessageRevision{
+		ConversationId:     conversationID,
+		MessageId:          messageID,
+		Action:             action,
+		PreviousContent:    previous.Content,
+		PreviousAttachment: previous.Attachment,
+		NewContent:         updated.Content,
+		EditorId:           senderID,
+		EditorType:         client.Type,
+		At:                 updated.EditedAt,
+	})
+
+	customerID := updated.ReceiverId
+	if updated.SenderType == hub.RoleCustomer {
+		customerID = updated.SenderId
+	}
+	event := "message_edited"
+	if action == "delete" {
+		event = "message_deleted"
+	}
+	for _, v := range client.Hub.GetHumanAgentById(agentID) {
+		sendMessage(v, event, updated)
+	}
+	for _, v := range client.Hub.GetCustomerById(customerID) {
+		sendMessage(v, event, updated)
+	}
+	return nil
+}
+
+// MessageHistoryHandler shows supervisors every edit and delete in a
+// conversation, with what the messages said before.
+//
+//	GET /admin/message-history?conversation_id=<id>
+//	X-Admin-Key: <ADMIN_API_KEY>
+func MessageHistoryHandler(h *hub.Hub, w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, r, http.StatusMethodNotAllowed, "method not allowed", nil)
+		return
+	}
+	if !isAdmin(r) {
+		writeJSON(w, r, http.StatusUnauthorized, "admin key required", nil)
+		return
+	}
+	conversationID := r.URL.Query().Get("conversation_id")
+	if conversationID == "" {
+		writeJSON(w, r, http.StatusBadRequest, "conversation_id is required", nil)
+		return
+	}
+	writeJSON(w, r, http.StatusOK, "message history", h.MessageHistory(conversationID))
+}
+
+// editWindow is how long the company's users may change a sent message; 0 = not at all.
+func editWindow(companyID string) time.Duration {
+	switch seconds := llm.LoadAIConfig(companyID).EditWindowSeconds; {
+	case seconds < 0:
+		return 0
+	case seconds == 0:
+		return defaultEditWindow
+	default:
+		return time.Duration(seconds) * time.Second
+	}
+}
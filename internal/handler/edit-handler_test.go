@@ -0,0 +1,28 @@
+package handler
+
+import (
+	"butter-time/internal/llm"
+	"testing"
+	"time"
+)
+
+func TestEditWindowFromAIConfig(t *testing.T) {
+	cases := []struct {
+		companyID string
+		seconds   int
+		want      time.Duration
+	}{
+		{"edit-window-default", 0, defaultEditWindow},
+		{"edit-window-five-minutes", 300, 5 * time.Minute},
+		{"edit-window-never", -1, 0},
+	}
+	for _, c := range cases {
+		llm.SetAIConfig(c.companyID, llm.AIConfig{EditWindowSeconds: c.seconds})
+		if got := editWindow(c.companyID); got != c.want {
+			t.Errorf("edit_window_seconds %d: window %s, want %s", c.seconds, got, c.want)
+		}
+	}
+	if got := editWindow(""); got != defaultEditWindow {
+		t.Errorf("no company: window %s, want %s", got, defaultEditWindow)
+	}
+}
@@ -0,0 +1,162 @@
+package handler
+
+import (
+	"butter-time/internal/hub"
+	"butter-time/internal/model"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// ── Error catalogue ───────────────────────────────────────────────────────────
+//
+// Every error a websocket client can get back. A failed event is answered
+// with
+//
+//	{"type":"error","request_id":"<echoed>","payload":{"code":"E_CONV_NOT_FOUND",
+//	 "message":"conversation doesn't exist","details":{"conversation_id":"..."}}}
+//
+// and one that worked, if it carried a request_id, with
+//
+//	{"type":"ack","request_id":"<echoed>","payload":{"type":"<event type>"}}
+//
+// Codes never change meaning; add new ones here rather than reusing one.
+
+const (
+	codeBadFormat       = "E_BAD_FORMAT"       // frame isn't a {type, payload} event
+	codeUnknownEvent    = "E_UNKNOWN_EVENT"    // no such event type
+	codeNotAllowed      = "E_NOT_ALLOWED"      // the client's role or state doesn't allow it
+	codeInvalidPayload  = "E_INVALID_PAYLOAD"  // payload failed decoding or validation
+	codeRateLimited     = "E_RATE_LIMITED"     // too many events, details.retry_after_ms
+	codeNoConversation  = "E_NO_CONVERSATION"  // customer isn't talking to an agent
+	codeConvNotFound    = "E_CONV_NOT_FOUND"   // conversation isn't pending / doesn't exist
+	codeConvMismatch    = "E_CONV_MISMATCH"    // conversation belongs to someone else
+	codeAlreadyAccepted = "E_ALREADY_ACCEPTED" // customer is already talking to an agent
+	codeAgentOffline    = "E_AGENT_OFFLINE"    // reassign target isn't connected
+	codeMsgNotFound     = "E_MSG_NOT_FOUND"    // no such message in the conversation
+	codeNotSender       = "E_NOT_SENDER"       // only the sender may change a message
+	codeEditWindow      = "E_EDIT_WINDOW"      // the edit window has closed
+	codeMsgDeleted      = "E_MSG_DELETED"      // message was deleted
+	codeBadAttachment   = "E_BAD_ATTACHMENT"   // attachment unknown, other company's, wrong kind
+	codeInvalidPostback = "E_INVALID_POSTBACK" // postback wasn't offered in that message
+	codeUnknownAnswer   = "E_UNKNOWN_ANSWER"   // feedback for an answer we don't know
+	codeAIUnavailable   = "E_AI_UNAVAILABLE"   // the ai failed to answer
+	codeInternal        = "E_INTERNAL"         // our fault; try again
+)
+
+// default messages, used when an error doesn't bring its own
+var errorMessages = map[string]string{
+	codeBadFormat:       "invalid ws message format",
+	codeUnknownEvent:    "unknown message type",
+	codeNotAllowed:      "you're not allowed for this request",
+	codeInvalidPayload:  "invalid payload",
+	codeRateLimited:     "too many requests",
+	codeNoConversation:  "no active conversation",
+	codeConvNotFound:    "conversation doesn't exist",
+	codeConvMismatch:    "conversation id doesn't belong to this user",
+	codeAlreadyAccepted: "already connected",
+	codeAgentOffline:    "agent is not online",
+	codeMsgNotFound:     "message not found",
+	codeNotSender:       "only the sender can change this message",
+	codeEditWindow:      "message can no longer be edited",
+	codeMsgDeleted:      "message was deleted",
+	codeBadAttachment:   "unknown attachment",
+	codeInvalidPostback: "unknown postback",
+	codeUnknownAnswer:   "unknown answer",
+	codeAIUnavailable:   "ai is unavailable to respond",
+	codeInternal:        "server error",
+}
+
+// eventError is what handlers return for a failed event.
+type eventError struct {
+	code    string
+	message string
+	details map[string]any
+}
+
+func (e *eventError) Error() string { return e.code + ": " + e.message }
+
+// fail builds an error from the catalogue; message overrides the default.
+func fail(code string, message ...string) *eventError {
+	e := &eventError{code: code, message: errorMessages[code]}
+	if len(message) > 0 && message[0] != "" {
+		e.message = message[0]
+	}
+	return e
+}
+
+// with adds a detail for the client (the offending field, an id...).
+func (e *eventError) with(key string, value any) *eventError {
+	if e.details == nil {
+		e.details = make(map[string]any)
+	}
+	e.details[key] = value
+	return e
+}
+
+// asEventError maps anything a handler returned onto the catalogue.
+func asEventError(err error) *eventError {
+	var ee *eventError
+	if errors.As(err, &ee) {
+		return ee
+	}
+	var bad errBadPayload
+	if errors.As(err, &bad) {
+		return fail(codeInvalidPayload, err.Error())
+	}
+	if errors.Is(err, hub.ErrMessageNotFound) {
+		return fail(codeMsgNotFound)
+	}
+	if errors.Is(err, hub.ErrConversationNotFound) {
+		return fail(codeConvNotFound)
+	}
+	fmt.Println("unmapped event error:", err)
+	return fail(codeInternal)
+}
+
+// isCode reports whether err is a catalogued error with that code.
+func isCode(err error, code string) bool {
+	var ee *eventError
+	return errors.As(err, &ee) && ee.code == code
+}
+
+// sendError answers a failed event with its code, echoing the request id.
+func sendError(client *hub.Client, requestID string, err *eventError) {
+	sendEnvelope(client, model.WSMessage{
+		Type:      "error",
+		RequestId: requestID,
+		Payload: model.ErrorPayload{
+			Code:    err.code,
+			Message: err.message,
+			Details: err.details,
+			Error:   err.message,
+		},
+	}, nil)
+}
+
+// how each code is answered on the REST api; anything else is a 500
+var errorStatus = map[string]int{
+	codeNotAllowed:      http.StatusForbidden,
+	codeInvalidPayload:  http.StatusBadRequest,
+	codeRateLimited:     http.StatusTooManyRequests,
+	codeNoConversation:  http.StatusNotFound,
+	codeConvNotFound:    http.StatusNotFound,
+	codeConvMismatch:    http.StatusForbidden,
+	codeAlreadyAccepted: http.StatusConflict,
+	codeAgentOffline:    http.StatusConflict,
+	codeMsgNotFound:     http.StatusNotFound,
+}
+
+// writeError answers an http request with a catalogued error.
+func writeError(w http.ResponseWriter, r *http.Request, err *eventError) {
+	status, ok := errorStatus[err.code]
+	if !ok {
+		status = http.StatusInternalServerError
+	}
+	writeJSON(w, r, status, err.message, model.ErrorPayload{
+		Code:    err.code,
+		Message: err.message,
+		Details: err.details,
+		Error:   err.message,
+	})
+}
@@ -0,0 +1,399 @@
+package handler
+
+import (
+	"butter-time/internal/env"
+	"butter-time/internal/hub"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ── HTTP fallback transport ───────────────────────────────────────────────────
+//
+// For customers behind proxies that kill websockets. A session is a hub
+// client like any /customer connection, only its events leave through http:
+//
+//	POST   /customer/session           Authorization: Bearer <customer token>
+//	       -> {"session_id", "idle_timeout_ms"}
+//	GET    /customer/events            server-sent events, one {type, payload}
+//	       per "data:" line, same events as the websocket
+//	GET    /customer/poll?cursor=<n>   long-poll, when sse fails too
+//	       -> {"cursor", "events": [...]}; pass the cursor back on the next poll
+//	POST   /customer/send              one {type, request_id, payload}
+//	DELETE /customer/session
+//
+// Every call after the first carries the session id in an X-Session-Id
+// header. It is as good as the customer's token, so it never goes in the
+// url, where proxies and access logs would keep it (browsers need a
+// fetch-based EventSource for the header).
+//
+// Replies to /customer/send (errors, acks) come down the stream like on the
+// websocket. One reader at a time: a new stream or poll replaces the old one.
+// A session nobody reads for FALLBACK_IDLE_TIMEOUT is closed.
+
+var (
+	fallbackIdleTimeout = env.Duration("FALLBACK_IDLE_TIMEOUT", time.Minute)
+	fallbackPollWait    = env.Duration("FALLBACK_POLL_WAIT", 25*time.Second)
+	// comment line that keeps proxies from timing out a quiet stream
+	sseKeepAlive = 15 * time.Second
+)
+
+type fallbackSession struct {
+	id     string
+	client *hub.Client
+	limit  *eventLimiter
+	sendMu sync.Mutex // handlers take one event at a time per client, like readPump
+
+	mu       sync.Mutex
+	reader   chan struct{} // closed to kick the current reader
+	lastSeen time.Time
+	closed   bool
+	// long-poll: the last batch handed out, kept until the next poll
+	// confirms it arrived by sending its cursor back
+	cursor  int64
+	unacked []hub.Outbound
+	carry   *hub.Outbound // didn't fit the last batch, starts the next
+}
+
+var (
+	fallbackSessions   = make(map[string]*fallbackSession)
+	fallbackSessionsMu sync.Mutex
+	fallbackJanitor    sync.Once
+)
+
+// FallbackSessionHandler opens (POST) or ends (DELETE) a fallback session.
+func FallbackSessionHandler(h *hub.Hub, w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+	case http.MethodDelete:
+		s, ok := lookupSession(w, r)
+		if !ok {
+			return
+		}
+		closeSession(s)
+		writeJSON(w, r, http.StatusOK, "session closed", nil)
+		return
+	default:
+		writeJSON(w, r, http.StatusMethodNotAllowed, "method not allowed", nil)
+		return
+	}
+
+	result, authErr := authenticateCustomer(bearerToken(r))
+	if authErr != nil {
+		writeJSON(w, r, authErr.httpStatus, authErr.msg, nil)
+		return
+	}
+
+	s := &fallbackSession{
+		id:       uuid.NewString(),
+		client:   newCustomerClient(h, result),
+		limit:    newEventLimiter(),
+		lastSeen: time.Now(),
+	}
+	fallbackSessionsMu.Lock()
+	fallbackSessions[s.id] = s
+	fallbackSessionsMu.Unlock()
+	fallbackJanitor.Do(func() { go expireIdleSessions() })
+
+	h.RegisterClient(s.client)
+
+	writeJSON(w, r, http.StatusCreated, "session opened", map[string]any{
+		"session_id":      s.id,
+		"idle_timeout_ms": fallbackIdleTimeout.Milliseconds(),
+	})
+}
+
+// FallbackSendHandler takes one event from the customer, exactly as if it
+// came in over the websocket.
+func FallbackSendHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, r, http.StatusMethodNotAllowed, "method not allowed", nil)
+		return
+	}
+	s, ok := lookupSession(w, r)
+	if !ok {
+		return
+	}
+	message, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxMessageSize))
+	if err != nil {
+		writeJSON(w, r, http.StatusRequestEntityTooLarge, "event too large", nil)
+		return
+	}
+	s.touch()
+
+	s.sendMu.Lock()
+	handleIncomingMessage(s.client, s.limit, message)
+	s.sendMu.Unlock()
+	writeJSON(w, r, http.StatusAccepted, "event accepted", nil)
+}
+
+// FallbackEventsHandler streams the session's events as server-sent events
+// until the customer goes away or another reader takes over.
+func FallbackEventsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, r, http.StatusMethodNotAllowed, "method not allowed", nil)
+		return
+	}
+	s, ok := lookupSession(w, r)
+	if !ok {
+		return
+	}
+	kicked := s.attach()
+	defer s.detach(kicked)
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // nginx: don't buffer the stream
+	w.WriteHeader(http.StatusOK)
+	// reconnect quickly if the stream drops
+	if err := writeSSE(rc, w, "retry: 2000\n\n"); err != nil {
+		return
+	}
+	for _, message := range s.takeUnacked() {
+		if err := writeSSE(rc, w, "data: "+string(message.Data)+"\n\n"); err != nil {
+			return
+		}
+		delivered([]hub.Outbound{message})
+	}
+
+	ticker := time.NewTicker(sseKeepAlive)
+	defer ticker.Stop()
+	for {
+		select {
+		case message := <-s.client.Send:
+			if err := writeSSE(rc, w, "data: "+string(message.Data)+"\n\n"); err != nil {
+				log.Println("sse write error:", err)
+				return
+			}
+			// flushed -> delivered (read receipts)
+			delivered([]hub.Outbound{message})
+		case <-ticker.C:
+			if err := writeSSE(rc, w, ": ping\n\n"); err != nil {
+				return
+			}
+		case <-kicked:
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func writeSSE(rc *http.ResponseController, w io.Writer, chunk string) error {
+	if err := rc.SetWriteDeadline(time.Now().Add(writeWait)); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return err
+	}
+	if _, err := io.WriteString(w, chunk); err != nil {
+		return err
+	}
+	return rc.Flush()
+}
+
+// FallbackPollHandler answers with the session's pending events, waiting up
+// to FALLBACK_POLL_WAIT for one. A batch counts as delivered once the next
+// poll sends its cursor back; until then every poll gets it again.
+func FallbackPollHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, r, http.StatusMethodNotAllowed, "method not allowed", nil)
+		return
+	}
+	s, ok := lookupSession(w, r)
+	if !ok {
+		return
+	}
+	kicked := s.attach()
+	defer s.detach(kicked)
+
+	cursor, _ := strconv.ParseInt(r.URL.Query().Get("cursor"), 10, 64)
+	last, batch := s.confirm(cursor)
+	if len(batch) > 0 {
+		writePoll(w, r, last, batch)
+		return
+	}
+
+	var first hub.Outbound
+	if carry := s.takeCarry(); carry != nil {
+		first = *carry
+	} else {
+		timer := time.NewTimer(fallbackPollWait)
+		defer timer.Stop()
+		select {
+		case first = <-s.client.Send:
+		case <-timer.C:
+			writePoll(w, r, last, nil)
+			return
+		case <-kicked:
+			writePoll(w, r, last, nil)
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+	batch, carry, _ := gatherBatch(s.client.Send, []hub.Outbound{first})
+	writePoll(w, r, s.handOut(batch, carry), batch)
+}
+
+func writePoll(w http.ResponseWriter, r *http.Request, cursor int64, batch []hub.Outbound) {
+	events := make([]json.RawMessage, len(batch))
+	for i, message := range batch {
+		events[i] = message.Data
+	}
+	writeJSON(w, r, http.StatusOK, "events", map[string]any{
+		"cursor": cursor,
+		"events": events,
+	})
+}
+
+// confirm marks the unacked batch delivered if cursor is its own. Otherwise
+// the last response never arrived: it returns the batch and its cursor to
+// send again.
+func (s *fallbackSession) confirm(cursor int64) (int64, []hub.Outbound) {
+	s.mu.Lock()
+	last, batch := s.cursor, s.unacked
+	if cursor == last {
+		s.unacked = nil
+	}
+	s.mu.Unlock()
+
+	if cursor != last {
+		return last, batch
+	}
+	delivered(batch)
+	return last, nil
+}
+
+// handOut keeps batch (and the event that didn't fit) until the next poll
+// and returns its cursor.
+func (s *fallbackSession) handOut(batch []hub.Outbound, carry *hub.Outbound) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cursor++
+	s.unacked = batch
+	s.carry = carry
+	return s.cursor
+}
+
+func (s *fallbackSession) takeCarry() *hub.Outbound {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	carry := s.carry
+	s.carry = nil
+	return carry
+}
+
+// takeUnacked hands whatever long-poll left over to a new event stream.
+func (s *fallbackSession) takeUnacked() []hub.Outbound {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pending := s.unacked
+	if s.carry != nil {
+		pending = append(pending, *s.carry)
+	}
+	s.unacked, s.carry = nil, nil
+	return pending
+}
+
+func delivered(batch []hub.Outbound) {
+	for _, message := range batch {
+		if message.OnDelivered != nil {
+			message.OnDelivered()
+		}
+	}
+}
+
+// attach makes the caller the session's reader, kicking the previous one.
+func (s *fallbackSession) attach() chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.reader != nil {
+		close(s.reader)
+	}
+	s.reader = make(chan struct{})
+	s.lastSeen = time.Now()
+	return s.reader
+}
+
+func (s *fallbackSession) detach(reader chan struct{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.reader == reader {
+		s.reader = nil
+	}
+	s.lastSeen = time.Now()
+}
+
+func (s *fallbackSession) touch() {
+	s.mu.Lock()
+	s.lastSeen = time.Now()
+	s.mu.Unlock()
+}
+
+// idle: nobody is reading and nobody has for fallbackIdleTimeout
+func (s *fallbackSession) idle(now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.reader == nil && now.Sub(s.lastSeen) > fallbackIdleTimeout
+}
+
+func lookupSession(w http.ResponseWriter, r *http.Request) (*fallbackSession, bool) {
+	id := r.Header.Get("X-Session-Id")
+	if id == "" {
+		writeJSON(w, r, http.StatusUnauthorized, "X-Session-Id header is required", nil)
+		return nil, false
+	}
+	fallbackSessionsMu.Lock()
+	s, ok := fallbackSessions[id]
+	fallbackSessionsMu.Unlock()
+	if !ok {
+		writeJSON(w, r, http.StatusNotFound, "unknown or expired session", nil)
+		return nil, false
+	}
+	return s, true
+}
+
+// closeSession takes the client off the hub and kicks its reader.
+func closeSession(s *fallbackSession) {
+	fallbackSessionsMu.Lock()
+	delete(fallbackSessions, s.id)
+	fallbackSessionsMu.Unlock()
+
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	s.closed = true
+	if s.reader != nil {
+		close(s.reader)
+		s.reader = nil
+	}
+	s.mu.Unlock()
+
+	s.client.Hub.UnregisterClient(s.client)
+}
+
+func expireIdleSessions() {
+	ticker := time.NewTicker(max(fallbackIdleTimeout/2, time.Second))
+	defer ticker.Stop()
+	for now := range ticker.C {
+		fallbackSessionsMu.Lock()
+		var expired []*fallbackSession
+		for _, s := range fallbackSessions {
+			if s.idle(now) {
+				expired = append(expired, s)
+			}
+		}
+		fallbackSessionsMu.Unlock()
+		for _, s := range expired {
+			closeSession(s)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package handler
+
+import (
+	"butter-time/internal/hub"
+	"butter-time/internal/llm"
+	"butter-time/internal/model"
+	"errors"
+	"fmt"
+)
+
+// handleFeedback files a thumbs up/down against an ai answer (butter_sources)
+// or a copilot suggestion (suggested_reply). Both customers and agents may rate.
+func handleFeedback(client *hub.Client, in model.FeedbackPayload) error {
+	var companyID, raterID string
+	switch {
+	case client.Type == hub.RoleHumanAgent && client.HumanAgentPass != nil:
+		companyID, raterID = client.HumanAgentPass.CompanyId, client.HumanAgentPass.Id
+	case client.Type == hub.RoleCustomer && client.CustomerPass != nil:
+		companyID, raterID = client.CustomerPass.CompanyId, client.CustomerPass.Id
+	default:
+		return fail(codeNotAllowed)
+	}
+
+	err := llm.RecordFeedback(companyID, llm.Feedback{
+		AnswerID:  in.AnswerId,
+		Rating:    in.Rating,
+		Reason:    in.Reason,
+		Comment:   in.Comment,
+		RaterType: client.Type,
+		RaterID:   raterID,
+	})
+	switch {
+	case errors.Is(err, llm.ErrInvalidFeedback):
+		return fail(codeInvalidPayload, err.Error())
+	case errors.Is(err, llm.ErrUnknownAnswer):
+		return fail(codeUnknownAnswer, err.Error()).with("answer_id", in.AnswerId)
+	case err != nil:
+		fmt.Println("feedback store error:", err)
+		return fail(codeInternal, "could not save feedback")
+	}
+	sendMessage(client, "feedback_ack", map[string]string{"answer_id": in.AnswerId})
+	return nil
+}
@@ -4,89 +4,65 @@ import (
 	"butter-time/internal/constructor"
 	"butter-time/internal/hub"
 	"butter-time/internal/model"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"time"
 )
 
-func handleIncomingMessage(client *hub.Client, message []byte) {
-	fmt.Println("incomming message to handler: ", string(message))
-	var wsMsg model.WSMessage
-	if err := json.Unmarshal(message, &wsMsg); err != nil {
-		sendError(client, "Invalid WS message format")
-		return
-	}
-	switch wsMsg.Type {
-	case "transfer_chat":
-		if client.Type != "Customer" {
-			sendError(client, "you're not allowed for this request")
-			return
-		}
-		handleChatTransferToHumanAgent(client, wsMsg.Payload)
-	case "accept_chat":
-		if client.Type != "Human-Agent" {
-			sendError(client, "you're not allowed for this request")
-			return
-		}
-		handleHumanAcceptTheChat(client, wsMsg.Payload)
-	case "end_chat":
-		if client.Type != "Human-Agent" {
-			sendError(client, "you're not allowed for this request")
-			return
-		}
-		handleEndtheChat(client, wsMsg.Payload)
-	case "message":
-		if client.FlagRevealed == true {
-			fmt.Println("Client Type: ", client.Type)
-			handleConversationWithHuman(client, wsMsg.Payload)
-		} else {
-			sendMessage(client, "butter_chat", "ai chat for customers coming soon...")
-			//handleChatStreamMessage(client, wsMsg.Payload)
-		}
-	case "butter_chat":
-		if client.Type != "Human-Agent" {
-			sendMessage(client, "ai_message", "this event is for butter-chat users only...")
-			return
-		}
-		handleAiStream(client, wsMsg.Payload)
-
-	case "ping":
+func init() {
+	on("transfer_chat", customerOnly, handleChatTransferToHumanAgent)
+	on("accept_chat", agentOnly, handleHumanAcceptTheChat)
+	on("end_chat", agentOnly, handleEndtheChat)
+	on("message", anyRole, handleChatMessage)
+	on("butter_chat", agentOnly, handleAiStream)
+	on("feedback", anyRole, handleFeedback)
+	on("typing_start", anyRole, handleTypingStart)
+	on("typing_stop", anyRole, handleTypingStop)
+	on("read", anyRole, handleRead)
+	on("edit_message", anyRole, handleEditMessage)
+	on("delete_message", anyRole, handleDeleteMessage)
+	on("ping", anyRole, func(client *hub.Client, _ struct{}) error {
 		fmt.Println("pinging...")
 		sendPong(client)
-	default:
-		sendError(client, "Unknown message type")
-	}
+		return nil
+	})
+}
+
+func handleIncomingMessage(client *hub.Client, limit *eventLimiter, message []byte) {
+	dispatchEvent(client, limit, message)
 }
 
 // sendMessage sends a message to a specific client
 func sendMessage(client *hub.Client, msgType string, payload interface{}) {
+	sendTracked(client, msgType, payload, nil)
+}
+
+// sendTracked is sendMessage with a hook for when the device actually got it
+// (read receipts: delivered)
+func sendTracked(client *hub.Client, msgType string, payload interface{}, onDelivered func()) {
 	wsMsg := model.WSMessage{
 		Type:    msgType,
 		Payload: payload,
 	}
+	sendEnvelope(client, wsMsg, onDelivered)
+}
 
-	msgBytes, err := json.Marshal(wsMsg)
+// sendEnvelope sends an already built message (replies with a request_id)
+func sendEnvelope(client *hub.Client, wsMsg model.WSMessage, onDelivered func()) {
+	msgBytes, err := client.Encode(wsMsg)
 	if err != nil {
 		log.Println("Error marshaling message:", err)
 		return
 	}
 
 	select {
-	case client.Send <- msgBytes:
+	case client.Send <- hub.Outbound{Data: msgBytes, OnDelivered: onDelivered}:
 	default:
 		log.Println("Client send channel is full")
 	}
 }
 
-// sendError sends an error message to the client
-func sendError(client *hub.Client, errorMsg string) {
-	errorPayload := map[string]string{
-		"error": errorMsg,
-	}
-	sendMessage(client, "error", errorPayload)
-}
-
 // sendPong responds to ping messages
 func sendPong(client *hub.Client) {
 	pongPayload := map[string]string{
@@ -103,16 +79,20 @@ func sendPong(client *hub.Client) {
    any agent the request will remain in the queue and everytime new agent logs in he
    will receive the queue....:.....
 */
-func handleChatTransferToHumanAgent(client *hub.Client, payload any) {
+func handleChatTransferToHumanAgent(client *hub.Client, payload model.ConversationPayload) error {
 	// 1. cheking the sos flag -> to processed // else duplicate request (done...)
 	fmt.Println("Transfer Chat : -> ", payload) //need for transfer... (nothing)
 	if !client.SosFlag {
+		//-> step1-> creating conversation payload
+		conversation, err := constructor.ConversationPayloadConstructor(payload, true)
+		if err != nil {
+			log.Println("conversation payload error:", err)
+			return fail(codeInternal)
+		}
 		client.SosFlag = true
 		client.Hub.SosStatus[client.CustomerPass.Id] = true
 		//todo : need to mark all active device true....
 		//---->>>><<<<<_______>>>><<<<<<<<<<<<OOOOOOOOOO
-		//-> step1-> creating conversation payload
-		conversation, err := constructor.ConversationPayloadConstructor(payload, true)
 		conversation.CustomerPass = client.CustomerPass
 		connList := client.Hub.GetHumanAgents() //<- all active agents (done without company isolation)
 		if len(connList) == 0 {
@@ -128,12 +108,6 @@ func handleChatTransferToHumanAgent(client *hub.Client, payload any) {
 		} else {
 			//everyting alright
 			//-> step2-> sending the payload as byte in SendMessage()
-			//step:1
-			if err != nil {
-				fmt.Println("error decoding to byte: conversation payload")
-				sendMessage(client, "connection_event", "server error")
-			}
-			//step:2
 			//boradcasting the conversation -|-------->>>>>[Human Agents]
 			for _, conn := range connList {
 				sendMessage(conn, "transfer_chat", conversation)
@@ -154,6 +128,7 @@ func handleChatTransferToHumanAgent(client *hub.Client, payload any) {
 		fmt.Println("before insert ", len(client.Hub.PendingChatQueue[client.CustomerPass.CompanyId]))
 		sendMessage(client, "pending", duplicateMsgPayload)
 	}
+	return nil
 }
 
 // trigger name: accept_chat (for users)
@@ -163,119 +138,144 @@ func handleChatTransferToHumanAgent(client *hub.Client, payload any) {
 // -> broadcast accept event to user devices
 // -> broadcast conversation to the human agent devices inbox
 // -> remove from pending list for all agents
-func handleHumanAcceptTheChat(client *hub.Client, payload any) {
+func handleHumanAcceptTheChat(client *hub.Client, payload model.ConversationPayload) error {
 	fmt.Println("accept chat : ")
+	_, online, err := acceptChat(client.Hub, client.HumanAgentPass, payload)
+	if isCode(err, codeAlreadyAccepted) {
+		sendMessage(client, "accepted", "already connected")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !online {
+		sendMessage(client, "customer_offline", "customer offline...")
+		return nil
+	}
+	sendMessage(client, "connection_stablished", "connection stablished")
+	return nil
+}
+
+// acceptChat assigns a pending conversation to agent (accept_chat and the
+// REST api). online tells whether the customer has a device connected.
+func acceptChat(h *hub.Hub, agent *model.HumanAgentPass, payload model.ConversationPayload) (model.ConversationPayload, bool, error) {
 	conversation, err := constructor.ConversationPayloadConstructor(payload, false)
 	fmt.Println("conversation:", conversation)
 	if err != nil {
 		fmt.Println("error decoding to byte: conversation payload")
-		sendMessage(client, "connection_event", err.Error())
-		return
+		return conversation, false, fail(codeInvalidPayload, err.Error())
+	}
+	if conversation.CustomerPass == nil {
+		return conversation, false, fail(codeInvalidPayload, "customer is required").with("field", "customer")
 	}
 
-	customer := client.Hub.GetCustomerById(conversation.CustomerPass.Id)
+	customer := h.GetCustomerById(conversation.CustomerPass.Id)
 	if len(customer) != 0 && customer[0].FlagRevealed {
-		sendMessage(client, "accepted", "already connected")
-		return
+		return conversation, true, fail(codeAlreadyAccepted).with("conversation_id", conversation.Id)
 	}
 
-	exists, chat := client.Hub.FindFromPendingChat(client.HumanAgentPass.CompanyId, conversation.Id)
-	fmt.Println("pending chat: ", client.Hub.PendingChatQueue[client.HumanAgentPass.CompanyId])
-	if !exists {
-		fmt.Println("error decoding to byte: Conversation doesn't exist")
-		sendMessage(client, "connection_event", "conversation doesn't exist")
-		return
-	}
-	if chat.CustomerPass.Id != conversation.CustomerPass.Id {
-		fmt.Println("invalid request: conversation id doesn't belong to this user")
-		sendMessage(client, "connection_event", "conversation id doesn't belong to this user")
-		return
-	}
 	//update the assigned person to self....
 	conversation.AssignedTo = &model.AssignedTo{
-		Id: client.HumanAgentPass.Id,
+		Id: agent.Id,
 		//Name: "Dummy Name", //need to update api response
 		//ProfileUri: "Dummy ",
 	}
 	conversation.Status = "on going"
-	//mark the customer accepted and connected to human:
-	///->
-	AgentPassSeal := client.HumanAgentPass
-	AgentPassSeal.ConversationSeal = conversation.Id
-	client.Hub.MarkCustomerAccepted(
-		conversation.CustomerPass.Id,
-		AgentPassSeal,
-	)
-	//push to the queue for this agent list of map:
-	client.Hub.AddToActiveChat(
-		client.HumanAgentPass.Id,
-		conversation,
-	)
-	//todo: remove from pending list of all devices of this company - (*department*):
-	client.Hub.RemoveFromPending(
-		client.HumanAgentPass.CompanyId,
-		conversation.Id,
-	)
+	//pending -> this agent's active chats, customer marked accepted; one
+	//step, so of two agents accepting at once the second finds it taken
+	err = h.AcceptPendingChat(agent, conversation)
+	switch {
+	case errors.Is(err, hub.ErrConversationMismatch):
+		return conversation, false, fail(codeConvMismatch).with("conversation_id", conversation.Id)
+	case err != nil:
+		if acceptedElsewhere(h, agent.CompanyId, conversation.Id) {
+			return conversation, false, fail(codeAlreadyAccepted).with("conversation_id", conversation.Id)
+		}
+		return conversation, false, fail(codeConvNotFound).with("conversation_id", conversation.Id)
+	}
 	//----------------------------------------
 	//--->> broadcast the inbox to all devices of the Human Agent
 	//human agent devics:
-	agentDevices := client.Hub.GetHumanAgentById(client.HumanAgentPass.Id)
+	agentDevices := h.GetHumanAgentById(agent.Id)
 	//send to inbox list:
-	for _, agent := range agentDevices {
-		sendMessage(agent, "accept_chat", conversation)
+	for _, v := range agentDevices {
+		sendMessage(v, "accept_chat", conversation)
 	}
 	//send the accept flag to the customer....
 	msg := model.WSMessage{
 		Type:    "accepted",
 		Payload: "connected to human",
 	}
+	h.AddEventToCustomerEventQueue(conversation.CustomerPass.Id, msg)
 	if len(customer) == 0 {
-		client.Hub.AddEventToCustomerEventQueue(conversation.CustomerPass.Id, msg)
-		sendMessage(client, "customer_offline", "customer offline...")
-		return
+		return conversation, false, nil
 	}
-	client.Hub.AddEventToCustomerEventQueue(conversation.CustomerPass.Id, msg)
 	for _, v := range customer {
 		v.FlagRevealed = true
 		v.HumanAgentPass = &model.HumanAgentPass{
-			Id:               client.HumanAgentPass.Id,
-			CompanyId:        client.HumanAgentPass.CompanyId,
-			Departments:      client.HumanAgentPass.Departments,
+			Id:               agent.Id,
+			CompanyId:        agent.CompanyId,
+			Departments:      agent.Departments,
 			ConversationSeal: conversation.Id,
 		}
 		sendMessage(v, "connection_stablished", "connection request accepted")
 	}
-	sendMessage(client, "connection_stablished", "connection stablished")
+	return conversation, true, nil
+}
+
+// acceptedElsewhere: the conversation is already with an agent of the company.
+func acceptedElsewhere(h *hub.Hub, companyID, conversationID string) bool {
+	_, conv, active := h.FindActiveChat(conversationID)
+	return active && conv.CustomerPass != nil && conv.CustomerPass.CompanyId == companyID
+}
+
+// conversationAgent is the pass of the agent a client's conversation is with:
+// an agent's own, or for a customer the hub's assignment, which reassignment
+// changes without touching the customer's clients.
+func conversationAgent(client *hub.Client) *model.HumanAgentPass {
+	if client.Type == hub.RoleCustomer && client.CustomerPass != nil {
+		if agent, ok := client.Hub.AssignedAgent(client.CustomerPass.Id); ok {
+			return agent
+		}
+	}
+	return client.HumanAgentPass
 }
 
 // trigger name: message
-func handleConversationWithHuman(client *hub.Client, payload any) {
-	//-> steps:
-	//1. construct the payload
-	payloadByte, err := json.Marshal(payload)
-	if err != nil {
-		fmt.Println(err)
-		return
+func handleChatMessage(client *hub.Client, data model.MsgInOut) error {
+	if client.FlagRevealed {
+		fmt.Println("Client Type: ", client.Type)
+		return handleConversationWithHuman(client, data)
 	}
-	var data model.MsgInOut
-	json.Unmarshal(payloadByte, &data)
+	sendMessage(client, "butter_chat", "ai chat for customers coming soon...")
+	//handleChatStreamMessage(client, data)
+	return nil
+}
+
+func handleConversationWithHuman(client *hub.Client, data model.MsgInOut) error {
 	fmt.Println("message Data: ", data)
 
-	if client.Type == "Human-Agent" {
+	if client.Type == hub.RoleHumanAgent {
 		if data.ReceiverId == "" || data.ConversationId == "" {
-			sendError(client, "invalid payload")
-			return
+			return fail(codeInvalidPayload, "receiver_id and conversation_id are required")
 		}
 		customer := client.Hub.GetCustomerById(data.ReceiverId)
 		fmt.Println("customer: ->", customer)
 		if len(customer) != 0 && customer[0].FlagRevealed != true {
-			sendMessage(client, "connection_event", "you're not allowed to text unless customer wants")
-			return
+			return fail(codeNotAllowed, "you're not allowed to text unless customer wants")
+		}
+		if err := resolveAttachment(senderCompany(client), &data); err != nil {
+			return fail(codeBadAttachment, err.Error())
+		}
+		if err := checkRichContent(client, &data); err != nil {
+			return err
 		}
+		stopTyping(client, data.ReceiverId)
 		data.SenderId = client.HumanAgentPass.Id
-		data.ContentType = "text"
 		data.CreatedAt = time.Now().String()
-		data.SenderType = "Human-Agent"
+		data.SenderType = hub.RoleHumanAgent
+		data.Id, data.Status = client.Hub.NewMessage(data.ConversationId, hub.RoleHumanAgent, data.SenderId, data.ReceiverId)
+		delivered := markDelivered(client.Hub, data)
 		msgPayload := &model.WSMessage{
 			Type:    "message",
 			Payload: data,
@@ -292,7 +292,7 @@ func handleConversationWithHuman(client *hub.Client, payload any) {
 			fmt.Println(len(client.Hub.CustomerMessageQueue))
 			fmt.Println(client.Hub.CustomerMessageQueue[data.ReceiverId])
 			sendMessage(client, "customer_offline", "customer offline, message added to customer message queue")
-			return
+			return nil
 		}
 		client.Hub.AddMessageToCustomerQueue(data.ReceiverId, msgPayload)
 		client.Hub.AddMessageToHumanAgentQueue(client.HumanAgentPass.Id, msgPayload)
@@ -300,46 +300,60 @@ func handleConversationWithHuman(client *hub.Client, payload any) {
 		// client.Hub.CustomerMessageQueue[data.ReceiverId] = append(client.Hub.CustomerMessageQueue[data.ReceiverId], msgPayload)
 		// client.Hub.HumanAgentMessageQueue[client.HumanAgentPass.Id] = append(client.Hub.HumanAgentMessageQueue[client.HumanAgentPass.Id], msgPayload)
 		for _, v := range customer {
-			sendMessage(v, "message", data)
+			sendTracked(v, "message", data, delivered)
 		}
+		client.Hub.NotifyUnread(data.ConversationId, hub.RoleCustomer, data.ReceiverId)
 		//broadcast to all agent devices//
 		for _, v := range client.Hub.GetHumanAgentById(client.HumanAgentPass.Id) {
 			sendMessage(v, "message", data)
 		}
 		//............................................//
-	} else if client.Type == "Customer" {
-		humanAgent := client.Hub.GetHumanAgentById(client.HumanAgentPass.Id)
+	} else if client.Type == hub.RoleCustomer {
+		if err := resolveAttachment(senderCompany(client), &data); err != nil {
+			return fail(codeBadAttachment, err.Error())
+		}
+		if err := checkRichContent(client, &data); err != nil {
+			return err
+		}
+		agent := conversationAgent(client)
+		humanAgent := client.Hub.GetHumanAgentById(agent.Id)
+		stopTyping(client, "")
 		data.SenderId = client.CustomerPass.Id
-		data.ReceiverId = client.HumanAgentPass.Id
-		data.ConversationId = client.HumanAgentPass.ConversationSeal
-		data.ContentType = "text"
+		data.ReceiverId = agent.Id
+		data.ConversationId = agent.ConversationSeal
 		data.CreatedAt = time.Now().String()
-		data.SenderType = "Customer"
+		data.SenderType = hub.RoleCustomer
+		data.Id, data.Status = client.Hub.NewMessage(data.ConversationId, hub.RoleCustomer, data.SenderId, data.ReceiverId)
+		delivered := markDelivered(client.Hub, data)
 		msgPayload := &model.WSMessage{
 			Type:    "message",
 			Payload: data,
 		}
-		fmt.Println("conversation seal: ", client.HumanAgentPass.ConversationSeal)
+		fmt.Println("conversation seal: ", agent.ConversationSeal)
 		if len(humanAgent) == 0 {
-			client.Hub.AddMessageToHumanAgentQueue(client.HumanAgentPass.Id, msgPayload)
+			client.Hub.AddMessageToHumanAgentQueue(agent.Id, msgPayload)
 			client.Hub.AddMessageToCustomerQueue(client.CustomerPass.Id, msgPayload)
 			//client.Hub.HumanAgentMessageQueue[client.HumanAgentPass.Id] = append(client.Hub.HumanAgentMessageQueue[client.HumanAgentPass.Id], msgPayload)
 
 			sendMessage(client, "agent_offline", "agent offline, message added to agent queue")
-			return
+			return nil
 		}
-		client.Hub.AddMessageToHumanAgentQueue(client.HumanAgentPass.Id, msgPayload)
+		client.Hub.AddMessageToHumanAgentQueue(agent.Id, msgPayload)
 		client.Hub.AddMessageToCustomerQueue(client.CustomerPass.Id, msgPayload)
 
 		//client.Hub.HumanAgentMessageQueue[client.HumanAgentPass.Id] = append(client.Hub.HumanAgentMessageQueue[client.HumanAgentPass.Id], msgPayload)
 		//client.Hub.CustomerMessageQueue[client.CustomerPass.Id] = append(client.Hub.CustomerMessageQueue[client.CustomerPass.Id], msgPayload)
 		for _, v := range humanAgent {
-			sendMessage(v, "message", data)
+			sendTracked(v, "message", data, delivered)
 		}
+		client.Hub.NotifyUnread(data.ConversationId, hub.RoleHumanAgent, data.ReceiverId)
 		for _, v := range client.Hub.GetCustomerById(client.CustomerPass.Id) {
 			sendMessage(v, "message", data)
 		}
+		//copilot: reply drafts for the assigned agent (agent devices only)
+		go suggestReplies(client.Hub, client.CustomerPass.CompanyId, agent.Id, data)
 	}
+	return nil
 }
 
 // trigger name: end_chat
@@ -354,21 +368,27 @@ func handleConversationWithHuman(client *hub.Client, payload any) {
 // 3. update sos flag
 // '4. unmark flag
 // *//
-func handleEndtheChat(client *hub.Client, payload any) {
+func handleEndtheChat(client *hub.Client, payload model.ConversationPayload) error {
 	conversation, err := constructor.ConversationPayloadConstructor(payload, false)
 	if err != nil {
 		log.Print("conversation construction err-> handle end chat:", err)
 	}
+	endChat(client.Hub, client.HumanAgentPass.Id, conversation)
+	return nil
+}
+
+// endChat closes an agent's conversation (end_chat and the REST api).
+func endChat(h *hub.Hub, humanAgentId string, conversation model.ConversationPayload) model.ConversationPayload {
 	companyId := conversation.CompanyId
 	customerId := conversation.CustomerPass.Id
-	humanAgentId := client.HumanAgentPass.Id
 	conversationId := conversation.Id
 	conversation.Status = "Complete"
 	fmt.Println(companyId, customerId, humanAgentId, conversationId)
-	customer := client.Hub.GetCustomerById(customerId)
+	customer := h.GetCustomerById(customerId)
 
-	client.Hub.UnMarkCustomerAccepted(customerId)
-	client.Hub.RemoveFromActiveChat(humanAgentId, customerId)
+	h.UnMarkCustomerAccepted(customerId)
+	h.ForgetReceipts(conversationId)
+	h.RemoveFromActiveChat(humanAgentId, customerId)
 
 	for _, v := range customer {
 		v.FlagRevealed = false
@@ -376,8 +396,9 @@ func handleEndtheChat(client *hub.Client, payload any) {
 		v.HumanAgentPass = nil
 		sendMessage(v, "end_chat", "conversation ended")
 	}
-	agents := client.Hub.GetHumanAgentById(client.HumanAgentPass.Id)
+	agents := h.GetHumanAgentById(humanAgentId)
 	for _, v := range agents {
 		sendMessage(v, "end_chat", conversation)
 	}
+	return conversation
 }
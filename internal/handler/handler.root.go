@@ -1,10 +1,14 @@
 package handler
 
 import (
+	"butter-time/internal/codec"
+	"butter-time/internal/env"
 	"butter-time/internal/hub"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -18,6 +22,38 @@ var upgrader = websocket.Upgrader{
 	WriteBufferSize: 1024,
 }
 
+// upgrade switches the connection to websocket in the wire format and
+// framing the client asked for (Sec-WebSocket-Protocol and ?framing=, see
+// codec). Anything we don't speak is refused before the upgrade.
+func upgrade(w http.ResponseWriter, r *http.Request) (*websocket.Conn, connFormat, error) {
+	offered := websocket.Subprotocols(r)
+	wire, ok := codec.Negotiate(offered)
+	if !ok {
+		writeJSON(w, r, http.StatusBadRequest, "unsupported subprotocol, use one of: "+strings.Join(codec.Subprotocols(), ", "), nil)
+		return nil, connFormat{}, errors.New("no supported subprotocol in " + strings.Join(offered, ", "))
+	}
+	framing, err := codec.ParseFraming(r.URL.Query().Get("framing"), wire)
+	if err != nil {
+		writeJSON(w, r, http.StatusBadRequest, err.Error(), nil)
+		return nil, connFormat{}, err
+	}
+	var header http.Header
+	if len(offered) > 0 {
+		header = http.Header{"Sec-Websocket-Protocol": {wire.Name()}}
+	}
+	conn, err := upgrader.Upgrade(w, r, header)
+	if err != nil {
+		return nil, connFormat{}, err
+	}
+	return conn, connFormat{Codec: wire, Framing: framing}, nil
+}
+
+// connFormat is how a connection's events are encoded and framed.
+type connFormat struct {
+	Codec   codec.Codec
+	Framing string
+}
+
 const (
 	// Time allowed to write a message to the peer
 	writeWait = 10 * time.Second
@@ -32,6 +68,13 @@ const (
 	maxMessageSize = 512 * 1024 // 512KB
 )
 
+// batching limits for the array and ndjson framings
+var (
+	wsBatchMaxEvents = env.Int("WS_BATCH_MAX_EVENTS", 50)
+	wsBatchMaxBytes  = env.Int("WS_BATCH_MAX_BYTES", 64*1024)
+	wsBatchMaxDelay  = env.Duration("WS_BATCH_MAX_DELAY", 10*time.Millisecond)
+)
+
 // readPump reads messages from the WebSocket connection
 func readPump(client *hub.Client) {
 	defer func() {
@@ -46,6 +89,7 @@ func readPump(client *hub.Client) {
 		return nil
 	})
 
+	limit := newEventLimiter()
 	for {
 		_, message, err := client.Conn.ReadMessage()
 		if err != nil {
@@ -56,11 +100,13 @@ func readPump(client *hub.Client) {
 		}
 		//client.Hub.MessageQueue[] = append(client.Hub.MessageQueue[], string(message))
 		fmt.Println(string(message))
-		handleIncomingMessage(client, message)
+		handleIncomingMessage(client, limit, message)
 	}
 }
 
-// writePump writes messages to the WebSocket connection
+// writePump writes messages to the WebSocket connection. In the batching
+// framings it gathers what's queued into one frame, up to wsBatchMaxEvents
+// events or wsBatchMaxBytes, waiting at most wsBatchMaxDelay for more.
 func writePump(client *hub.Client) {
 	ticker := time.NewTicker(pingPeriod)
 	defer func() {
@@ -68,38 +114,102 @@ func writePump(client *hub.Client) {
 		client.Conn.Close()
 	}()
 
+	// an event that didn't fit the previous batch starts the next one
+	var carry *hub.Outbound
 	for {
-		select {
-		case message, ok := <-client.Send:
-			client.Conn.SetWriteDeadline(time.Now().Add(writeWait))
-			if !ok {
-				// The hub closed the channel
-				client.Conn.WriteMessage(websocket.CloseMessage, []byte{})
-				return
+		var first hub.Outbound
+		if carry != nil {
+			first, carry = *carry, nil
+		} else {
+			select {
+			case message, ok := <-client.Send:
+				if !ok {
+					// The hub closed the channel
+					client.Conn.SetWriteDeadline(time.Now().Add(writeWait))
+					client.Conn.WriteMessage(websocket.CloseMessage, []byte{})
+					return
+				}
+				first = message
+
+			case <-ticker.C:
+				client.Conn.SetWriteDeadline(time.Now().Add(writeWait))
+				if err := client.Conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+					return
+				}
+				continue
 			}
+		}
 
-			w, err := client.Conn.NextWriter(websocket.TextMessage)
-			if err != nil {
-				return
-			}
-			w.Write(message)
+		batch := []hub.Outbound{first}
+		closed := false
+		if client.Framing == codec.FrameArray || client.Framing == codec.FrameLines {
+			batch, carry, closed = gatherBatch(client.Send, batch)
+		}
 
-			// Add queued messages to the current websocket message
-			n := len(client.Send)
-			for i := 0; i < n; i++ {
-				w.Write([]byte{'\n'})
-				w.Write(<-client.Send)
+		client.Conn.SetWriteDeadline(time.Now().Add(writeWait))
+		if err := writeFrame(client, batch); err != nil {
+			return
+		}
+		// flushed -> delivered (read receipts)
+		for _, message := range batch {
+			if message.OnDelivered != nil {
+				message.OnDelivered()
 			}
+		}
+		if closed {
+			client.Conn.WriteMessage(websocket.CloseMessage, []byte{})
+			return
+		}
+	}
+}
+
+// gatherBatch adds queued events to batch until a limit is hit. Returns the
+// event that would have gone over wsBatchMaxBytes, if any, and whether the
+// channel was closed meanwhile.
+func gatherBatch(send <-chan hub.Outbound, batch []hub.Outbound) ([]hub.Outbound, *hub.Outbound, bool) {
+	size := len(batch[0].Data)
+	timer := time.NewTimer(wsBatchMaxDelay)
+	defer timer.Stop()
 
-			if err := w.Close(); err != nil {
-				return
+	for len(batch) < wsBatchMaxEvents {
+		select {
+		case message, ok := <-send:
+			if !ok {
+				return batch, nil, true
 			}
+			if size+len(message.Data) > wsBatchMaxBytes {
+				return batch, &message, false
+			}
+			batch = append(batch, message)
+			size += len(message.Data)
+		case <-timer.C:
+			return batch, nil, false
+		}
+	}
+	return batch, nil, false
+}
 
-		case <-ticker.C:
-			client.Conn.SetWriteDeadline(time.Now().Add(writeWait))
-			if err := client.Conn.WriteMessage(websocket.PingMessage, nil); err != nil {
-				return
+// writeFrame writes one websocket frame holding batch in the client's framing.
+func writeFrame(client *hub.Client, batch []hub.Outbound) error {
+	w, err := client.Conn.NextWriter(client.FrameType())
+	if err != nil {
+		return err
+	}
+	switch client.Framing {
+	case codec.FrameArray:
+		items := make([][]byte, len(batch))
+		for i, message := range batch {
+			items[i] = message.Data
+		}
+		w.Write(client.Array(items))
+	default:
+		// single: batch is one event; ndjson: one per line
+		for i, message := range batch {
+			if i > 0 {
+				w.Write([]byte{'\n'})
 			}
+			w.Write(message.Data)
 		}
 	}
+	return w.Close()
 }
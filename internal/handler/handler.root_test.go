@@ -0,0 +1,167 @@
+package handler
+
+import (
+	"butter-time/internal/codec"
+	"butter-time/internal/hub"
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// framesFor queues events for a client using c and framing, runs writePump
+// against a real connection and returns the frames the peer received.
+func framesFor(t *testing.T, c codec.Codec, framing string, events int) [][]byte {
+	t.Helper()
+	send := make(chan hub.Outbound, events)
+	for i := 0; i < events; i++ {
+		data, err := c.Marshal(map[string]any{"n": i})
+		if err != nil {
+			t.Fatal(err)
+		}
+		send <- hub.Outbound{Data: data}
+	}
+	close(send)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		writePump(&hub.Client{Conn: conn, Send: send, Codec: c, Framing: framing})
+	}))
+	defer srv.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	var frames [][]byte
+	for {
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		kind, data, err := conn.ReadMessage()
+		if err != nil {
+			if !websocket.IsCloseError(err, websocket.CloseNoStatusReceived, websocket.CloseNormalClosure) {
+				t.Fatal(err)
+			}
+			return frames
+		}
+		if kind != c.FrameType() {
+			t.Fatalf("frame type %d, want %d", kind, c.FrameType())
+		}
+		frames = append(frames, data)
+	}
+}
+
+// eventsPerFrame decodes each frame back into its events and counts them,
+// checking they arrive in order.
+func eventsPerFrame(t *testing.T, c codec.Codec, framing string, frames [][]byte) []int {
+	t.Helper()
+	var counts []int
+	next := 0
+	check := func(event any) {
+		m, _ := event.(map[string]any)
+		if n, _ := m["n"].(float64); int(n) != next {
+			t.Fatalf("event %v out of order, want n=%d", event, next)
+		}
+		next++
+	}
+	for _, frame := range frames {
+		var events []any
+		switch framing {
+		case codec.FrameArray:
+			if err := c.Unmarshal(frame, &events); err != nil {
+				t.Fatal(err)
+			}
+		case codec.FrameLines:
+			for _, line := range bytes.Split(frame, []byte{'\n'}) {
+				var event any
+				if err := c.Unmarshal(line, &event); err != nil {
+					t.Fatal(err)
+				}
+				events = append(events, event)
+			}
+		default:
+			var event any
+			if err := c.Unmarshal(frame, &event); err != nil {
+				t.Fatal(err)
+			}
+			events = []any{event}
+		}
+		for _, event := range events {
+			check(event)
+		}
+		counts = append(counts, len(events))
+	}
+	return counts
+}
+
+func TestWritePumpBatching(t *testing.T) {
+	defer func(events, size int) { wsBatchMaxEvents, wsBatchMaxBytes = events, size }(wsBatchMaxEvents, wsBatchMaxBytes)
+
+	// {"n":0} is 7 bytes in JSON
+	cases := []struct {
+		name      string
+		codec     codec.Codec
+		framing   string
+		maxEvents int
+		maxBytes  int
+		want      []int
+	}{
+		{"single never batches", codec.JSON, codec.FrameSingle, 3, 1 << 16, []int{1, 1, 1, 1, 1, 1, 1}},
+		{"single msgpack", codec.MsgPack, codec.FrameSingle, 3, 1 << 16, []int{1, 1, 1, 1, 1, 1, 1}},
+		{"array split on count", codec.JSON, codec.FrameArray, 3, 1 << 16, []int{3, 3, 1}},
+		{"array msgpack split on count", codec.MsgPack, codec.FrameArray, 3, 1 << 16, []int{3, 3, 1}},
+		{"array split on bytes", codec.JSON, codec.FrameArray, 50, 15, []int{2, 2, 2, 1}},
+		{"ndjson split on count", codec.JSON, codec.FrameLines, 3, 1 << 16, []int{3, 3, 1}},
+		{"ndjson split on bytes", codec.JSON, codec.FrameLines, 50, 15, []int{2, 2, 2, 1}},
+		{"oversized event still goes out alone", codec.JSON, codec.FrameArray, 50, 5, []int{1, 1, 1, 1, 1, 1, 1}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			wsBatchMaxEvents, wsBatchMaxBytes = c.maxEvents, c.maxBytes
+			frames := framesFor(t, c.codec, c.framing, 7)
+			if got := eventsPerFrame(t, c.codec, c.framing, frames); !reflect.DeepEqual(got, c.want) {
+				t.Errorf("events per frame = %v, want %v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestGatherBatchCarriesOverflow(t *testing.T) {
+	defer func(events, size int, delay time.Duration) {
+		wsBatchMaxEvents, wsBatchMaxBytes, wsBatchMaxDelay = events, size, delay
+	}(wsBatchMaxEvents, wsBatchMaxBytes, wsBatchMaxDelay)
+	wsBatchMaxEvents, wsBatchMaxBytes, wsBatchMaxDelay = 10, 10, 5*time.Millisecond
+
+	send := make(chan hub.Outbound, 3)
+	send <- hub.Outbound{Data: []byte("bbbb")}
+	send <- hub.Outbound{Data: []byte("cccc")}
+	send <- hub.Outbound{Data: []byte("dd")}
+
+	batch, carry, closed := gatherBatch(send, []hub.Outbound{{Data: []byte("aaaa")}})
+	if len(batch) != 2 || closed {
+		t.Fatalf("batch of %d, closed=%v; want 2 events, open", len(batch), closed)
+	}
+	if carry == nil || string(carry.Data) != "cccc" {
+		t.Fatalf("carry = %v, want the event that overflowed", carry)
+	}
+
+	// the carried event starts the next batch; the timer ends it
+	batch, carry, closed = gatherBatch(send, []hub.Outbound{*carry})
+	if len(batch) != 2 || carry != nil || closed {
+		t.Fatalf("second batch of %d, carry=%v, closed=%v", len(batch), carry, closed)
+	}
+
+	close(send)
+	if _, _, closed = gatherBatch(send, []hub.Outbound{{Data: []byte("e")}}); !closed {
+		t.Error("closed channel not reported")
+	}
+}
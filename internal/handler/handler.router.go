@@ -0,0 +1,147 @@
+package handler
+
+import (
+	"butter-time/internal/env"
+	"butter-time/internal/hub"
+	"butter-time/internal/model"
+	"bytes"
+	"encoding/json"
+	"log"
+	"slices"
+	"time"
+)
+
+// ── Event registry ────────────────────────────────────────────────────────────
+//
+// Every websocket event a client may send is registered once with its payload
+// type, the roles allowed to send it and its handler:
+//
+//	on("accept_chat", agentOnly, handleHumanAcceptTheChat)
+//
+// dispatchEvent does the rest: rate limits, unknown types, role checks,
+// decoding the payload into the handler's type and running its Validate() if
+// it has one. Handlers only ever see a payload that passed all of that, and
+// report failure by returning an error from the catalogue (fail(...)); the
+// client gets it back as an error event with its request_id.
+
+// payloadValidator is implemented by payloads with rules beyond their json shape.
+type payloadValidator interface {
+	Validate() error
+}
+
+type eventRoute struct {
+	roles  []string
+	handle func(client *hub.Client, raw json.RawMessage) error
+}
+
+var eventRoutes = make(map[string]eventRoute)
+
+var (
+	anyRole      = []string{hub.RoleCustomer, hub.RoleHumanAgent}
+	customerOnly = []string{hub.RoleCustomer}
+	agentOnly    = []string{hub.RoleHumanAgent}
+)
+
+// errBadPayload marks a payload that failed decoding or validation.
+type errBadPayload struct{ reason string }
+
+func (e errBadPayload) Error() string { return "invalid payload: " + e.reason }
+
+// on registers handler for eventType. P is the payload type; an absent or
+// null payload decodes to P's zero value.
+func on[P any](eventType string, roles []string, handler func(client *hub.Client, payload P) error) {
+	if _, dup := eventRoutes[eventType]; dup {
+		panic("event registered twice: " + eventType)
+	}
+	eventRoutes[eventType] = eventRoute{
+		roles: roles,
+		handle: func(client *hub.Client, raw json.RawMessage) error {
+			var payload P
+			if len(raw) > 0 && !bytes.Equal(raw, []byte("null")) {
+				if err := json.Unmarshal(raw, &payload); err != nil {
+					return errBadPayload{reason: err.Error()}
+				}
+			}
+			if v, ok := any(payload).(payloadValidator); ok {
+				if err := v.Validate(); err != nil {
+					return errBadPayload{reason: err.Error()}
+				}
+			}
+			return handler(client, payload)
+		},
+	}
+}
+
+// inboundMessage is model.WSMessage with the payload left raw, so it can be
+// decoded straight into the registered type. Whatever the client's wire
+// format, the raw payload is JSON (see codec).
+type inboundMessage struct {
+	Type      string          `json:"type"`
+	RequestId string          `json:"request_id"`
+	Payload   json.RawMessage `json:"payload"`
+}
+
+func dispatchEvent(client *hub.Client, limit *eventLimiter, message []byte) {
+	var in inboundMessage
+	if err := client.Decode(message, &in); err != nil {
+		sendError(client, "", fail(codeBadFormat))
+		return
+	}
+	if wait := limit.take(); wait > 0 {
+		sendError(client, in.RequestId, fail(codeRateLimited).with("retry_after_ms", wait.Milliseconds()))
+		return
+	}
+	route, ok := eventRoutes[in.Type]
+	if !ok {
+		sendError(client, in.RequestId, fail(codeUnknownEvent).with("type", in.Type))
+		return
+	}
+	if !slices.Contains(route.roles, client.Type) {
+		sendError(client, in.RequestId, fail(codeNotAllowed).with("type", in.Type))
+		return
+	}
+	if err := route.handle(client, in.Payload); err != nil {
+		log.Printf("event %s from %s rejected: %v", in.Type, client.Type, err)
+		sendError(client, in.RequestId, asEventError(err))
+		return
+	}
+	if in.RequestId != "" {
+		sendEnvelope(client, model.WSMessage{
+			Type:      "ack",
+			RequestId: in.RequestId,
+			Payload:   model.AckPayload{Type: in.Type},
+		}, nil)
+	}
+}
+
+// per-connection event budget: WS_EVENT_RATE a second, bursts of WS_EVENT_BURST
+var (
+	wsEventRate  = env.Int("WS_EVENT_RATE", 20)
+	wsEventBurst = env.Int("WS_EVENT_BURST", 40)
+)
+
+// eventLimiter is a token bucket for one connection. Only its readPump uses
+// it, so no locking.
+type eventLimiter struct {
+	tokens float64
+	last   time.Time
+}
+
+func newEventLimiter() *eventLimiter {
+	return &eventLimiter{tokens: float64(wsEventBurst), last: time.Now()}
+}
+
+// take spends a token, or returns how long until there is one.
+func (l *eventLimiter) take() time.Duration {
+	if l == nil {
+		return 0
+	}
+	now := time.Now()
+	l.tokens = min(float64(wsEventBurst), l.tokens+now.Sub(l.last).Seconds()*float64(wsEventRate))
+	l.last = now
+	if l.tokens < 1 {
+		return max(time.Millisecond, time.Duration((1-l.tokens)/float64(wsEventRate)*float64(time.Second)))
+	}
+	l.tokens--
+	return 0
+}
@@ -0,0 +1,123 @@
+package handler
+
+import (
+	"butter-time/internal/ingest"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// Maximum request body for knowledge base uploads
+	maxIngestBody = 10 << 20 // 10MB
+
+	// Time allowed to embed and store one request's documents
+	ingestTimeout = 2 * time.Minute
+)
+
+type ingestRequest struct {
+	Documents []ingest.Document `json:"documents"`
+}
+
+// IngestHandler accepts Markdown, HTML and plain-text documents for the
+// caller's company knowledge base.
+//
+//	POST /ingest  Authorization: Bearer <agent token>
+//	- application/json: {"documents":[{content, format, source_url, page_title, file_name, language}]}
+//	- multipart/form-data: one or more "file" parts, optional source_url/page_title/language/format fields
+func IngestHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, r, http.StatusMethodNotAllowed, "method not allowed", nil)
+		return
+	}
+
+	user, authErr := authenticateHumanAgent(bearerToken(r))
+	if authErr != nil {
+		writeJSON(w, r, authErr.httpStatus, authErr.msg, nil)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxIngestBody)
+	docs, err := readIngestDocuments(r)
+	if err != nil {
+		writeJSON(w, r, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+	if len(docs) == 0 {
+		writeJSON(w, r, http.StatusBadRequest, "no documents in request", nil)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), ingestTimeout)
+	defer cancel()
+
+	results := make([]ingest.Result, 0, len(docs))
+	for _, doc := range docs {
+		format, err := ingest.DetectFormat(doc.Format, doc.FileName, "", doc.Content)
+		if err != nil {
+			writeJSON(w, r, http.StatusBadRequest, err.Error(), results)
+			return
+		}
+		doc.Format = format
+
+		result, err := ingest.Ingest(ctx, user.CompanyID, doc)
+		if err != nil {
+			log.Printf("ingest failed for company %s: %v", user.CompanyID, err)
+			status := http.StatusBadGateway
+			if err == ingest.ErrEmptyDocument || err == ingest.ErrUnsupportedFormat {
+				status = http.StatusBadRequest
+			}
+			writeJSON(w, r, status, err.Error(), results)
+			return
+		}
+		log.Printf("ingested %d chunks for company %s (%s%s)", result.Chunks, user.CompanyID, result.SourceURL, result.FileName)
+		results = append(results, result)
+	}
+
+	writeJSON(w, r, http.StatusOK, "knowledge base updated", results)
+}
+
+func readIngestDocuments(r *http.Request) ([]ingest.Document, error) {
+	contentType := r.Header.Get("Content-Type")
+
+	if strings.HasPrefix(contentType, "multipart/form-data") {
+		if err := r.ParseMultipartForm(maxIngestBody); err != nil {
+			return nil, err
+		}
+		var docs []ingest.Document
+		for _, fh := range r.MultipartForm.File["file"] {
+			f, err := fh.Open()
+			if err != nil {
+				return nil, err
+			}
+			content, err := io.ReadAll(f)
+			f.Close()
+			if err != nil {
+				return nil, err
+			}
+			format, err := ingest.DetectFormat(r.FormValue("format"), fh.Filename, fh.Header.Get("Content-Type"), string(content))
+			if err != nil {
+				return nil, err
+			}
+			docs = append(docs, ingest.Document{
+				Content:   string(content),
+				Format:    format,
+				SourceURL: r.FormValue("source_url"),
+				PageTitle: r.FormValue("page_title"),
+				FileName:  fh.Filename,
+				Language:  r.FormValue("language"),
+			})
+		}
+		return docs, nil
+	}
+
+	var body ingestRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		return nil, err
+	}
+	return body.Documents, nil
+}
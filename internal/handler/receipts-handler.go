@@ -0,0 +1,33 @@
+package handler
+
+import (
+	"butter-time/internal/hub"
+	"butter-time/internal/model"
+)
+
+// markDelivered is the writePump hook for a message reaching a recipient device.
+func markDelivered(h *hub.Hub, msg model.MsgInOut) func() {
+	return func() { h.MarkDelivered(msg.ConversationId, msg.Id) }
+}
+
+// trigger name: read
+// -> the reader has seen everything up to message_id; the senders' devices
+// get message_status "read" and the reader's devices the new unread_count
+func handleRead(client *hub.Client, payload model.ReadPayload) error {
+	switch client.Type {
+	case hub.RoleCustomer:
+		agent := conversationAgent(client)
+		if agent == nil || agent.ConversationSeal == "" {
+			return nil // no conversation with an agent
+		}
+		// customers only have the one conversation
+		client.Hub.MarkRead(agent.ConversationSeal, hub.RoleCustomer, client.CustomerPass.Id, payload.MessageId)
+	case hub.RoleHumanAgent:
+		if payload.ConversationId == "" {
+			return fail(codeInvalidPayload, "conversation_id is required").with("field", "conversation_id")
+		}
+		// only messages addressed to this agent are affected
+		client.Hub.MarkRead(payload.ConversationId, hub.RoleHumanAgent, client.HumanAgentPass.Id, payload.MessageId)
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package handler
+
+import (
+	"butter-time/internal/hub"
+	"butter-time/internal/model"
+	"strings"
+)
+
+// checkRichContent applies who may send what: agents send chips, buttons and
+// cards, customers only answer them. A customer's postback must be one the
+// referenced message, the agent's or the assistant's, really offered; its
+// title becomes the text if the widget sent none.
+func checkRichContent(client *hub.Client, msg *model.MsgInOut) error {
+	if client.Type == hub.RoleHumanAgent {
+		msg.Postback = nil
+		return nil
+	}
+	if msg.IsRich() {
+		return fail(codeNotAllowed, "customers can't send quick replies, buttons or cards")
+	}
+	if msg.Postback == nil {
+		return nil
+	}
+	agent := conversationAgent(client)
+	offered, found := client.Hub.FindMessage(agent.Id, agent.ConversationSeal, msg.Postback.MessageId)
+	title, ok := offered.Offers(msg.Postback.Payload)
+	fromAgent := offered.SenderType == hub.RoleHumanAgent || offered.SenderType == hub.SenderAI
+	if !found || !fromAgent || !ok {
+		return fail(codeInvalidPostback).with("message_id", msg.Postback.MessageId)
+	}
+	if strings.TrimSpace(msg.Content) == "" {
+		msg.Content = title
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package handler
+
+import (
+	"butter-time/internal/hub"
+	"butter-time/internal/model"
+	"fmt"
+	"time"
+)
+
+// the ai "types" for as long as it streams; a stream that stalls longer
+// than this ends the indicator by itself
+const aiTypingTTL = 30 * time.Second
+
+// trigger name: typing_start / typing_stop
+// customer <-> assigned agent only. Live devices get it, offline ones never
+// do (no queueing); starts are throttled and expire in the hub.
+func handleTypingStart(client *hub.Client, payload model.TypingPayload) error {
+	return handleTyping(client, payload, true)
+}
+
+func handleTypingStop(client *hub.Client, payload model.TypingPayload) error {
+	return handleTyping(client, payload, false)
+}
+
+func handleTyping(client *hub.Client, payload model.TypingPayload, isTyping bool) error {
+	var key string
+	var out model.TypingPayload
+	var recipients func() []*hub.Client
+
+	switch client.Type {
+	case hub.RoleCustomer:
+		agent := conversationAgent(client)
+		if !client.FlagRevealed || agent == nil || agent.Id == "" {
+			return nil // nobody on the other side yet
+		}
+		key = "customer:" + client.CustomerPass.Id + ":" + agent.ConversationSeal
+		out = model.TypingPayload{
+			SenderId:       client.CustomerPass.Id,
+			SenderType:     hub.RoleCustomer,
+			ReceiverId:     agent.Id,
+			ConversationId: agent.ConversationSeal,
+		}
+		recipients = func() []*hub.Client { return client.Hub.GetHumanAgentById(agent.Id) }
+
+	case hub.RoleHumanAgent:
+		if payload.ReceiverId == "" {
+			return fail(codeInvalidPayload, "receiver_id is required").with("field", "receiver_id")
+		}
+		assigned, ok := client.Hub.AssignedAgent(payload.ReceiverId)
+		if !ok || assigned.Id != client.HumanAgentPass.Id {
+			if isTyping {
+				return fail(codeNotAllowed, "you're not allowed to text unless customer wants")
+			}
+			return nil
+		}
+		customerID := payload.ReceiverId
+		key = "agent:" + client.HumanAgentPass.Id + ":" + customerID
+		out = model.TypingPayload{
+			SenderId:       client.HumanAgentPass.Id,
+			SenderType:     hub.RoleHumanAgent,
+			ReceiverId:     customerID,
+			ConversationId: assigned.ConversationSeal,
+		}
+		recipients = func() []*hub.Client { return client.Hub.GetCustomerById(customerID) }
+
+	default:
+		return nil
+	}
+
+	client.Hub.Typing(key, isTyping, hub.TypingTTL, func(typing bool) {
+		event := "typing_stop"
+		if typing {
+			event = "typing_start"
+		}
+		out.Typing = typing
+		for _, device := range recipients() {
+			sendMessage(device, event, out)
+		}
+	})
+	return nil
+}
+
+// stopTyping ends the sender's indicator once their message is out.
+func stopTyping(client *hub.Client, receiverID string) {
+	handleTyping(client, model.TypingPayload{ReceiverId: receiverID}, false)
+}
+
+// aiTyping drives butter_typing_start / butter_typing_end for one agent
+// device through the same tracker: call it with true on every token (the
+// hub throttles) and false when the answer is done.
+func aiTyping(client *hub.Client, isTyping bool) {
+	key := fmt.Sprintf("butter:%p", client)
+	client.Hub.Typing(key, isTyping, aiTypingTTL, func(typing bool) {
+		if typing {
+			sendMessage(client, "butter_typing_start", nil)
+		} else {
+			sendMessage(client, "butter_typing_end", nil)
+		}
+	})
+}
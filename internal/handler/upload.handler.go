@@ -0,0 +1,254 @@
+package handler
+
+import (
+	"butter-time/internal/hub"
+	"butter-time/internal/model"
+	"butter-time/internal/storage"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// Time allowed to store one upload (and its thumbnail)
+	uploadTimeout = time.Minute
+	// multipart framing on top of the file itself
+	uploadOverhead = 1 << 20
+)
+
+// UploadHandler stores a chat attachment and returns it with a signed url.
+// Send the key in a message to share it:
+//
+//	POST /uploads              Authorization: Bearer <agent token>
+//	POST /uploads?as=customer  Authorization: Bearer <customer token>
+//	multipart/form-data, field "file"
+//
+//	-> {"key", "file_name", "mime_type", "size", "url", "thumbnail_url", "expires_at"}
+//	then {"type":"message","payload":{"content_type":"image","attachment":{"key":"..."},"content":"caption"}}
+func UploadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, r, http.StatusMethodNotAllowed, "method not allowed", nil)
+		return
+	}
+
+	companyID, ownerID, authErr := authenticateUploader(r)
+	if authErr != nil {
+		writeJSON(w, r, authErr.httpStatus, authErr.msg, nil)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, storage.MaxUploadBytes+uploadOverhead)
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		var tooBig *http.MaxBytesError
+		if errors.As(err, &tooBig) {
+			writeJSON(w, r, http.StatusRequestEntityTooLarge, storage.ErrTooLarge.Error(), nil)
+			return
+		}
+		writeJSON(w, r, http.StatusBadRequest, "multipart field \"file\" is required", nil)
+		return
+	}
+	defer file.Close()
+
+	data, err := storage.ReadLimited(file)
+	if err != nil {
+		var tooBig *http.MaxBytesError
+		if errors.Is(err, storage.ErrTooLarge) || errors.As(err, &tooBig) {
+			writeJSON(w, r, http.StatusRequestEntityTooLarge, storage.ErrTooLarge.Error(), nil)
+			return
+		}
+		writeJSON(w, r, http.StatusBadRequest, "could not read file", nil)
+		return
+	}
+	if len(data) == 0 {
+		writeJSON(w, r, http.StatusBadRequest, "file is empty", nil)
+		return
+	}
+
+	kind, mimeType, err := storage.Classify(data[:min(512, len(data))], header.Header.Get("Content-Type"))
+	if err != nil {
+		writeJSON(w, r, http.StatusUnsupportedMediaType, err.Error(), nil)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), uploadTimeout)
+	defer cancel()
+
+	fileName := filepath.Base(header.Filename)
+	obj := storage.Object{
+		Key:       storage.NewKey(companyID, storage.Extension(mimeType, fileName)),
+		FileName:  fileName,
+		MimeType:  mimeType,
+		Kind:      kind,
+		Owner:     ownerID,
+		CreatedAt: time.Now().UTC(),
+	}
+
+	if kind == "image" {
+		if thumb := storage.Thumbnail(data); thumb != nil {
+			thumbObj := storage.Object{
+				Key:       strings.TrimSuffix(obj.Key, filepath.Ext(obj.Key)) + "_thumb.jpg",
+				FileName:  "thumb_" + strings.TrimSuffix(fileName, filepath.Ext(fileName)) + ".jpg",
+				MimeType:  "image/jpeg",
+				Kind:      "image",
+				Owner:     ownerID,
+				CreatedAt: obj.CreatedAt,
+			}
+			if err := storage.Put(ctx, thumbObj, bytes.NewReader(thumb)); err != nil {
+				log.Println("thumbnail store error:", err)
+			} else {
+				obj.ThumbnailKey = thumbObj.Key
+			}
+		}
+	}
+
+	if err := storage.Put(ctx, obj, bytes.NewReader(data)); err != nil {
+		log.Println("upload store error:", err)
+		if obj.ThumbnailKey != "" {
+			// no orphan thumbnails; ctx may be what just ran out
+			if err := storage.Delete(context.WithoutCancel(ctx), obj.ThumbnailKey); err != nil {
+				log.Println("thumbnail cleanup error:", err)
+			}
+		}
+		writeJSON(w, r, http.StatusInternalServerError, "could not store file", nil)
+		return
+	}
+	obj.Size = int64(len(data))
+
+	writeJSON(w, r, http.StatusCreated, "uploaded", attachmentFor(obj))
+}
+
+// authenticateUploader returns the caller's company and id, agent by default.
+func authenticateUploader(r *http.Request) (string, string, *authError) {
+	if r.URL.Query().Get("as") == "customer" {
+		customer, authErr := authenticateCustomer(bearerToken(r))
+		if authErr != nil {
+			return "", "", authErr
+		}
+		return customer.Data.CompanyID, customer.Data.ID, nil
+	}
+	user, authErr := authenticateHumanAgent(bearerToken(r))
+	if authErr != nil {
+		return "", "", authErr
+	}
+	return user.CompanyID, user.UserID, nil
+}
+
+// attachmentFor describes a stored object with fresh signed urls.
+func attachmentFor(obj storage.Object) *model.Attachment {
+	url, expires := storage.SignURL(obj.Key, storage.DownloadURLTTL)
+	att := &model.Attachment{
+		Key:       obj.Key,
+		FileName:  obj.FileName,
+		MimeType:  obj.MimeType,
+		Size:      obj.Size,
+		Url:       url,
+		ExpiresAt: expires.Format(time.RFC3339),
+	}
+	if obj.ThumbnailKey != "" {
+		att.ThumbnailUrl, _ = storage.SignURL(obj.ThumbnailKey, storage.DownloadURLTTL)
+	}
+	return att
+}
+
+// resolveAttachment checks a media message's attachment belongs to the
+// sender's company and matches its content type, and fills in the file
+// details and signed urls. Other messages lose any attachment.
+func resolveAttachment(companyID string, msg *model.MsgInOut) error {
+	switch msg.ContentType {
+	case "image", "file", "audio":
+	case "":
+		msg.ContentType = "text"
+		fallthrough
+	default:
+		msg.Attachment = nil
+		return nil
+	}
+	if !storage.BelongsTo(msg.Attachment.Key, companyID) {
+		return errors.New("unknown attachment")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	obj, err := storage.Stat(ctx, msg.Attachment.Key)
+	if errors.Is(err, storage.ErrNotFound) {
+		return errors.New("unknown attachment")
+	}
+	if err != nil {
+		log.Println("attachment stat error:", err)
+		return errors.New("attachment unavailable")
+	}
+	// file takes anything; image and audio must be what they say
+	if msg.ContentType != "file" && obj.Kind != msg.ContentType {
+		return fmt.Errorf("attachment is %s, not %s", obj.Kind, msg.ContentType)
+	}
+	msg.Attachment = attachmentFor(obj)
+	return nil
+}
+
+// FileHandler serves uploads behind their signed urls.
+//
+//	GET /files/<key>?exp=<unix>&sig=<signature>
+func FileHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		writeJSON(w, r, http.StatusMethodNotAllowed, "method not allowed", nil)
+		return
+	}
+	key := strings.TrimPrefix(r.URL.Path, storage.DownloadPath)
+	q := r.URL.Query()
+	if err := storage.VerifyURL(key, q.Get("exp"), q.Get("sig")); err != nil {
+		status := http.StatusForbidden
+		if errors.Is(err, storage.ErrURLExpired) {
+			status = http.StatusGone
+		}
+		writeJSON(w, r, status, err.Error(), nil)
+		return
+	}
+
+	body, obj, err := storage.Open(r.Context(), key)
+	if errors.Is(err, storage.ErrNotFound) {
+		writeJSON(w, r, http.StatusNotFound, "not found", nil)
+		return
+	}
+	if err != nil {
+		log.Println("file open error:", err)
+		writeJSON(w, r, http.StatusInternalServerError, "could not read file", nil)
+		return
+	}
+	defer body.Close()
+
+	disposition := "attachment"
+	if obj.Kind == "image" || obj.Kind == "audio" {
+		disposition = "inline"
+	}
+	w.Header().Set("Content-Type", obj.MimeType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": obj.FileName}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "private, max-age=3600")
+
+	// local files can seek: ranges for audio scrubbing
+	if rs, ok := body.(io.ReadSeeker); ok {
+		http.ServeContent(w, r, "", obj.CreatedAt, rs)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	io.Copy(w, body)
+}
+
+// senderCompany is the company a websocket client belongs to.
+func senderCompany(client *hub.Client) string {
+	if client.Type == hub.RoleHumanAgent && client.HumanAgentPass != nil {
+		return client.HumanAgentPass.CompanyId
+	}
+	if client.CustomerPass != nil {
+		return client.CustomerPass.CompanyId
+	}
+	return ""
+}
@@ -0,0 +1,64 @@
+package handler
+
+import (
+	"butter-time/internal/llm"
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"os"
+	"strconv"
+)
+
+// shared secret for admin endpoints; unset = admin endpoints disabled
+var adminAPIKey = os.Getenv("ADMIN_API_KEY")
+
+// UsageHandler reports ai token usage and cost.
+//
+//	GET /admin/usage                     every company this month
+//	GET /admin/usage?company_id=<id>     one company, busiest conversations first (?conversations=N, default 20)
+//	X-Admin-Key: <ADMIN_API_KEY>
+func UsageHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, r, http.StatusMethodNotAllowed, "method not allowed", nil)
+		return
+	}
+	if !isAdmin(r) {
+		writeJSON(w, r, http.StatusUnauthorized, "admin key required", nil)
+		return
+	}
+
+	companyID := r.URL.Query().Get("company_id")
+	if companyID == "" {
+		writeJSON(w, r, http.StatusOK, "usage", llm.GetAllUsage())
+		return
+	}
+
+	conversations := 20
+	if n, err := strconv.Atoi(r.URL.Query().Get("conversations")); err == nil && n >= 0 {
+		conversations = n
+	}
+	writeJSON(w, r, http.StatusOK, "usage", llm.GetCompanyUsage(companyID, conversations))
+}
+
+// CacheStatsHandler reports the ai pipeline's cache hits and misses.
+//
+//	GET /stats/llm-cache
+//	X-Admin-Key: <ADMIN_API_KEY>
+func CacheStatsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, r, http.StatusMethodNotAllowed, "method not allowed", nil)
+		return
+	}
+	if !isAdmin(r) {
+		writeJSON(w, r, http.StatusUnauthorized, "admin key required", nil)
+		return
+	}
+	// the counters themselves, not wrapped in the usual envelope
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(llm.GetCacheStats())
+}
+
+func isAdmin(r *http.Request) bool {
+	key := r.Header.Get("X-Admin-Key")
+	return adminAPIKey != "" && subtle.ConstantTimeCompare([]byte(key), []byte(adminAPIKey)) == 1
+}
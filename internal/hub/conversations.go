@@ -0,0 +1,209 @@
+package hub
+
+import (
+	"butter-time/internal/model"
+	"errors"
+	"sort"
+)
+
+// ErrConversationNotFound: no pending or active conversation with that id.
+var ErrConversationNotFound = errors.New("conversation not found")
+
+// ErrConversationMismatch: the conversation belongs to another customer.
+var ErrConversationMismatch = errors.New("conversation belongs to another customer")
+
+// PendingChats lists a company's waiting conversations, oldest first.
+func (h *Hub) PendingChats(companyID string) []model.ConversationPayload {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	list := make([]model.ConversationPayload, 0, len(h.PendingChatQueue[companyID]))
+	for _, conv := range h.PendingChatQueue[companyID] {
+		list = append(list, conv)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].CreatedAt != list[j].CreatedAt {
+			return list[i].CreatedAt < list[j].CreatedAt
+		}
+		return list[i].Id < list[j].Id
+	})
+	return list
+}
+
+// ActiveChats lists the conversations an agent has accepted.
+func (h *Hub) ActiveChats(agentID string) []model.ConversationPayload {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	list := []model.ConversationPayload{}
+	for _, item := range h.ActiveChatQueue[agentID] {
+		if conv, ok := activeConversation(item); ok {
+			list = append(list, conv)
+		}
+	}
+	return list
+}
+
+// FindActiveChat finds an accepted conversation and the agent it's with.
+func (h *Hub) FindActiveChat(conversationID string) (string, model.ConversationPayload, bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for agentID, queue := range h.ActiveChatQueue {
+		for _, item := range queue {
+			if conv, ok := activeConversation(item); ok && conv.Id == conversationID {
+				return agentID, conv, true
+			}
+		}
+	}
+	return "", model.ConversationPayload{}, false
+}
+
+// FindPendingChat finds a waiting conversation and the company it's queued for.
+func (h *Hub) FindPendingChat(conversationID string) (string, model.ConversationPayload, bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for companyID, chats := range h.PendingChatQueue {
+		if conv, ok := chats[conversationID]; ok {
+			return companyID, conv, true
+		}
+	}
+	return "", model.ConversationPayload{}, false
+}
+
+// AcceptPendingChat moves a waiting conversation from the agent's company
+// queue to the agent's active chats and assigns the customer to them, all
+// under one lock: of two agents accepting at once exactly one succeeds, and
+// the other finds it active. ErrConversationNotFound when it isn't pending.
+func (h *Hub) AcceptPendingChat(agent *model.HumanAgentPass, conv model.ConversationPayload) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	chat, ok := h.PendingChatQueue[agent.CompanyId][conv.Id]
+	if !ok {
+		return ErrConversationNotFound
+	}
+	if chat.CustomerPass == nil || conv.CustomerPass == nil || chat.CustomerPass.Id != conv.CustomerPass.Id {
+		return ErrConversationMismatch
+	}
+	h.RemoveFromPendingUnsafe(agent.CompanyId, conv.Id)
+	h.ActiveChatQueue[agent.Id] = append(h.ActiveChatQueue[agent.Id], h.wsMessageCreator("accept_chat", conv))
+	h.AcceptedCustomers[conv.CustomerPass.Id] = &model.HumanAgentPass{
+		Id:               agent.Id,
+		CompanyId:        agent.CompanyId,
+		Departments:      agent.Departments,
+		ConversationSeal: conv.Id,
+	}
+	return nil
+}
+
+// OnlineAgent returns the pass of a connected agent of the company.
+func (h *Hub) OnlineAgent(companyID, agentID string) (*model.HumanAgentPass, bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for _, c := range h.humanAgents[agentID] {
+		if c.HumanAgentPass != nil && c.HumanAgentPass.CompanyId == companyID {
+			return &model.HumanAgentPass{
+				Id:          c.HumanAgentPass.Id,
+				CompanyId:   c.HumanAgentPass.CompanyId,
+				Departments: c.HumanAgentPass.Departments,
+			}, true
+		}
+	}
+	return nil, false
+}
+
+// ReassignChat hands an active conversation, with its messages and their
+// receipts, from one agent to another and points the customer at the new agent.
+func (h *Hub) ReassignChat(fromID string, to *model.HumanAgentPass, conversationID string) (model.ConversationPayload, error) {
+	// receipts before mu, the order MarkRead takes them in
+	h.receiptsMu.Lock()
+	defer h.receiptsMu.Unlock()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var conv model.ConversationPayload
+	found := false
+	kept := []any{}
+	for _, item := range h.ActiveChatQueue[fromID] {
+		if c, ok := activeConversation(item); ok && c.Id == conversationID && !found {
+			conv, found = c, true
+			continue
+		}
+		kept = append(kept, item)
+	}
+	if !found {
+		return model.ConversationPayload{}, ErrConversationNotFound
+	}
+	if len(kept) == 0 {
+		delete(h.ActiveChatQueue, fromID)
+	} else {
+		h.ActiveChatQueue[fromID] = kept
+	}
+
+	conv.AssignedTo = &model.AssignedTo{Id: to.Id}
+	h.ActiveChatQueue[to.Id] = append(h.ActiveChatQueue[to.Id], h.wsMessageCreator("accept_chat", conv))
+
+	// the history lives in the agent's queue: move this conversation's part
+	var moved []any
+	kept = []any{}
+	for _, item := range h.HumanAgentMessageQueue[fromID] {
+		if msg, ok := queuedMessage(item); ok && msg.ConversationId == conversationID {
+			moved = append(moved, item)
+			continue
+		}
+		kept = append(kept, item)
+	}
+	if len(kept) == 0 {
+		delete(h.HumanAgentMessageQueue, fromID)
+	} else {
+		h.HumanAgentMessageQueue[fromID] = kept
+	}
+	if len(moved) > 0 {
+		h.HumanAgentMessageQueue[to.Id] = append(h.HumanAgentMessageQueue[to.Id], moved...)
+	}
+
+	if conv.CustomerPass != nil {
+		h.AcceptedCustomers[conv.CustomerPass.Id] = &model.HumanAgentPass{
+			Id:               to.Id,
+			CompanyId:        to.CompanyId,
+			Departments:      to.Departments,
+			ConversationSeal: conversationID,
+		}
+	}
+
+	// unread messages to the old agent are now the new agent's to read
+	if receipts := h.receipts[conversationID]; receipts != nil {
+		for _, m := range receipts.messages {
+			if m.recipientID == fromID {
+				m.recipientID = to.Id
+			}
+		}
+	}
+	return conv, nil
+}
+
+func activeConversation(item any) (model.ConversationPayload, bool) {
+	wsMsg, ok := item.(model.WSMessage)
+	if !ok {
+		return model.ConversationPayload{}, false
+	}
+	conv, ok := wsMsg.Payload.(model.ConversationPayload)
+	return conv, ok
+}
+
+func queuedMessage(item any) (model.MsgInOut, bool) {
+	var wsMsg model.WSMessage
+	switch v := item.(type) {
+	case model.WSMessage:
+		wsMsg = v
+	case *model.WSMessage:
+		wsMsg = *v
+	default:
+		return model.MsgInOut{}, false
+	}
+	msg, ok := wsMsg.Payload.(model.MsgInOut)
+	return msg, ok
+}
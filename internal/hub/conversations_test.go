@@ -0,0 +1,61 @@
+package hub
+
+import (
+	"butter-time/internal/model"
+	"testing"
+)
+
+func TestReassignChatMovesReceipts(t *testing.T) {
+	const (
+		conversationID = "conv-1"
+		customerID     = "customer-1"
+		fromID         = "agent-old"
+		toID           = "agent-new"
+	)
+	h := NewHub()
+	h.ActiveChatQueue[fromID] = []any{h.wsMessageCreator("accept_chat", model.ConversationPayload{
+		Id:           conversationID,
+		CustomerPass: &model.CustomerPass{Id: customerID},
+	})}
+
+	first, _ := h.NewMessage(conversationID, RoleCustomer, customerID, fromID)
+	second, _ := h.NewMessage(conversationID, RoleCustomer, customerID, fromID)
+	reply, _ := h.NewMessage(conversationID, RoleHumanAgent, fromID, customerID)
+	h.MarkRead(conversationID, RoleHumanAgent, fromID, first)
+
+	if _, err := h.ReassignChat(fromID, &model.HumanAgentPass{Id: toID}, conversationID); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := h.UnreadCount(conversationID, fromID); n != 0 {
+		t.Errorf("old agent still has %d unread", n)
+	}
+	if n := h.UnreadCount(conversationID, toID); n != 1 {
+		t.Errorf("new agent has %d unread, want 1", n)
+	}
+	if n := h.UnreadCount(conversationID, customerID); n != 1 {
+		t.Errorf("customer has %d unread, want their reply still unread", n)
+	}
+
+	h.MarkRead(conversationID, RoleHumanAgent, toID, second)
+	if n := h.UnreadCount(conversationID, toID); n != 0 {
+		t.Errorf("new agent's read left %d unread", n)
+	}
+
+	h.MarkRead(conversationID, RoleCustomer, customerID, reply)
+	if n := h.UnreadCount(conversationID, customerID); n != 0 {
+		t.Errorf("customer's read left %d unread", n)
+	}
+}
+
+func TestReassignChatUnknownConversation(t *testing.T) {
+	h := NewHub()
+	h.NewMessage("conv-1", RoleCustomer, "customer-1", "agent-old")
+
+	if _, err := h.ReassignChat("agent-old", &model.HumanAgentPass{Id: "agent-new"}, "conv-1"); err != ErrConversationNotFound {
+		t.Fatalf("err = %v, want ErrConversationNotFound", err)
+	}
+	if n := h.UnreadCount("conv-1", "agent-old"); n != 1 {
+		t.Errorf("failed reassign moved receipts: old agent has %d unread", n)
+	}
+}
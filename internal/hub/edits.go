@@ -0,0 +1,149 @@
+package hub
+
+import (
+	"butter-time/internal/model"
+	"errors"
+	"sync"
+)
+
+// ── Message edits ─────────────────────────────────────────────────────────────
+//
+// A sent message can be edited or deleted by its sender. The change is applied
+// to the agent's queue (the transcript) and the customer's offline queue, and
+// what it said before is kept as a revision for supervisors. Unlike
+// receipts, revisions outlive the conversation.
+
+var ErrMessageNotFound = errors.New("message not found")
+
+const (
+	// revisions kept per conversation, and conversations kept overall
+	maxRevisionsPerConversation = 200
+	maxRevisionConversations    = 10000
+)
+
+type revisionLog struct {
+	mu    sync.Mutex
+	byID  map[string][]model.MessageRevision
+	order []string // conversation ids, oldest first
+}
+
+func newRevisionLog() *revisionLog {
+	return &revisionLog{byID: make(map[string][]model.MessageRevision)}
+}
+
+// UpdateMessage applies change to message messageID of the conversation in
+// agentID's queue and writes the result back to every queued copy, the
+// customer's included. Returns the updated message.
+func (h *Hub) UpdateMessage(agentID, conversationID string, messageID int64, change func(*model.MsgInOut) error) (model.MsgInOut, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	current, ok := findMessage(h.HumanAgentMessageQueue[agentID], conversationID, messageID)
+	if !ok {
+		return model.MsgInOut{}, ErrMessageNotFound
+	}
+	updated := current
+	if err := change(&updated); err != nil {
+		return model.MsgInOut{}, err
+	}
+
+	customerID := current.ReceiverId
+	if current.SenderType == RoleCustomer {
+		customerID = current.SenderId
+	}
+	if queue, ok := replaceMessage(h.HumanAgentMessageQueue[agentID], updated); ok {
+		h.HumanAgentMessageQueue[agentID] = queue
+	}
+	if queue, ok := replaceMessage(h.CustomerMessageQueue[customerID], updated); ok {
+		h.CustomerMessageQueue[customerID] = queue
+	}
+	return updated, nil
+}
+
+func findMessage(queue []any, conversationID string, messageID int64) (model.MsgInOut, bool) {
+	for _, item := range queue {
+		var wsMsg model.WSMessage
+		switch v := item.(type) {
+		case model.WSMessage:
+			wsMsg = v
+		case *model.WSMessage:
+			wsMsg = *v
+		default:
+			continue
+		}
+		if msg, ok := wsMsg.Payload.(model.MsgInOut); ok && msg.ConversationId == conversationID && msg.Id == messageID {
+			return msg, true
+		}
+	}
+	return model.MsgInOut{}, false
+}
+
+// replaceMessage returns a copy of queue with updated in place of the same
+// message, or false if the queue doesn't hold it. Nothing already queued is
+// written to: the broadcast loops read queues without h.mu, and agent and
+// customer queues share *WSMessage values.
+func replaceMessage(queue []any, updated model.MsgInOut) ([]any, bool) {
+	var replaced []any
+	for i, item := range queue {
+		var next any
+		switch v := item.(type) {
+		case model.WSMessage:
+			if sameMessage(v.Payload, updated) {
+				v.Payload = updated
+				next = v
+			}
+		case *model.WSMessage:
+			if sameMessage(v.Payload, updated) {
+				copied := *v
+				copied.Payload = updated
+				next = &copied
+			}
+		}
+		if next == nil {
+			continue
+		}
+		if replaced == nil {
+			replaced = make([]any, len(queue))
+			copy(replaced, queue)
+		}
+		replaced[i] = next
+	}
+	return replaced, replaced != nil
+}
+
+func sameMessage(payload any, updated model.MsgInOut) bool {
+	msg, ok := payload.(model.MsgInOut)
+	return ok && msg.ConversationId == updated.ConversationId && msg.Id == updated.Id
+}
+
+// RecordRevision keeps an edit or delete for the conversation's history.
+func (h *Hub) RecordRevision(rev model.MessageRevision) {
+	revisions := h.revisions
+	revisions.mu.Lock()
+	defer revisions.mu.Unlock()
+
+	history, exists := revisions.byID[rev.ConversationId]
+	if !exists {
+		revisions.order = append(revisions.order, rev.ConversationId)
+		if len(revisions.order) > maxRevisionConversations {
+			delete(revisions.byID, revisions.order[0])
+			revisions.order = revisions.order[1:]
+		}
+	}
+	history = append(history, rev)
+	if len(history) > maxRevisionsPerConversation {
+		history = history[len(history)-maxRevisionsPerConversation:]
+	}
+	revisions.byID[rev.ConversationId] = history
+}
+
+// MessageHistory returns a conversation's edits and deletes, oldest first.
+func (h *Hub) MessageHistory(conversationID string) []model.MessageRevision {
+	revisions := h.revisions
+	revisions.mu.Lock()
+	defer revisions.mu.Unlock()
+
+	history := make([]model.MessageRevision, len(revisions.byID[conversationID]))
+	copy(history, revisions.byID[conversationID])
+	return history
+}
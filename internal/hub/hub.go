@@ -1,6 +1,7 @@
 package hub
 
 import (
+	"butter-time/internal/codec"
 	"butter-time/internal/model"
 	"context"
 	"fmt"
@@ -9,11 +10,22 @@ import (
 	"github.com/gorilla/websocket"
 )
 
+// client types — also the roles events are allowed for
+const (
+	RoleCustomer   = "Customer"
+	RoleHumanAgent = "Human-Agent"
+)
+
+// SenderAI is the sender type of messages the assistant wrote.
+const SenderAI = "AI-AGENT"
+
 type Client struct {
 	Hub            *Hub
-	Type           string
-	Conn           *websocket.Conn
-	Send           chan []byte
+	Type           string          // RoleCustomer | RoleHumanAgent
+	Conn           *websocket.Conn // nil when the customer is on sse / long-poll
+	Send           chan Outbound
+	Codec          codec.Codec // wire format negotiated at upgrade; nil = JSON
+	Framing        string      // codec.FrameSingle | FrameArray | FrameLines; "" = single
 	CustomerPass   *model.CustomerPass
 	HumanAgentPass *model.HumanAgentPass
 	CancelAI       context.CancelFunc
@@ -21,6 +33,33 @@ type Client struct {
 	FlagRevealed   bool // -> when a human accepts connection
 }
 
+// Encode turns an event into a frame in the client's wire format.
+func (c *Client) Encode(v any) ([]byte, error) {
+	return c.codec().Marshal(v)
+}
+
+// Decode reads a frame from the client in its wire format.
+func (c *Client) Decode(data []byte, v any) error {
+	return c.codec().Unmarshal(data, v)
+}
+
+// Array joins encoded events into one array in the client's wire format.
+func (c *Client) Array(items [][]byte) []byte {
+	return c.codec().Array(items)
+}
+
+// FrameType is the websocket message type the client's frames go out as.
+func (c *Client) FrameType() int {
+	return c.codec().FrameType()
+}
+
+func (c *Client) codec() codec.Codec {
+	if c.Codec == nil {
+		return codec.JSON
+	}
+	return c.Codec
+}
+
 type Hub struct {
 	customers   map[string][]*Client
 	humanAgents map[string][]*Client
@@ -50,6 +89,13 @@ type Hub struct {
 	SosStatus map[string]bool
 	//customer connection accept flag
 	AcceptedCustomers map[string]*model.HumanAgentPass
+	//typing indicators (live only, never queued)
+	typing *typingTracker
+	//message ids and sent/delivered/read per conversation
+	receipts   map[string]*conversationReceipts
+	receiptsMu sync.Mutex
+	//edit/delete history for supervisors
+	revisions *revisionLog
 	//thread safety
 	mu sync.RWMutex
 }
@@ -73,6 +119,9 @@ func NewHub() *Hub {
 		CustomerEventQueue:     make(map[string][]any),
 		SosStatus:              make(map[string]bool),                  //---------------//sos status
 		AcceptedCustomers:      make(map[string]*model.HumanAgentPass), //accespted by human agents
+		typing:                 newTypingTracker(),
+		receipts:               make(map[string]*conversationReceipts),
+		revisions:              newRevisionLog(),
 	}
 }
 
@@ -81,7 +130,7 @@ func (h *Hub) Run() {
 		select {
 		case client := <-h.register:
 			h.mu.Lock()
-			if client.Type == "Human-Agent" {
+			if client.Type == RoleHumanAgent {
 				h.humanAgents[client.HumanAgentPass.Id] = append(h.humanAgents[client.HumanAgentPass.Id], client)
 				h.registerAgent(client.HumanAgentPass)
 				fmt.Println("company id for agent: ", client.HumanAgentPass.CompanyId)
@@ -106,7 +155,7 @@ func (h *Hub) Run() {
 		case client := <-h.unregister:
 			h.mu.Lock()
 			fmt.Println("unregister : ", client.Type)
-			if client.Type == "Human-Agent" {
+			if client.Type == RoleHumanAgent {
 				agentID := client.HumanAgentPass.Id
 				if list, ok := h.humanAgents[agentID]; ok {
 					for i, c := range list {
@@ -122,7 +171,7 @@ func (h *Hub) Run() {
 						h.humanAgents[agentID] = list
 					}
 				}
-			} else if client.Type == "Customer" {
+			} else if client.Type == RoleCustomer {
 				customerID := client.CustomerPass.Id
 				fmt.Println("unregister : ", customerID)
 				fmt.Println(len(h.customers[customerID]))
@@ -143,7 +192,9 @@ func (h *Hub) Run() {
 				}
 				h.RemoveFromPendingUnsafe(client.CustomerPass.CompanyId, customerID)
 			}
-			client.Conn.Close()
+			if client.Conn != nil { // nil for the http fallback transports
+				client.Conn.Close()
+			}
 			go h.printStats()
 			h.mu.Unlock()
 		}
@@ -358,6 +409,16 @@ func (h *Hub) MarkCustomerAccepted(customerID string, agent *model.HumanAgentPas
 
 	h.AcceptedCustomers[customerID] = agent
 }
+
+// AssignedAgent returns the agent pass a customer's chat was accepted with.
+func (h *Hub) AssignedAgent(customerID string) (*model.HumanAgentPass, bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	agent, ok := h.AcceptedCustomers[customerID]
+	return agent, ok && agent != nil
+}
+
 func (h *Hub) UnMarkCustomerAccepted(customerID string) {
 	h.mu.Lock()
 	defer h.mu.Unlock()
@@ -538,3 +599,39 @@ func (h *Hub) RemoveMessageFromHumanAgentQueue(agentID string, customerID string
 
 	return nil
 }
+
+// ConversationMessages returns the last `limit` messages of a conversation
+// from the agent's message queue, oldest first.
+func (h *Hub) ConversationMessages(agentID string, conversationID string, limit int) []model.MsgInOut {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	var messages []model.MsgInOut
+	for _, item := range h.HumanAgentMessageQueue[agentID] {
+		var wsMsg model.WSMessage
+		switch v := item.(type) {
+		case model.WSMessage:
+			wsMsg = v
+		case *model.WSMessage:
+			wsMsg = *v
+		default:
+			continue
+		}
+		if msgData, ok := wsMsg.Payload.(model.MsgInOut); ok && msgData.ConversationId == conversationID {
+			messages = append(messages, msgData)
+		}
+	}
+
+	if limit > 0 && len(messages) > limit {
+		messages = messages[len(messages)-limit:]
+	}
+	return messages
+}
+
+// FindMessage looks a message up by id in the agent's queue.
+func (h *Hub) FindMessage(agentID string, conversationID string, messageID int64) (model.MsgInOut, bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	return findMessage(h.HumanAgentMessageQueue[agentID], conversationID, messageID)
+}
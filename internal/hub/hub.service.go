@@ -1,7 +1,6 @@
 package hub
 
 import (
-	"encoding/json"
 	"fmt"
 )
 
@@ -24,20 +23,19 @@ func (h *Hub) CustomerMessageQueueBroadcast(customerID string) {
 	}
 
 	for _, msg := range queue {
-		queueBytes, err := json.Marshal(msg)
-		if err != nil {
-			fmt.Println("Error marshaling customer message queue:", err)
-			return
-		}
-
 		devices, ok := h.customers[customerID]
 		if !ok || len(devices) == 0 {
 			return
 		}
 
 		for _, customer := range devices {
+			queueBytes, err := customer.Encode(msg)
+			if err != nil {
+				fmt.Println("Error marshaling customer message queue:", err)
+				return
+			}
 			select {
-			case customer.Send <- queueBytes:
+			case customer.Send <- Outbound{Data: queueBytes, OnDelivered: h.deliveryFor(msg, customerID)}:
 			default:
 				fmt.Println("Customer send channel full, skipping device")
 			}
@@ -55,20 +53,19 @@ func (h *Hub) BroadcastCustomerEventQueue(customerID string) {
 	}
 
 	for _, item := range queue {
-		queueBytes, err := json.Marshal(item)
-		if err != nil {
-			fmt.Println("Error marshaling customer event queue:", err)
-			return
-		}
-
 		devices, ok := h.customers[customerID]
 		if !ok || len(devices) == 0 {
 			return
 		}
 
 		for _, customer := range devices {
+			queueBytes, err := customer.Encode(item)
+			if err != nil {
+				fmt.Println("Error marshaling customer event queue:", err)
+				return
+			}
 			select {
-			case customer.Send <- queueBytes:
+			case customer.Send <- Outbound{Data: queueBytes}:
 			default:
 				fmt.Println("Customer send channel full, skipping device")
 			}
@@ -87,13 +84,13 @@ func (h *Hub) BroadcastPendingQueue(companyID string, client *Client) {
 
 	for _, conversation := range queue {
 		wsMsg := h.wsMessageCreator("transfer_chat", conversation)
-		msgBytes, err := json.Marshal(wsMsg)
+		msgBytes, err := client.Encode(wsMsg)
 		if err != nil {
 			fmt.Println("Error marshaling pending queue:", err)
 			continue
 		}
 		select {
-		case client.Send <- msgBytes:
+		case client.Send <- Outbound{Data: msgBytes}:
 		default:
 			fmt.Println("Agent send channel is full")
 		}
@@ -109,20 +106,19 @@ func (h *Hub) BroadcastActiveChat(agentID string) {
 		return
 	}
 	for _, item := range queue {
-		queueBytes, err := json.Marshal(item)
-		if err != nil {
-			fmt.Println("Error marshaling active chat queue:", err)
-			return
-		}
-
 		devices, ok := h.humanAgents[agentID]
 		if !ok {
 			return
 		}
 
 		for _, device := range devices {
+			queueBytes, err := device.Encode(item)
+			if err != nil {
+				fmt.Println("Error marshaling active chat queue:", err)
+				return
+			}
 			select {
-			case device.Send <- queueBytes:
+			case device.Send <- Outbound{Data: queueBytes}:
 			default:
 				fmt.Println("Agent send channel full, skipping device")
 			}
@@ -140,20 +136,19 @@ func (h *Hub) BroadcastHumanAgentMessages(agentID string) {
 	}
 
 	for _, msg := range queue {
-		queueBytes, err := json.Marshal(msg)
-		if err != nil {
-			fmt.Println("Error marshaling human agent queue:", err)
-			return
-		}
-
 		devices, ok := h.humanAgents[agentID]
 		if !ok {
 			return
 		}
 
 		for _, device := range devices {
+			queueBytes, err := device.Encode(msg)
+			if err != nil {
+				fmt.Println("Error marshaling human agent queue:", err)
+				return
+			}
 			select {
-			case device.Send <- queueBytes:
+			case device.Send <- Outbound{Data: queueBytes, OnDelivered: h.deliveryFor(msg, agentID)}:
 			default:
 				fmt.Println("Agent send channel full, skipping device")
 			}
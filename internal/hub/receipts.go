@@ -0,0 +1,252 @@
+package hub
+
+import (
+	"butter-time/internal/model"
+	"fmt"
+	"time"
+)
+
+// ── Message receipts ──────────────────────────────────────────────────────────
+//
+// Every customer <-> agent message gets an id, increasing within its
+// conversation, and moves sent -> delivered -> read:
+//   - sent: the server accepted it (NewMessage)
+//   - delivered: a recipient device's writePump flushed it (MarkDelivered)
+//   - read: the recipient sent a `read` event with the highest id it has seen
+//     (MarkRead), which covers every earlier message too
+//
+// Changes go to the sender's devices as message_status; the recipient's
+// devices get unread_count for the conversation.
+
+const (
+	StatusSent      = "sent"
+	StatusDelivered = "delivered"
+	StatusRead      = "read"
+)
+
+// tracked messages kept per conversation; older ones count as read
+const maxTrackedMessages = 1000
+
+// Outbound is one frame for a device. OnDelivered, if set, runs once the
+// device's writePump has flushed it to the socket.
+type Outbound struct {
+	Data        []byte
+	OnDelivered func()
+}
+
+type trackedMessage struct {
+	id          int64
+	senderType  string
+	senderID    string
+	recipientID string
+	status      string
+	sentAt      time.Time
+}
+
+type conversationReceipts struct {
+	lastID   int64
+	messages []*trackedMessage
+}
+
+// NewMessage registers a message and returns its id and status (sent).
+func (h *Hub) NewMessage(conversationID, senderType, senderID, recipientID string) (int64, string) {
+	h.receiptsMu.Lock()
+	defer h.receiptsMu.Unlock()
+
+	conv := h.receipts[conversationID]
+	if conv == nil {
+		conv = &conversationReceipts{}
+		h.receipts[conversationID] = conv
+	}
+	conv.lastID++
+	conv.messages = append(conv.messages, &trackedMessage{
+		id:          conv.lastID,
+		senderType:  senderType,
+		senderID:    senderID,
+		recipientID: recipientID,
+		status:      StatusSent,
+		sentAt:      time.Now(),
+	})
+	if len(conv.messages) > maxTrackedMessages {
+		conv.messages = conv.messages[len(conv.messages)-maxTrackedMessages:]
+	}
+	return conv.lastID, StatusSent
+}
+
+// MarkDelivered moves a sent message to delivered. Safe to call repeatedly
+// (every device, every replay).
+func (h *Hub) MarkDelivered(conversationID string, messageID int64) {
+	h.receiptsMu.Lock()
+	defer h.receiptsMu.Unlock()
+
+	conv := h.receipts[conversationID]
+	if conv == nil {
+		return
+	}
+	for _, m := range conv.messages {
+		if m.id == messageID && m.status == StatusSent {
+			m.status = StatusDelivered
+			h.notifyStatus(m.senderType, m.senderID, model.MessageStatusPayload{
+				ConversationId: conversationID,
+				MessageIds:     []int64{m.id},
+				Status:         StatusDelivered,
+			})
+			return
+		}
+	}
+}
+
+// MarkRead marks every message to readerID up to and including upTo as read.
+func (h *Hub) MarkRead(conversationID, readerType, readerID string, upTo int64) {
+	h.receiptsMu.Lock()
+	defer h.receiptsMu.Unlock()
+
+	conv := h.receipts[conversationID]
+	if conv == nil {
+		return
+	}
+	// one status event per sender, listing what they can now tick
+	type sender struct{ typ, id string }
+	changed := make(map[sender][]int64)
+	var order []sender
+	for _, m := range conv.messages {
+		if m.id > upTo || m.recipientID != readerID || m.status == StatusRead {
+			continue
+		}
+		m.status = StatusRead
+		s := sender{m.senderType, m.senderID}
+		if _, seen := changed[s]; !seen {
+			order = append(order, s)
+		}
+		changed[s] = append(changed[s], m.id)
+	}
+	if len(order) == 0 {
+		return
+	}
+	for _, s := range order {
+		h.notifyStatus(s.typ, s.id, model.MessageStatusPayload{
+			ConversationId: conversationID,
+			MessageIds:     changed[s],
+			Status:         StatusRead,
+		})
+	}
+	h.notifyUnread(conversationID, readerType, readerID, conv.unread(readerID))
+}
+
+// NotifyUnread sends readerID's devices their unread count for the
+// conversation, e.g. after a new message reached them.
+func (h *Hub) NotifyUnread(conversationID, readerType, readerID string) {
+	h.receiptsMu.Lock()
+	defer h.receiptsMu.Unlock()
+
+	conv := h.receipts[conversationID]
+	if conv == nil {
+		return
+	}
+	h.notifyUnread(conversationID, readerType, readerID, conv.unread(readerID))
+}
+
+// UnreadCount is how many messages in the conversation readerID hasn't read.
+func (h *Hub) UnreadCount(conversationID, readerID string) int {
+	h.receiptsMu.Lock()
+	defer h.receiptsMu.Unlock()
+
+	conv := h.receipts[conversationID]
+	if conv == nil {
+		return 0
+	}
+	return conv.unread(readerID)
+}
+
+// MessageSentAt is when a tracked message was sent; false once it's no
+// longer tracked (too old, or the conversation ended).
+func (h *Hub) MessageSentAt(conversationID string, messageID int64) (time.Time, bool) {
+	h.receiptsMu.Lock()
+	defer h.receiptsMu.Unlock()
+
+	conv := h.receipts[conversationID]
+	if conv == nil {
+		return time.Time{}, false
+	}
+	for _, m := range conv.messages {
+		if m.id == messageID {
+			return m.sentAt, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// ForgetReceipts drops a finished conversation.
+func (h *Hub) ForgetReceipts(conversationID string) {
+	h.receiptsMu.Lock()
+	defer h.receiptsMu.Unlock()
+
+	delete(h.receipts, conversationID)
+}
+
+func (c *conversationReceipts) unread(readerID string) int {
+	n := 0
+	for _, m := range c.messages {
+		if m.recipientID == readerID && m.status != StatusRead {
+			n++
+		}
+	}
+	return n
+}
+
+// deliveryFor is the OnDelivered hook for a queued message being replayed to
+// recipientID's devices; nil when it isn't a tracked message to them.
+func (h *Hub) deliveryFor(item any, recipientID string) func() {
+	var wsMsg model.WSMessage
+	switch v := item.(type) {
+	case model.WSMessage:
+		wsMsg = v
+	case *model.WSMessage:
+		wsMsg = *v
+	default:
+		return nil
+	}
+	msg, ok := wsMsg.Payload.(model.MsgInOut)
+	if !ok || msg.Id == 0 || msg.ReceiverId != recipientID {
+		return nil
+	}
+	return func() { h.MarkDelivered(msg.ConversationId, msg.Id) }
+}
+
+func (h *Hub) notifyStatus(senderType, senderID string, payload model.MessageStatusPayload) {
+	h.sendToLive(senderType, senderID, "message_status", payload)
+}
+
+func (h *Hub) notifyUnread(conversationID, readerType, readerID string, unread int) {
+	h.sendToLive(readerType, readerID, "unread_count", model.UnreadCountPayload{
+		ConversationId: conversationID,
+		Unread:         unread,
+	})
+}
+
+// sendToLive sends to the online devices of a customer or agent; nothing is
+// queued for offline ones.
+func (h *Hub) sendToLive(role, id, msgType string, payload any) {
+	wsMsg := h.wsMessageCreator(msgType, payload)
+
+	h.mu.RLock()
+	var devices []*Client
+	if role == RoleHumanAgent {
+		devices = h.humanAgents[id]
+	} else {
+		devices = h.customers[id]
+	}
+	for _, device := range devices {
+		msgBytes, err := device.Encode(wsMsg)
+		if err != nil {
+			fmt.Println("Error marshaling", msgType, ":", err)
+			break
+		}
+		select {
+		case device.Send <- Outbound{Data: msgBytes}:
+		default:
+			fmt.Println("send channel full, skipping device")
+		}
+	}
+	h.mu.RUnlock()
+}
@@ -0,0 +1,89 @@
+package hub
+
+import (
+	"sync"
+	"time"
+)
+
+// typing indicators are live-only: nothing here is ever queued for a
+// recipient who is offline, and a start that isn't refreshed expires.
+const (
+	// a device that stops sending typing_start is considered stopped after this
+	TypingTTL = 6 * time.Second
+	// repeated starts are forwarded at most this often (they only refresh expiry)
+	TypingThrottle = 2 * time.Second
+)
+
+type typingState struct {
+	gen      int // bumped on every refresh, so a stale expiry is ignored
+	lastSent time.Time
+	expiry   *time.Timer
+	notify   func(typing bool)
+}
+
+// typingTracker keeps one state per sender/conversation key.
+type typingTracker struct {
+	mu     sync.Mutex
+	states map[string]*typingState
+}
+
+func newTypingTracker() *typingTracker {
+	return &typingTracker{states: make(map[string]*typingState)}
+}
+
+// Typing records that key (e.g. "customer:<id>:<conversation>") started or
+// stopped typing and calls notify when the recipients should hear about it:
+// on the first start, at most every TypingThrottle while it keeps going, and
+// once on stop — explicit or when ttl passes without a refresh. notify must
+// only deliver to online devices; it runs under the tracker's lock so starts
+// and stops reach recipients in order, and must not block.
+func (h *Hub) Typing(key string, isTyping bool, ttl time.Duration, notify func(typing bool)) {
+	t := h.typing
+	t.mu.Lock()
+	state := t.states[key]
+
+	if !isTyping {
+		if state == nil {
+			t.mu.Unlock()
+			return // already stopped
+		}
+		state.expiry.Stop()
+		delete(t.states, key)
+		notify(false)
+		t.mu.Unlock()
+		return
+	}
+
+	send := false
+	if state == nil {
+		state = &typingState{}
+		t.states[key] = state
+		send = true
+	} else {
+		state.expiry.Stop()
+		send = time.Since(state.lastSent) >= TypingThrottle
+	}
+	if send {
+		state.lastSent = time.Now()
+	}
+	state.gen++
+	gen := state.gen
+	state.notify = notify
+	state.expiry = time.AfterFunc(ttl, func() { t.expire(key, state, gen) })
+	if send {
+		notify(true)
+	}
+	t.mu.Unlock()
+}
+
+// expire ends a start that was never refreshed or stopped.
+func (t *typingTracker) expire(key string, state *typingState, gen int) {
+	t.mu.Lock()
+	if t.states[key] != state || state.gen != gen {
+		t.mu.Unlock()
+		return // restarted or stopped meanwhile
+	}
+	delete(t.states, key)
+	state.notify(false)
+	t.mu.Unlock()
+}
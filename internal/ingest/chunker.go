@@ -0,0 +1,92 @@
+package ingest
+
+import (
+	"strings"
+)
+
+const (
+	maxChunkChars = 1200 // roughly 300 tokens
+	minChunkChars = 40   // fragments shorter than this are merged or dropped
+)
+
+type chunk struct {
+	sectionPath string
+	text        string
+}
+
+// chunkSections keeps each heading's text together when it fits and splits
+// long sections on paragraph, then sentence, boundaries. The heading trail is
+// prefixed to the chunk text so both retrievers see it.
+func chunkSections(sections []section) []chunk {
+	var chunks []chunk
+	for _, s := range sections {
+		path := strings.Join(s.path, " > ")
+		for _, piece := range splitText(s.text, maxChunkChars) {
+			if len(strings.TrimSpace(piece)) < minChunkChars && len(chunks) > 0 && chunks[len(chunks)-1].sectionPath == path {
+				last := &chunks[len(chunks)-1]
+				last.text += "\n\n" + piece
+				continue
+			}
+			text := piece
+			if path != "" {
+				text = s.path[len(s.path)-1] + "\n" + piece
+			}
+			chunks = append(chunks, chunk{sectionPath: path, text: text})
+		}
+	}
+	return chunks
+}
+
+func splitText(text string, limit int) []string {
+	if len(text) <= limit {
+		return []string{text}
+	}
+
+	var pieces []string
+	var current strings.Builder
+	flush := func() {
+		if s := strings.TrimSpace(current.String()); s != "" {
+			pieces = append(pieces, s)
+		}
+		current.Reset()
+	}
+
+	for _, para := range strings.Split(text, "\n\n") {
+		units := []string{para}
+		if len(para) > limit {
+			units = splitSentences(para, limit)
+		}
+		for _, u := range units {
+			if current.Len() > 0 && current.Len()+len(u)+2 > limit {
+				flush()
+			}
+			if current.Len() > 0 {
+				current.WriteString("\n\n")
+			}
+			current.WriteString(u)
+		}
+	}
+	flush()
+	return pieces
+}
+
+// splitSentences breaks on sentence enders (including the Bengali dari '।')
+// and hard-wraps anything still over the limit.
+func splitSentences(text string, limit int) []string {
+	var out []string
+	var current strings.Builder
+	for _, r := range text {
+		current.WriteRune(r)
+		if (r == '.' || r == '?' || r == '!' || r == '।') && current.Len() >= limit/2 {
+			out = append(out, strings.TrimSpace(current.String()))
+			current.Reset()
+		} else if current.Len() >= limit {
+			out = append(out, strings.TrimSpace(current.String()))
+			current.Reset()
+		}
+	}
+	if s := strings.TrimSpace(current.String()); s != "" {
+		out = append(out, s)
+	}
+	return out
+}
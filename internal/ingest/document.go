@@ -0,0 +1,113 @@
+package ingest
+
+import (
+	"butter-time/internal/llm"
+	"errors"
+	"net/url"
+	"path/filepath"
+	"strings"
+)
+
+// supported document formats
+const (
+	FormatMarkdown = "markdown"
+	FormatHTML     = "html"
+	FormatText     = "text"
+)
+
+var ErrEmptyDocument = errors.New("document has no text content")
+var ErrUnsupportedFormat = errors.New("unsupported document format (markdown, html or text)")
+
+// Document is one upload: a web page, a file or a pasted text.
+type Document struct {
+	Content   string `json:"content"`
+	Format    string `json:"format"` // markdown | html | text (detected when empty)
+	SourceURL string `json:"source_url"`
+	PageTitle string `json:"page_title"`
+	FileName  string `json:"file_name"`
+	Language  string `json:"language"` // detected when empty
+}
+
+// sourceType matches the values the python ingester wrote.
+func (d Document) sourceType() string {
+	switch {
+	case d.SourceURL != "":
+		return "web"
+	case d.FileName != "":
+		return "file"
+	default:
+		return "text"
+	}
+}
+
+// sourceRef identifies this document across uploads, so uploading the same
+// source again replaces it. The key covers type, url and file name: two files
+// only collide when all three match. ok is false for pasted text.
+func (d Document) sourceRef() (ref llm.SourceRef, ok bool) {
+	if d.SourceURL == "" && d.FileName == "" {
+		return llm.SourceRef{}, false
+	}
+	ref.Key = d.sourceType() + "|" + d.SourceURL + "|" + d.FileName
+	// earlier uploads were matched on url or file name alone
+	if d.SourceURL != "" {
+		ref.LegacyField, ref.LegacyValue = "source_url", d.SourceURL
+	} else {
+		ref.LegacyField, ref.LegacyValue = "file_name", d.FileName
+	}
+	return ref, true
+}
+
+func (d Document) domain() string {
+	if d.SourceURL == "" {
+		return ""
+	}
+	u, err := url.Parse(d.SourceURL)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimPrefix(u.Hostname(), "www.")
+}
+
+// DetectFormat picks a format from an explicit value, the file extension,
+// the content type or, failing those, the content itself.
+func DetectFormat(format, fileName, contentType, content string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(format)) {
+	case "md", "markdown":
+		return FormatMarkdown, nil
+	case "html", "htm":
+		return FormatHTML, nil
+	case "txt", "text", "plain":
+		return FormatText, nil
+	case "":
+	default:
+		return "", ErrUnsupportedFormat
+	}
+
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".md", ".markdown":
+		return FormatMarkdown, nil
+	case ".html", ".htm":
+		return FormatHTML, nil
+	case ".txt":
+		return FormatText, nil
+	}
+
+	switch {
+	case strings.Contains(contentType, "markdown"):
+		return FormatMarkdown, nil
+	case strings.Contains(contentType, "html"):
+		return FormatHTML, nil
+	}
+
+	head := strings.ToLower(strings.TrimSpace(content))
+	if len(head) > 512 {
+		head = head[:512]
+	}
+	switch {
+	case strings.HasPrefix(head, "<!doctype html") || strings.HasPrefix(head, "<html") || strings.Contains(head, "<body"):
+		return FormatHTML, nil
+	case strings.HasPrefix(head, "#") || strings.Contains(head, "\n#"):
+		return FormatMarkdown, nil
+	}
+	return FormatText, nil
+}
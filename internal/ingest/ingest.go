@@ -0,0 +1,122 @@
+package ingest
+
+import (
+	"butter-time/internal/llm"
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+// pointNamespace makes point ids deterministic: re-ingesting a source
+// overwrites its points instead of piling up copies.
+var pointNamespace = uuid.MustParse("6f1c2a52-8a5e-4d1f-9a53-2b7c0f4e8d11")
+
+// Result summarises one ingested document.
+type Result struct {
+	SourceType string   `json:"source_type"`
+	SourceURL  string   `json:"source_url,omitempty"`
+	FileName   string   `json:"file_name,omitempty"`
+	PageTitle  string   `json:"page_title,omitempty"`
+	Language   string   `json:"language"`
+	Chunks     int      `json:"chunks"`
+	Intents    []string `json:"intents"`
+}
+
+// Ingest parses, chunks, tags, embeds and upserts one document into the
+// company's collection (company_<id>).
+func Ingest(ctx context.Context, companyID string, doc Document) (Result, error) {
+	ctx = llm.WithCompany(ctx, companyID) // embedding tokens count against the company
+	var sections []section
+	var title string
+	switch doc.Format {
+	case FormatMarkdown:
+		sections, title = parseMarkdown(doc.Content)
+	case FormatHTML:
+		sections, title = parseHTML(doc.Content)
+	case FormatText:
+		sections = parseText(doc.Content)
+	default:
+		return Result{}, ErrUnsupportedFormat
+	}
+	if doc.PageTitle == "" {
+		doc.PageTitle = title
+	}
+
+	chunks := chunkSections(sections)
+	if len(chunks) == 0 {
+		return Result{}, ErrEmptyDocument
+	}
+
+	texts := make([]string, len(chunks))
+	for i, c := range chunks {
+		texts[i] = c.text
+	}
+	vectors, err := llm.EmbedTexts(ctx, texts)
+	if err != nil {
+		return Result{}, fmt.Errorf("embedding chunks: %w", err)
+	}
+
+	if err := llm.EnsureCollection(ctx, companyID); err != nil {
+		return Result{}, fmt.Errorf("preparing collection: %w", err)
+	}
+	source, hasSource := doc.sourceRef()
+
+	result := Result{
+		SourceType: doc.sourceType(),
+		SourceURL:  doc.SourceURL,
+		FileName:   doc.FileName,
+		PageTitle:  doc.PageTitle,
+		Language:   doc.Language,
+		Chunks:     len(chunks),
+	}
+	if result.Language == "" {
+		result.Language = detectLanguage(doc.Content)
+	}
+
+	seenIntent := map[string]bool{}
+	points := make([]llm.KnowledgeChunk, 0, len(chunks))
+	ids := make([]string, 0, len(chunks))
+	for i, c := range chunks {
+		intent := tagIntent(c.sectionPath, c.text)
+		if !seenIntent[intent] {
+			seenIntent[intent] = true
+			result.Intents = append(result.Intents, intent)
+		}
+		language := doc.Language
+		if language == "" {
+			language = detectLanguage(c.text)
+		}
+		idSeed := fmt.Sprintf("%s|%s|%d", companyID, source.Key, i)
+		if !hasSource {
+			idSeed = fmt.Sprintf("%s|%s", companyID, c.text)
+		}
+		id := uuid.NewSHA1(pointNamespace, []byte(idSeed)).String()
+		ids = append(ids, id)
+		points = append(points, llm.KnowledgeChunk{
+			ID:          id,
+			Vector:      vectors[i],
+			Text:        c.text,
+			SectionPath: c.sectionPath,
+			Intent:      intent,
+			SourceType:  result.SourceType,
+			SourceURL:   doc.SourceURL,
+			PageTitle:   doc.PageTitle,
+			Language:    language,
+			FileName:    doc.FileName,
+			Domain:      doc.domain(),
+			SourceKey:   source.Key,
+		})
+	}
+
+	if err := llm.UpsertChunks(ctx, companyID, points); err != nil {
+		return Result{}, fmt.Errorf("upserting chunks: %w", err)
+	}
+	// the new copy is in: drop what's left of the previous one
+	if hasSource {
+		if err := llm.DeleteSource(ctx, companyID, source, ids); err != nil {
+			return Result{}, fmt.Errorf("removing stale chunks of previous upload: %w", err)
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,73 @@
+package ingest
+
+import (
+	"strings"
+	"unicode"
+)
+
+// intentRules are checked in order; the first rule with enough hits wins.
+// The intent names are the ones humanIntent in the llm package understands.
+var intentRules = []struct {
+	intent   string
+	keywords []string
+	minHits  int
+}{
+	{"code_or_formula", []string{"```", "function(", "=>", "select ", "formula"}, 1},
+	{"pricing", []string{"price", "pricing", "cost", "fee", "per month", "/month", "$", "৳", "taka", "discount", "plan", "দাম", "মূল্য"}, 2},
+	{"contact_or_location", []string{"contact", "address", "phone", "email", "call us", "location", "office", "whatsapp", "যোগাযোগ", "ঠিকানা"}, 2},
+	{"policy_or_rule", []string{"policy", "refund", "return", "terms", "privacy", "must", "not allowed", "prohibited", "warranty", "নীতি"}, 2},
+	{"faq", []string{"faq", "frequently asked", "q:", "question"}, 1},
+	{"procedural", []string{"step", "how to", "click", "go to", "select", "follow", "first,", "then", "ধাপ"}, 2},
+	{"product_or_service", []string{"product", "service", "feature", "offer", "package", "available", "সেবা", "পণ্য"}, 2},
+	{"overview", []string{"about us", "overview", "who we are", "our mission", "introduction", "welcome"}, 1},
+}
+
+// tagIntent labels a chunk so the retriever can build a company profile.
+func tagIntent(sectionPath, text string) string {
+	if strings.Count(text, "|") >= 6 {
+		return "tabular_data"
+	}
+	haystack := strings.ToLower(sectionPath + "\n" + text)
+	for _, rule := range intentRules {
+		hits := 0
+		for _, k := range rule.keywords {
+			if strings.Contains(haystack, k) {
+				hits++
+			}
+		}
+		// a keyword in the heading is a strong signal on its own
+		headingHit := false
+		for _, k := range rule.keywords {
+			if sectionPath != "" && strings.Contains(strings.ToLower(sectionPath), k) {
+				headingHit = true
+				break
+			}
+		}
+		if hits >= rule.minHits || headingHit {
+			return rule.intent
+		}
+	}
+	if strings.Count(text, "?") >= 2 {
+		return "faq"
+	}
+	return "informational"
+}
+
+// detectLanguage tells Bengali from everything else, which is all the
+// prompts care about; other scripts default to English.
+func detectLanguage(text string) string {
+	bengali, letters := 0, 0
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		if unicode.Is(unicode.Bengali, r) {
+			bengali++
+		}
+	}
+	if letters > 0 && bengali*3 >= letters {
+		return "bn"
+	}
+	return "en"
+}
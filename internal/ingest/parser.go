@@ -0,0 +1,170 @@
+package ingest
+
+import (
+	"html"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// section is the text under one heading, with the heading trail above it.
+type section struct {
+	path []string
+	text string
+}
+
+// ── Markdown ──────────────────────────────────────────────────────────────────
+
+var mdHeading = regexp.MustCompile(`^(#{1,6})\s+(.+?)\s*#*\s*$`)
+
+func parseMarkdown(content string) (sections []section, title string) {
+	var path []string
+	var body strings.Builder
+	inFence := false
+
+	flush := func() {
+		if text := strings.TrimSpace(body.String()); text != "" {
+			sections = append(sections, section{path: append([]string(nil), path...), text: text})
+		}
+		body.Reset()
+	}
+
+	for _, line := range strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			inFence = !inFence
+		}
+		if !inFence {
+			if m := mdHeading.FindStringSubmatch(line); m != nil {
+				flush()
+				level := len(m[1])
+				heading := strings.TrimSpace(m[2])
+				if title == "" && level == 1 {
+					title = heading
+				}
+				if level-1 < len(path) {
+					path = path[:level-1]
+				}
+				for len(path) < level-1 {
+					path = append(path, "")
+				}
+				path = append(path, heading)
+				continue
+			}
+		}
+		body.WriteString(line)
+		body.WriteString("\n")
+	}
+	flush()
+
+	for i := range sections {
+		sections[i].path = compactPath(sections[i].path)
+	}
+	return sections, title
+}
+
+// ── HTML ──────────────────────────────────────────────────────────────────────
+
+var (
+	htmlDropBlocks = regexp.MustCompile(`(?is)<(script|style|noscript|svg|nav|footer|head)\b.*?</(script|style|noscript|svg|nav|footer|head)>`)
+	htmlComment    = regexp.MustCompile(`(?s)<!--.*?-->`)
+	htmlTitle      = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+	htmlHeading    = regexp.MustCompile(`(?is)<h([1-6])[^>]*>(.*?)</h[1-6]>`)
+	htmlListItem   = regexp.MustCompile(`(?i)<li[^>]*>`)
+	htmlBlockBreak = regexp.MustCompile(`(?i)</?(p|div|section|article|br|tr|table|ul|ol|blockquote|pre)[^>]*>`)
+	htmlCell       = regexp.MustCompile(`(?i)</t[dh]>`)
+	htmlTag        = regexp.MustCompile(`(?s)<[^>]+>`)
+	blankLines     = regexp.MustCompile(`\n{3,}`)
+)
+
+// parseHTML rewrites the page into markdown (headings become '#' lines) and
+// reuses the markdown sectioning, which keeps both paths identical.
+func parseHTML(content string) (sections []section, title string) {
+	if m := htmlTitle.FindStringSubmatch(content); m != nil {
+		title = cleanInline(m[1])
+	}
+
+	s := htmlComment.ReplaceAllString(content, "")
+	s = htmlDropBlocks.ReplaceAllString(s, "")
+	s = htmlHeading.ReplaceAllStringFunc(s, func(h string) string {
+		m := htmlHeading.FindStringSubmatch(h)
+		return "\n\n" + strings.Repeat("#", int(m[1][0]-'0')) + " " + cleanInline(m[2]) + "\n\n"
+	})
+	s = htmlListItem.ReplaceAllString(s, "\n- ")
+	s = htmlCell.ReplaceAllString(s, " | ")
+	s = htmlBlockBreak.ReplaceAllString(s, "\n")
+	s = htmlTag.ReplaceAllString(s, "")
+	s = html.UnescapeString(s)
+
+	lines := strings.Split(s, "\n")
+	for i, l := range lines {
+		lines[i] = strings.Join(strings.Fields(l), " ")
+	}
+	s = blankLines.ReplaceAllString(strings.Join(lines, "\n"), "\n\n")
+
+	sections, mdTitle := parseMarkdown(s)
+	if title == "" {
+		title = mdTitle
+	}
+	return sections, title
+}
+
+func cleanInline(s string) string {
+	return strings.Join(strings.Fields(html.UnescapeString(htmlTag.ReplaceAllString(s, ""))), " ")
+}
+
+// ── Plain text ────────────────────────────────────────────────────────────────
+
+// parseText treats short standalone lines followed by a blank line as
+// headings ("Refund Policy" over a paragraph), which is how most pasted
+// documents are laid out.
+func parseText(content string) []section {
+	var sections []section
+	var heading string
+	var body strings.Builder
+
+	flush := func() {
+		if text := strings.TrimSpace(body.String()); text != "" {
+			var path []string
+			if heading != "" {
+				path = []string{heading}
+			}
+			sections = append(sections, section{path: path, text: text})
+		}
+		body.Reset()
+	}
+
+	paragraphs := strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n\n")
+	for _, p := range paragraphs {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		if looksLikeHeading(p) {
+			flush()
+			heading = strings.TrimRight(p, ":")
+			continue
+		}
+		body.WriteString(p)
+		body.WriteString("\n\n")
+	}
+	flush()
+	return sections
+}
+
+func looksLikeHeading(p string) bool {
+	if strings.Contains(p, "\n") || len([]rune(p)) > 80 || len(strings.Fields(p)) > 10 {
+		return false
+	}
+	last := []rune(p)[len([]rune(p))-1]
+	return !unicode.IsPunct(last) || last == ':'
+}
+
+func compactPath(path []string) []string {
+	out := path[:0]
+	for _, p := range path {
+		if p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
@@ -0,0 +1,168 @@
+package llm
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/openai/openai-go/v3"
+)
+
+// ── Per-company assistant config ──────────────────────────────────────────────
+
+// AIConfig is everything a tenant can tune about its assistant, plus the few
+// human chat settings that share its file. Zero values fall back to the
+// defaults below, so a company file only lists overrides.
+type AIConfig struct {
+	AssistantName    string       `json:"assistant_name"`
+	Persona          string       `json:"persona"`           // extra role instructions
+	Tone             string       `json:"tone"`              // replaces the default TONE rules
+	AllowedLanguages []string     `json:"allowed_languages"` // empty = mirror the customer
+	Model            string       `json:"model"`
+	FallbackModel    string       `json:"fallback_model"` // used when Model fails before answering; "none" disables
+	TopK             int          `json:"top_k"`
+	MinScore         float64      `json:"min_score"`
+	HandoffMessage   string       `json:"handoff_message"`
+	PromptVersion    string       `json:"prompt_version"`    // prompts/<version>, empty = PROMPT_VERSION
+	IntentClassifier string       `json:"intent_classifier"` // centroid (default) | llm
+	Hybrid           HybridConfig `json:"hybrid"`
+	PII              PIIConfig    `json:"pii"`
+	Quota            QuotaConfig  `json:"quota"`
+	Tools            []ToolConfig `json:"tools"` // webhooks the model may call while answering
+
+	// how long after sending a message its sender may edit or delete it, in
+	// seconds; 0 = MESSAGE_EDIT_WINDOW, -1 = never
+	EditWindowSeconds int `json:"edit_window_seconds"`
+}
+
+var (
+	// one <company id>.json per tenant
+	aiConfigDir = getEnv("AI_CONFIG_DIR", "")
+
+	defaultHandoffMessage = "Would you like me to connect you with one of our team members?"
+)
+
+func defaultAIConfig() AIConfig {
+	return AIConfig{
+		Model:          openai.ChatModelGPT4o,
+		FallbackModel:  defaultFallbackModel,
+		TopK:           topK,
+		MinScore:       minScore,
+		HandoffMessage: defaultHandoffMessage,
+		Hybrid:         defaultHybridConfig,
+		PII:            PIIConfig{Detectors: allPIIDetectors()},
+		Quota: QuotaConfig{
+			SoftLimit:        0.8,
+			SoftLimitModel:   openai.ChatModelGPT4oMini,
+			ExhaustedMessage: defaultExhaustedMessage,
+		},
+	}
+}
+
+type cachedAIConfig struct {
+	cfg     AIConfig
+	modTime time.Time
+	pinned  bool // set through SetAIConfig, not read from disk
+}
+
+var (
+	aiConfigMu    sync.Mutex
+	aiConfigCache = make(map[string]cachedAIConfig)
+)
+
+// SetAIConfig pins a company's config in memory, overriding any file.
+func SetAIConfig(companyID string, cfg AIConfig) {
+	aiConfigMu.Lock()
+	defer aiConfigMu.Unlock()
+	aiConfigCache[companyID] = cachedAIConfig{cfg: normaliseAIConfig(cfg), pinned: true}
+}
+
+// LoadAIConfig returns the company's config. Files are re-read when their
+// modification time changes, so edits apply without a restart.
+func LoadAIConfig(companyID string) AIConfig {
+	aiConfigMu.Lock()
+	defer aiConfigMu.Unlock()
+
+	cached, ok := aiConfigCache[companyID]
+	if ok && cached.pinned {
+		return cached.cfg
+	}
+	if aiConfigDir == "" || companyID == "" || strings.ContainsAny(companyID, `/\`) {
+		return defaultAIConfig()
+	}
+
+	path := filepath.Join(aiConfigDir, companyID+".json")
+	info, err := os.Stat(path)
+	if err != nil {
+		delete(aiConfigCache, companyID)
+		return defaultAIConfig()
+	}
+	if ok && info.ModTime().Equal(cached.modTime) {
+		return cached.cfg
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		log.Println("ai config read error:", err)
+		return defaultAIConfig()
+	}
+	var cfg AIConfig
+	if err := json.Unmarshal(raw, &cfg); err != nil {
+		log.Printf("ai config decode error for company %s: %v", companyID, err)
+		if ok {
+			return cached.cfg // keep the last good config
+		}
+		return defaultAIConfig()
+	}
+
+	cfg = normaliseAIConfig(cfg)
+	aiConfigCache[companyID] = cachedAIConfig{cfg: cfg, modTime: info.ModTime()}
+	return cfg
+}
+
+func normaliseAIConfig(cfg AIConfig) AIConfig {
+	def := defaultAIConfig()
+	cfg.AssistantName = strings.TrimSpace(cfg.AssistantName)
+	if cfg.Model == "" {
+		cfg.Model = def.Model
+	}
+	switch cfg.FallbackModel {
+	case "":
+		cfg.FallbackModel = def.FallbackModel
+	case "none":
+		cfg.FallbackModel = ""
+	}
+	if cfg.TopK <= 0 {
+		cfg.TopK = def.TopK
+	}
+	if cfg.MinScore <= 0 || cfg.MinScore >= 1 {
+		cfg.MinScore = def.MinScore
+	}
+	if strings.TrimSpace(cfg.HandoffMessage) == "" {
+		cfg.HandoffMessage = def.HandoffMessage
+	}
+	// a file's "hybrid" object is filled from the defaults as it's decoded
+	// (HybridConfig.UnmarshalJSON); this covers leaving it out altogether
+	if cfg.Hybrid == (HybridConfig{}) {
+		cfg.Hybrid = def.Hybrid
+	}
+	cfg.Hybrid = normaliseHybridConfig(cfg.Hybrid, cfg.TopK)
+	if cfg.PII.Detectors == nil {
+		cfg.PII.Detectors = def.PII.Detectors
+	}
+	if cfg.Quota.SoftLimit <= 0 || cfg.Quota.SoftLimit > 1 {
+		cfg.Quota.SoftLimit = def.Quota.SoftLimit
+	}
+	if cfg.Quota.SoftLimitModel == "" {
+		cfg.Quota.SoftLimitModel = def.Quota.SoftLimitModel
+	}
+	if strings.TrimSpace(cfg.Quota.ExhaustedMessage) == "" {
+		cfg.Quota.ExhaustedMessage = def.Quota.ExhaustedMessage
+	}
+	cfg.Tools = normaliseTools(cfg.Tools)
+	return cfg
+}
@@ -0,0 +1,52 @@
+package llm
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadAIConfigPartialHybrid(t *testing.T) {
+	dir := t.TempDir()
+	prev := aiConfigDir
+	aiConfigDir = dir
+	t.Cleanup(func() { aiConfigDir = prev })
+
+	cases := []struct {
+		name string
+		file string
+		want HybridConfig
+	}{
+		{
+			name: "no hybrid object",
+			file: `{"top_k": 4}`,
+			want: defaultHybridConfig,
+		},
+		{
+			name: "rerank only keeps bm25 on",
+			file: `{"hybrid": {"rerank": true}}`,
+			want: HybridConfig{VectorWeight: 1, KeywordWeight: 1, RRFK: 60, CandidateK: 25, Rerank: true},
+		},
+		{
+			name: "explicit zero keyword weight disables bm25",
+			file: `{"hybrid": {"keyword_weight": 0}}`,
+			want: HybridConfig{VectorWeight: 1, KeywordWeight: 0, RRFK: 60, CandidateK: 25},
+		},
+		{
+			name: "both weights zero falls back to vectors",
+			file: `{"hybrid": {"vector_weight": 0, "keyword_weight": 0}}`,
+			want: HybridConfig{VectorWeight: 1, KeywordWeight: 0, RRFK: 60, CandidateK: 25},
+		},
+	}
+	for i, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			companyID := "company-" + string(rune('a'+i))
+			if err := os.WriteFile(filepath.Join(dir, companyID+".json"), []byte(c.file), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			if got := LoadAIConfig(companyID).Hybrid; got != c.want {
+				t.Errorf("hybrid = %+v, want %+v", got, c.want)
+			}
+		})
+	}
+}
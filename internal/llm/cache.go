@@ -0,0 +1,172 @@
+package llm
+
+import (
+	"butter-time/internal/env"
+	"container/list"
+	"context"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ── Cache config ──────────────────────────────────────────────────────────────
+
+var (
+	profileCacheTTL    = env.Duration("PROFILE_CACHE_TTL", 15*time.Minute)
+	embeddingCacheSize = env.Int("EMBEDDING_CACHE_SIZE", 2048)
+)
+
+// profileQuery is the probe used to sample a company's knowledge base when
+// building its profile for greetings and small talk.
+const profileQuery = "company overview products services"
+
+// CacheStats is a snapshot of the profile and embedding cache counters.
+type CacheStats struct {
+	ProfileHits      int64 `json:"profile_hits"`
+	ProfileMisses    int64 `json:"profile_misses"`
+	ProfileEntries   int   `json:"profile_entries"`
+	EmbeddingHits    int64 `json:"embedding_hits"`
+	EmbeddingMisses  int64 `json:"embedding_misses"`
+	EmbeddingEntries int   `json:"embedding_entries"`
+}
+
+var (
+	profileHits     atomic.Int64
+	profileMisses   atomic.Int64
+	embeddingHits   atomic.Int64
+	embeddingMisses atomic.Int64
+)
+
+// GetCacheStats returns the current hit/miss counters.
+func GetCacheStats() CacheStats {
+	profileMu.Lock()
+	profileEntries := len(profileCache)
+	profileMu.Unlock()
+
+	return CacheStats{
+		ProfileHits:      profileHits.Load(),
+		ProfileMisses:    profileMisses.Load(),
+		ProfileEntries:   profileEntries,
+		EmbeddingHits:    embeddingHits.Load(),
+		EmbeddingMisses:  embeddingMisses.Load(),
+		EmbeddingEntries: embeddings.len(),
+	}
+}
+
+// InvalidateCompany drops everything cached from a company's knowledge base.
+// Call it whenever the company's collection changes.
+func InvalidateCompany(companyID string) {
+	profileMu.Lock()
+	delete(profileCache, companyID)
+	profileMu.Unlock()
+
+	invalidateKeywordIndex(companyID)
+}
+
+// ── Company profile cache ─────────────────────────────────────────────────────
+
+type cachedProfile struct {
+	profile   CompanyProfile
+	expiresAt time.Time
+}
+
+var (
+	profileMu    sync.Mutex
+	profileCache = make(map[string]cachedProfile)
+)
+
+// companyProfile returns the inferred profile for a company, sampling the
+// knowledge base only when the cached one is missing or expired.
+func companyProfile(ctx context.Context, cfg AIConfig, companyID string) CompanyProfile {
+	profileMu.Lock()
+	entry, ok := profileCache[companyID]
+	profileMu.Unlock()
+	if ok && time.Now().Before(entry.expiresAt) {
+		profileHits.Add(1)
+		return entry.profile
+	}
+	profileMisses.Add(1)
+
+	embedding, err := embedQuery(ctx, profileQuery)
+	if err != nil {
+		// don't cache a failure — the next message retries
+		return CompanyProfile{}
+	}
+	chunks, err := store.Search(ctx, companyID, embedding, cfg.TopK, cfg.MinScore)
+	if err != nil && err != ErrCollectionNotFound {
+		return CompanyProfile{}
+	}
+	profile := inferCompanyProfile(chunks)
+
+	profileMu.Lock()
+	profileCache[companyID] = cachedProfile{profile: profile, expiresAt: time.Now().Add(profileCacheTTL)}
+	profileMu.Unlock()
+	return profile
+}
+
+// ── Embedding LRU ─────────────────────────────────────────────────────────────
+
+type embeddingLRU struct {
+	mu       sync.Mutex
+	capacity int
+	order    *list.List // front = most recently used
+	items    map[string]*list.Element
+}
+
+type embeddingEntry struct {
+	key    string
+	vector []float64
+}
+
+var embeddings = newEmbeddingLRU(embeddingCacheSize)
+
+func newEmbeddingLRU(capacity int) *embeddingLRU {
+	return &embeddingLRU{
+		capacity: capacity,
+		order:    list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+func (c *embeddingLRU) get(key string) ([]float64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(el)
+	return el.Value.(*embeddingEntry).vector, true
+}
+
+func (c *embeddingLRU) put(key string, vector []float64) {
+	if c.capacity <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[key]; ok {
+		el.Value.(*embeddingEntry).vector = vector
+		c.order.MoveToFront(el)
+		return
+	}
+	c.items[key] = c.order.PushFront(&embeddingEntry{key: key, vector: vector})
+	for c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*embeddingEntry).key)
+	}
+}
+
+func (c *embeddingLRU) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+// normaliseQuery folds case and whitespace so "Opening hours?" and
+// "  opening   hours? " share one cache entry.
+func normaliseQuery(query string) string {
+	return strings.Join(strings.Fields(strings.ToLower(query)), " ")
+}
@@ -0,0 +1,70 @@
+package llm
+
+import (
+	"butter-time/internal/model"
+	"fmt"
+	"math"
+)
+
+// maxCitations caps how many sources are shown under one answer.
+const maxCitations = 5
+
+// Citations turns the chunks behind an answer into de-duplicated sources:
+// one entry per page URL, or per file + page for uploaded documents. When a
+// source contributed several chunks, the best scoring one is kept.
+func Citations(result RAGResult) []model.Citation {
+	if !result.Relevant {
+		return []model.Citation{}
+	}
+
+	citations := []model.Citation{}
+	index := make(map[string]int)
+
+	for _, c := range result.Chunks {
+		key := citationKey(c)
+		if key == "" {
+			continue
+		}
+		score := c.Score
+		if score == 0 {
+			score = c.KeywordHit
+		}
+		score = math.Round(score*1000) / 1000
+
+		if i, ok := index[key]; ok {
+			if score > citations[i].Score {
+				citations[i].Score = score
+				citations[i].SectionPath = c.SectionPath
+			}
+			continue
+		}
+		if len(citations) == maxCitations {
+			continue
+		}
+
+		title := c.PageTitle
+		if title == "" {
+			title = c.FileName
+		}
+		index[key] = len(citations)
+		citations = append(citations, model.Citation{
+			Title:       title,
+			URL:         c.SourceURL,
+			FileName:    c.FileName,
+			Page:        c.PageNumber,
+			SectionPath: c.SectionPath,
+			Score:       score,
+		})
+	}
+	return citations
+}
+
+func citationKey(c RetrievedChunk) string {
+	if c.SourceURL != "" {
+		return c.SourceURL
+	}
+	if c.FileName != "" {
+		return fmt.Sprintf("%s#%v", c.FileName, c.PageNumber)
+	}
+	return ""
+}
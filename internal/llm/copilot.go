@@ -0,0 +1,116 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/openai/openai-go/v3"
+)
+
+// ── Agent copilot ─────────────────────────────────────────────────────────────
+
+// maxSuggestions is the most drafts offered to an agent for one message.
+const maxSuggestions = 3
+
+// Suggestion is a set of reply drafts for an agent plus the RAG result the
+// first draft came from (for citations).
+type Suggestion struct {
+	Drafts []string
+	Result RAGResult
+}
+
+// SuggestReplies drafts up to n replies to the latest customer message.
+// history is the conversation so far, oldest first, formatted "Sender: text".
+// Nothing is streamed — the drafts are for the agent only — and no company
+// tool is called: the agent hasn't approved anything yet.
+func SuggestReplies(ctx context.Context, companyID string, history []string, latest string, n int) (Suggestion, error) {
+	n = max(1, min(n, maxSuggestions))
+
+	result, err := RetrieveAndAnswer(withoutTools(ctx), companyID, copilotQuery(history, latest), nil)
+	if err != nil {
+		return Suggestion{}, fmt.Errorf("copilot draft: %w", err)
+	}
+	draft := strings.TrimSpace(result.Answer)
+	if draft == "" {
+		return Suggestion{Result: result}, nil
+	}
+
+	drafts := []string{draft}
+	if n > 1 && checkQuota(companyID, LoadAIConfig(companyID).Quota) == quotaOK {
+		// the rewrite prompt sees the conversation too — scrub it the same way
+		cfg := LoadAIConfig(companyID)
+		pii := newPIISet(cfg.PII)
+		redacted := make([]string, len(history))
+		for i, line := range history {
+			redacted[i] = pii.redact(line, cfg.PII)
+		}
+
+		alternatives, err := alternativeDrafts(ctx, redacted, pii.redact(latest, cfg.PII), pii.redact(draft, cfg.PII), n-1)
+		if err != nil {
+			// one grounded draft is still worth showing
+			log.Println("copilot alternatives error:", err)
+		}
+		for _, a := range alternatives {
+			if a = strings.TrimSpace(a); a != "" {
+				drafts = appendUnique(drafts, pii.restoreAll(a))
+			}
+		}
+	}
+	return Suggestion{Drafts: drafts, Result: result}, nil
+}
+
+// copilotQuery is what goes through retrieval. Short follow-ups ("and the
+// price?") borrow the previous customer line so retrieval has a subject.
+func copilotQuery(history []string, latest string) string {
+	if len(strings.Fields(latest)) >= 4 {
+		return latest
+	}
+	for i := len(history) - 1; i >= 0; i-- {
+		line, ok := strings.CutPrefix(history[i], "Customer: ")
+		if ok && strings.TrimSpace(line) != strings.TrimSpace(latest) {
+			return line + " " + latest
+		}
+	}
+	return latest
+}
+
+// alternativeDrafts rewrites the grounded draft into other phrasings without
+// adding facts, so every suggestion stays backed by the same sources.
+func alternativeDrafts(ctx context.Context, history []string, latest, draft string, n int) ([]string, error) {
+	var sb strings.Builder
+	sb.WriteString("You help a customer support agent reply to a customer.\n\n")
+	sb.WriteString("INSTRUCTIONS:\n")
+	sb.WriteString(fmt.Sprintf("- Write %d alternative replies to the customer's latest message.\n", n))
+	sb.WriteString("- Use ONLY the facts in the draft reply below — do not add new information.\n")
+	sb.WriteString("- Vary length and tone (e.g. one shorter, one warmer).\n")
+	sb.WriteString("- Reply in the same language as the customer.\n")
+	sb.WriteString("- Output ONLY a JSON array of strings.\n\n")
+	if len(history) > 0 {
+		sb.WriteString("CONVERSATION SO FAR:\n")
+		for _, line := range history {
+			sb.WriteString(line + "\n")
+		}
+		sb.WriteString("\n")
+	}
+	sb.WriteString(fmt.Sprintf("Customer's latest message: %s\n\n", latest))
+	sb.WriteString(fmt.Sprintf("Draft reply:\n%s\n", draft))
+
+	text, err := completeText(ctx, openai.ChatModelGPT4oMini, sb.String())
+	if err != nil {
+		return nil, err
+	}
+
+	out := strings.TrimSpace(text)
+	out = strings.TrimSpace(strings.TrimPrefix(strings.TrimSuffix(out, "```"), "```json"))
+	var alternatives []string
+	if err := json.Unmarshal([]byte(out), &alternatives); err != nil {
+		return nil, fmt.Errorf("alternatives not parseable: %w", err)
+	}
+	if len(alternatives) > n {
+		alternatives = alternatives[:n]
+	}
+	return alternatives, nil
+}
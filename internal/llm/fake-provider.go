@@ -0,0 +1,151 @@
+package llm
+
+import (
+	"context"
+	"hash/fnv"
+	"strings"
+)
+
+// FakeProvider is a deterministic, offline Provider for evaluation and CI.
+//
+//   - Embed hashes words and word pairs into a small vector, so texts that
+//     share vocabulary land close together.
+//   - Stream answers extractively: the context sentence that overlaps the
+//     customer question most, or a polite refusal when the prompt has none.
+//   - Complete returns nothing, so optional steps (rerank, the llm intent
+//     judge, copilot alternatives) take their fallback paths.
+//   - Tools: when an offered tool's name appears in the question (order_status
+//     or "order status"), the first turn calls it with no arguments and the
+//     next one answers with what it returned.
+type FakeProvider struct {
+	Dimensions int // default 256
+}
+
+func NewFakeProvider() *FakeProvider {
+	return &FakeProvider{Dimensions: 256}
+}
+
+func (f *FakeProvider) Name() string { return "fake" }
+
+func (f *FakeProvider) Embed(ctx context.Context, model string, texts []string) ([][]float64, TokenUsage, error) {
+	dims := f.Dimensions
+	if dims <= 0 {
+		dims = 256
+	}
+	var usage TokenUsage
+	vectors := make([][]float64, len(texts))
+	for i, text := range texts {
+		usage.Input += int64(len(strings.Fields(text)))
+		vec := make([]float64, dims)
+		tokens := tokenize(text)
+		for j, tok := range tokens {
+			vec[fakeBucket(tok, dims)] += 1
+			if j > 0 {
+				vec[fakeBucket(tokens[j-1]+" "+tok, dims)] += 0.5
+			}
+		}
+		vectors[i] = normalise(vec)
+	}
+	return vectors, usage, ctx.Err()
+}
+
+func (f *FakeProvider) Complete(ctx context.Context, model, prompt string) (string, TokenUsage, error) {
+	return "", TokenUsage{Input: int64(len(strings.Fields(prompt)))}, ctx.Err()
+}
+
+func (f *FakeProvider) Stream(ctx context.Context, req StreamRequest, onToken func(string)) (StreamResult, error) {
+	result := StreamResult{Usage: TokenUsage{Input: int64(len(strings.Fields(req.Prompt)))}}
+	if call, ok := fakeToolCall(req); ok {
+		result.ResponseID = "fake-response-" + call.CallID
+		result.ToolCalls = []ToolCall{call}
+		return result, ctx.Err()
+	}
+
+	answer := fakeAnswer(req.Prompt)
+	if req.PreviousResponseID != "" {
+		outputs := make([]string, len(req.ToolOutputs))
+		for i, out := range req.ToolOutputs {
+			outputs[i] = out.Output
+		}
+		answer = strings.Join(outputs, " ")
+	}
+	for _, word := range strings.SplitAfter(answer, " ") {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+		onToken(word)
+		result.Usage.Output++
+	}
+	return result, nil
+}
+
+func fakeBucket(feature string, dims int) int {
+	h := fnv.New32a()
+	h.Write([]byte(feature))
+	return int(h.Sum32() % uint32(dims))
+}
+
+// fakeToolCall calls the first offered tool the question names.
+func fakeToolCall(req StreamRequest) (ToolCall, bool) {
+	if req.PreviousResponseID != "" {
+		return ToolCall{}, false
+	}
+	question := strings.ToLower(fakeQuestion(req.Prompt))
+	for _, tool := range req.Tools {
+		name := strings.ToLower(tool.Name)
+		if strings.Contains(question, name) || strings.Contains(question, strings.ReplaceAll(name, "_", " ")) {
+			return ToolCall{CallID: "fake-call-" + tool.Name, Name: tool.Name, Arguments: "{}"}, true
+		}
+	}
+	return ToolCall{}, false
+}
+
+func fakeQuestion(prompt string) string {
+	question := ""
+	if i := strings.LastIndex(prompt, "Customer question:"); i >= 0 {
+		question, _, _ = strings.Cut(prompt[i+len("Customer question:"):], "\n")
+	}
+	return question
+}
+
+// fakeAnswer picks the context sentence sharing the most words with the
+// question in a rendered answer prompt.
+func fakeAnswer(prompt string) string {
+	question := fakeQuestion(prompt)
+
+	contextText := ""
+	if start := strings.Index(prompt, "--- COMPANY INFORMATION ---"); start >= 0 {
+		contextText = prompt[start:]
+		if end := strings.Index(contextText, "--- END ---"); end >= 0 {
+			contextText = contextText[:end]
+		}
+	} else if start := strings.Index(prompt, "PARTIAL CONTEXT:"); start >= 0 {
+		contextText = prompt[start:]
+		if end := strings.Index(contextText, "Customer question:"); end >= 0 {
+			contextText = contextText[:end]
+		}
+	}
+
+	want := make(map[string]bool)
+	for _, tok := range tokenize(question) {
+		want[tok] = true
+	}
+	best, bestOverlap := "", 0
+	for _, sentence := range strings.FieldsFunc(contextText, func(r rune) bool {
+		return r == '\n' || r == '.' || r == '!' || r == '?' || r == '।'
+	}) {
+		overlap := 0
+		for _, tok := range uniqueTerms(tokenize(sentence)) {
+			if want[tok] {
+				overlap++
+			}
+		}
+		if overlap > bestOverlap {
+			best, bestOverlap = strings.TrimSpace(sentence), overlap
+		}
+	}
+	if best == "" {
+		return "Sorry, I can only help with questions about this company."
+	}
+	return best + "."
+}
@@ -0,0 +1,47 @@
+package llm
+
+import (
+	"context"
+	"testing"
+)
+
+// useFakes runs the test against the offline provider and an in-memory store,
+// seeded with texts for companyID when there are any.
+func useFakes(t *testing.T, companyID string, texts ...string) {
+	t.Helper()
+	prevProvider, prevStore := provider, store
+	mem := NewMemoryStore()
+	SetProvider(NewFakeProvider())
+	SetVectorStore(mem)
+	t.Cleanup(func() {
+		SetProvider(prevProvider)
+		SetVectorStore(prevStore)
+		invalidateKeywordIndex(companyID)
+	})
+
+	if len(texts) == 0 {
+		return
+	}
+	vectors, _, err := provider.Embed(context.Background(), "", texts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chunks := make([]KnowledgeChunk, len(texts))
+	for i, text := range texts {
+		chunks[i] = KnowledgeChunk{ID: string(rune('a' + i)), Vector: vectors[i], Text: text, FileName: string(rune('a'+i)) + ".md"}
+	}
+	if err := mem.Upsert(context.Background(), companyID, chunks); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// pinConfig pins cfg for companyID for the length of the test.
+func pinConfig(t *testing.T, companyID string, cfg AIConfig) {
+	t.Helper()
+	SetAIConfig(companyID, cfg)
+	t.Cleanup(func() {
+		aiConfigMu.Lock()
+		delete(aiConfigCache, companyID)
+		aiConfigMu.Unlock()
+	})
+}
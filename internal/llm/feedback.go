@@ -0,0 +1,195 @@
+package llm
+
+import (
+	"butter-time/internal/env"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ── Answer feedback ───────────────────────────────────────────────────────────
+//
+// Every RAG answer gets an ID and a short-lived record of how it was made
+// (query, chunks, prompt version, model). Thumbs up/down on that ID is
+// appended to FEEDBACK_LOG together with the record, one JSON line each —
+// the dataset for tuning minScore, topK and the prompts. A rating can be
+// changed; the latest line for an answer and rater wins.
+
+var (
+	feedbackLogPath = getEnv("FEEDBACK_LOG", "feedback.jsonl")
+
+	// how long an answer can still be rated
+	answerRetention = env.Duration("ANSWER_RETENTION", 24*time.Hour)
+	maxAnswers      = env.Int("ANSWER_CACHE_SIZE", 20000)
+
+	// longest free-text comment kept
+	maxFeedbackComment = 2000
+)
+
+var (
+	ErrUnknownAnswer   = errors.New("unknown or expired answer")
+	ErrInvalidFeedback = errors.New("invalid feedback")
+)
+
+const (
+	RatingUp   = "up"
+	RatingDown = "down"
+)
+
+var feedbackReasons = map[string]bool{
+	"incorrect":  true,
+	"incomplete": true,
+	"irrelevant": true,
+	"outdated":   true,
+	"too_long":   true,
+	"tone":       true,
+	"other":      true,
+}
+
+// Feedback is one rating of an answer.
+type Feedback struct {
+	AnswerID  string `json:"answer_id"`
+	Rating    string `json:"rating"`           // up | down
+	Reason    string `json:"reason,omitempty"` // see feedbackReasons
+	Comment   string `json:"comment,omitempty"`
+	RaterType string `json:"rater_type"` // Customer | Human-Agent
+	RaterID   string `json:"rater_id"`
+}
+
+// answerRecord is what we keep about an answer until it is rated or expires.
+type answerRecord struct {
+	AnswerID       string        `json:"answer_id"`
+	CompanyID      string        `json:"company_id"`
+	ConversationID string        `json:"conversation_id,omitempty"`
+	Query          string        `json:"query"` // PII redacted
+	Answer         string        `json:"answer"`
+	Chunks         []chunkRecord `json:"chunks"`
+	Relevant       bool          `json:"relevant"`
+	PromptVersion  string        `json:"prompt_version"`
+	Model          string        `json:"model"`
+	Intent         Intent        `json:"intent"`
+	TopK           int           `json:"top_k"`
+	MinScore       float64       `json:"min_score"`
+	CreatedAt      time.Time     `json:"created_at"`
+}
+
+type chunkRecord struct {
+	ID         string  `json:"id"`
+	Score      float64 `json:"score"`
+	FusedScore float64 `json:"fused_score,omitempty"`
+	KeywordHit float64 `json:"keyword_hit,omitempty"`
+}
+
+// feedbackRecord is one line of FEEDBACK_LOG.
+type feedbackRecord struct {
+	Feedback
+	Answer    answerRecord `json:"answer"`
+	CreatedAt time.Time    `json:"created_at"`
+}
+
+var (
+	answersMu sync.Mutex
+	answers   = make(map[string]*answerRecord)
+
+	feedbackMu sync.Mutex
+)
+
+// rememberAnswer assigns the answer an ID and keeps what's needed to file
+// feedback against it later.
+func rememberAnswer(companyID, conversationID string, cfg AIConfig, result *RAGResult) {
+	result.AnswerID = uuid.NewString()
+
+	rec := &answerRecord{
+		AnswerID:       result.AnswerID,
+		CompanyID:      companyID,
+		ConversationID: conversationID,
+		Query:          result.Query,
+		Answer:         result.Answer,
+		Relevant:       result.Relevant,
+		PromptVersion:  result.PromptVersion,
+		Model:          result.Model,
+		Intent:         result.Intent,
+		TopK:           cfg.TopK,
+		MinScore:       cfg.MinScore,
+		CreatedAt:      time.Now().UTC(),
+	}
+	for _, c := range result.Chunks {
+		rec.Chunks = append(rec.Chunks, chunkRecord{ID: c.ID, Score: c.Score, FusedScore: c.FusedScore, KeywordHit: c.KeywordHit})
+	}
+
+	answersMu.Lock()
+	defer answersMu.Unlock()
+	answers[rec.AnswerID] = rec
+	if len(answers) > maxAnswers {
+		pruneAnswers()
+	}
+}
+
+// pruneAnswers drops expired answers, then the oldest until under the cap.
+// answersMu must be held.
+func pruneAnswers() {
+	cutoff := time.Now().Add(-answerRetention)
+	for id, rec := range answers {
+		if rec.CreatedAt.Before(cutoff) {
+			delete(answers, id)
+		}
+	}
+	for len(answers) > maxAnswers {
+		var oldest *answerRecord
+		for _, rec := range answers {
+			if oldest == nil || rec.CreatedAt.Before(oldest.CreatedAt) {
+				oldest = rec
+			}
+		}
+		delete(answers, oldest.AnswerID)
+	}
+}
+
+// RecordFeedback stores a rating for an answer made for companyID.
+func RecordFeedback(companyID string, fb Feedback) error {
+	fb.Rating = strings.ToLower(strings.TrimSpace(fb.Rating))
+	fb.Reason = strings.ToLower(strings.TrimSpace(fb.Reason))
+	fb.Comment = strings.TrimSpace(fb.Comment)
+	if fb.Rating != RatingUp && fb.Rating != RatingDown {
+		return fmt.Errorf("%w: rating must be %q or %q", ErrInvalidFeedback, RatingUp, RatingDown)
+	}
+	if fb.Reason != "" && !feedbackReasons[fb.Reason] {
+		return fmt.Errorf("%w: unknown reason %q", ErrInvalidFeedback, fb.Reason)
+	}
+	if len([]rune(fb.Comment)) > maxFeedbackComment {
+		fb.Comment = string([]rune(fb.Comment)[:maxFeedbackComment])
+	}
+
+	answersMu.Lock()
+	rec, ok := answers[fb.AnswerID]
+	answersMu.Unlock()
+	// another company's answer is as unknown as a missing one
+	if !ok || rec.CompanyID != companyID || time.Since(rec.CreatedAt) > answerRetention {
+		return ErrUnknownAnswer
+	}
+
+	line, err := json.Marshal(feedbackRecord{Feedback: fb, Answer: *rec, CreatedAt: time.Now().UTC()})
+	if err != nil {
+		return err
+	}
+
+	feedbackMu.Lock()
+	defer feedbackMu.Unlock()
+	f, err := os.OpenFile(feedbackLogPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	log.Printf("feedback %s on answer %s (company %s, prompt %s)", fb.Rating, fb.AnswerID, companyID, rec.PromptVersion)
+	return nil
+}
@@ -0,0 +1,38 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/openai/openai-go/v3"
+)
+
+// ── Answer grading (offline evaluation) ───────────────────────────────────────
+
+// GradeAnswer asks a small model how well answer matches the expected one,
+// from 0 (wrong or missing) to 1 (same facts). Wording and language may differ.
+func GradeAnswer(ctx context.Context, question, expected, answer string) (float64, error) {
+	var sb strings.Builder
+	sb.WriteString("You grade a customer support answer against a reference answer.\n")
+	sb.WriteString("Score 0 to 10: 10 = same facts as the reference, 5 = partly right or missing details, 0 = wrong, refuses, or unrelated.\n")
+	sb.WriteString("Ignore wording, tone and language differences.\n")
+	sb.WriteString(`Reply with ONLY JSON: {"score": <0..10>}` + "\n\n")
+	sb.WriteString(fmt.Sprintf("Question: %s\n\nReference answer:\n%s\n\nAnswer to grade:\n%s\n", question, expected, answer))
+
+	text, err := completeText(ctx, openai.ChatModelGPT4oMini, sb.String())
+	if err != nil {
+		return 0, err
+	}
+	out := strings.TrimSpace(text)
+	out = strings.TrimSpace(strings.TrimPrefix(strings.TrimSuffix(out, "```"), "```json"))
+	var verdict struct {
+		Score float64 `json:"score"`
+	}
+	if err := json.Unmarshal([]byte(out), &verdict); err != nil {
+		return 0, fmt.Errorf("grader output not parseable: %w", err)
+	}
+	return math.Max(0, math.Min(10, verdict.Score)) / 10, nil
+}
@@ -0,0 +1,47 @@
+package llm
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+// gradingProvider is the fake provider with a canned grader verdict.
+type gradingProvider struct {
+	*FakeProvider
+	verdict string
+	prompt  string
+}
+
+func (p *gradingProvider) Complete(ctx context.Context, model, prompt string) (string, TokenUsage, error) {
+	p.prompt = prompt
+	return p.verdict, TokenUsage{Input: int64(len(strings.Fields(prompt)))}, ctx.Err()
+}
+
+func TestGradeAnswer(t *testing.T) {
+	useFakes(t, "grading-test")
+	cases := []struct {
+		verdict string
+		want    float64
+		wantErr bool
+	}{
+		{`{"score": 10}`, 1, false},
+		{`{"score": 7}`, 0.7, false},
+		{"```json\n{\"score\": 5}\n```", 0.5, false},
+		{`{"score": 14}`, 1, false},
+		{`{"score": -2}`, 0, false},
+		{"", 0, true}, // what the plain fake provider says
+		{"seven out of ten", 0, true},
+	}
+	for _, c := range cases {
+		p := &gradingProvider{FakeProvider: NewFakeProvider(), verdict: c.verdict}
+		SetProvider(p)
+		got, err := GradeAnswer(context.Background(), "when do you open?", "At nine.", "We open at 9am.")
+		if (err != nil) != c.wantErr || got != c.want {
+			t.Errorf("verdict %q: score %v, err %v; want %v", c.verdict, got, err, c.want)
+		}
+		if !strings.Contains(p.prompt, "Reference answer:\nAt nine.") || !strings.Contains(p.prompt, "Answer to grade:\nWe open at 9am.") {
+			t.Errorf("grader prompt misses the answers:\n%s", p.prompt)
+		}
+	}
+}
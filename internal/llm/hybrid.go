@@ -0,0 +1,445 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/openai/openai-go/v3"
+)
+
+// ── Hybrid retrieval config ──────────────────────────────────────────────────
+
+// HybridConfig controls how vector and keyword results are merged for a
+// company. It is part of the company's AIConfig.
+type HybridConfig struct {
+	VectorWeight  float64 `json:"vector_weight"`
+	KeywordWeight float64 `json:"keyword_weight"` // 0 disables the BM25 side
+	RRFK          float64 `json:"rrf_k"`          // reciprocal rank fusion constant
+	CandidateK    int     `json:"candidate_k"`    // hits pulled from each retriever before fusion
+	Rerank        bool    `json:"rerank"`         // ask the model to rerank the fused list
+}
+
+var (
+	defaultHybridConfig = HybridConfig{
+		VectorWeight:  1.0,
+		KeywordWeight: 1.0,
+		RRFK:          60,
+		CandidateK:    25,
+		Rerank:        false,
+	}
+
+	// an exact keyword hit covering this much of the query is relevant on its own
+	keywordRelevantCoverage = 0.75
+
+	keywordIndexTTL = 10 * time.Minute
+	maxKeywordDocs  = 5000 // points scrolled from qdrant per company
+	bm25K1          = 1.2
+	bm25B           = 0.75
+)
+
+// UnmarshalJSON starts from the defaults, so a company file only lists the
+// fields it changes: {"rerank": true} keeps both retrievers on, and BM25 is
+// off only with an explicit "keyword_weight": 0.
+func (c *HybridConfig) UnmarshalJSON(data []byte) error {
+	type plain HybridConfig
+	cfg := plain(defaultHybridConfig)
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return err
+	}
+	*c = HybridConfig(cfg)
+	return nil
+}
+
+func normaliseHybridConfig(cfg HybridConfig, topK int) HybridConfig {
+	if cfg.VectorWeight < 0 {
+		cfg.VectorWeight = 0
+	}
+	if cfg.KeywordWeight < 0 {
+		cfg.KeywordWeight = 0
+	}
+	if cfg.VectorWeight == 0 && cfg.KeywordWeight == 0 {
+		cfg.VectorWeight = defaultHybridConfig.VectorWeight
+	}
+	if cfg.RRFK <= 0 {
+		cfg.RRFK = defaultHybridConfig.RRFK
+	}
+	if cfg.CandidateK < topK {
+		cfg.CandidateK = max(topK, defaultHybridConfig.CandidateK)
+	}
+	return cfg
+}
+
+// ── Hybrid search ─────────────────────────────────────────────────────────────
+
+// hybridSearch runs the vector search and BM25 keyword scoring side by side,
+// merges them with reciprocal rank fusion and optionally reranks the result.
+func hybridSearch(ctx context.Context, aiCfg AIConfig, companyID, query string, vector []float64) ([]RetrievedChunk, error) {
+	cfg := aiCfg.Hybrid
+
+	vectorHits, err := store.Search(ctx, companyID, vector, cfg.CandidateK, aiCfg.MinScore)
+	if err != nil {
+		return nil, err
+	}
+
+	var keywordHits []RetrievedChunk
+	if cfg.KeywordWeight > 0 {
+		keywordHits, err = keywordSearch(ctx, companyID, query, cfg.CandidateK)
+		if err != nil {
+			// keyword side is best effort — vector results are still useful
+			log.Println("keyword search error:", err)
+			keywordHits = nil
+		}
+	}
+
+	fused := fuseRRF(vectorHits, keywordHits, cfg)
+
+	if cfg.Rerank && len(fused) > 1 {
+		reranked, err := rerankChunks(ctx, query, fused)
+		if err != nil {
+			log.Println("rerank error:", err)
+		} else {
+			fused = reranked
+		}
+	}
+
+	if len(fused) > aiCfg.TopK {
+		fused = fused[:aiCfg.TopK]
+	}
+	return fused, nil
+}
+
+// fuseRRF merges two ranked lists: score = Σ weight / (k + rank).
+func fuseRRF(vectorHits, keywordHits []RetrievedChunk, cfg HybridConfig) []RetrievedChunk {
+	merged := make(map[string]*RetrievedChunk)
+	order := []string{}
+
+	add := func(hits []RetrievedChunk, weight float64, fromVector bool) {
+		for rank, hit := range hits {
+			key := chunkKey(hit)
+			existing, ok := merged[key]
+			if !ok {
+				c := hit
+				c.FusedScore = 0
+				merged[key] = &c
+				order = append(order, key)
+				existing = &c
+			}
+			if fromVector {
+				existing.Score = math.Max(existing.Score, hit.Score)
+			} else {
+				existing.KeywordHit = math.Max(existing.KeywordHit, hit.KeywordHit)
+			}
+			existing.FusedScore += weight / (cfg.RRFK + float64(rank+1))
+		}
+	}
+	add(vectorHits, cfg.VectorWeight, true)
+	add(keywordHits, cfg.KeywordWeight, false)
+
+	fused := make([]RetrievedChunk, 0, len(order))
+	for _, key := range order {
+		fused = append(fused, *merged[key])
+	}
+	sort.SliceStable(fused, func(i, j int) bool {
+		return fused[i].FusedScore > fused[j].FusedScore
+	})
+	return fused
+}
+
+func chunkKey(c RetrievedChunk) string {
+	if c.ID != "" {
+		return c.ID
+	}
+	return c.SourceURL + "|" + c.SectionPath + "|" + c.Text
+}
+
+// ── BM25 keyword index ────────────────────────────────────────────────────────
+
+type keywordIndex struct {
+	docs    []RetrievedChunk
+	terms   []map[string]int // term frequency per doc
+	lengths []int
+	df      map[string]int
+	avgLen  float64
+	builtAt time.Time
+}
+
+var (
+	keywordMu      sync.Mutex
+	keywordIndexes = make(map[string]*keywordIndex)
+)
+
+// invalidateKeywordIndex drops the cached BM25 index so the next query rebuilds it.
+func invalidateKeywordIndex(companyID string) {
+	keywordMu.Lock()
+	defer keywordMu.Unlock()
+	delete(keywordIndexes, companyID)
+}
+
+func keywordSearch(ctx context.Context, companyID, query string, limit int) ([]RetrievedChunk, error) {
+	idx, err := keywordIndexFor(ctx, companyID)
+	if err != nil {
+		return nil, err
+	}
+	return idx.search(query, limit), nil
+}
+
+func keywordIndexFor(ctx context.Context, companyID string) (*keywordIndex, error) {
+	keywordMu.Lock()
+	idx, ok := keywordIndexes[companyID]
+	keywordMu.Unlock()
+	if ok && time.Since(idx.builtAt) < keywordIndexTTL {
+		return idx, nil
+	}
+
+	docs, err := store.Scroll(ctx, companyID, maxKeywordDocs)
+	if err != nil {
+		return nil, err
+	}
+	idx = buildKeywordIndex(docs)
+
+	keywordMu.Lock()
+	keywordIndexes[companyID] = idx
+	keywordMu.Unlock()
+	return idx, nil
+}
+
+func buildKeywordIndex(docs []RetrievedChunk) *keywordIndex {
+	idx := &keywordIndex{
+		docs:    docs,
+		terms:   make([]map[string]int, len(docs)),
+		lengths: make([]int, len(docs)),
+		df:      make(map[string]int),
+		builtAt: time.Now(),
+	}
+	total := 0
+	for i, d := range docs {
+		tokens := tokenize(d.SectionPath + " " + d.PageTitle + " " + d.Text)
+		tf := make(map[string]int, len(tokens))
+		for _, t := range tokens {
+			tf[t]++
+		}
+		for t := range tf {
+			idx.df[t]++
+		}
+		idx.terms[i] = tf
+		idx.lengths[i] = len(tokens)
+		total += len(tokens)
+	}
+	if len(docs) > 0 {
+		idx.avgLen = float64(total) / float64(len(docs))
+	}
+	return idx
+}
+
+func (idx *keywordIndex) search(query string, limit int) []RetrievedChunk {
+	queryTerms := uniqueTerms(tokenize(query))
+	if len(queryTerms) == 0 || len(idx.docs) == 0 {
+		return nil
+	}
+
+	n := float64(len(idx.docs))
+	type scored struct {
+		doc      int
+		score    float64
+		coverage float64
+	}
+	var hits []scored
+
+	for i, tf := range idx.terms {
+		score, matched := 0.0, 0
+		docLen := float64(idx.lengths[i])
+		for _, term := range queryTerms {
+			f, ok := tf[term]
+			if !ok {
+				continue
+			}
+			matched++
+			df := float64(idx.df[term])
+			idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+			norm := float64(f) * (bm25K1 + 1) / (float64(f) + bm25K1*(1-bm25B+bm25B*docLen/idx.avgLen))
+			score += idf * norm
+		}
+		if matched == 0 {
+			continue
+		}
+		hits = append(hits, scored{doc: i, score: score, coverage: float64(matched) / float64(len(queryTerms))})
+	}
+
+	sort.Slice(hits, func(i, j int) bool { return hits[i].score > hits[j].score })
+	if len(hits) > limit {
+		hits = hits[:limit]
+	}
+
+	result := make([]RetrievedChunk, 0, len(hits))
+	for _, h := range hits {
+		c := idx.docs[h.doc]
+		c.Score = 0 // keyword hits carry no vector similarity
+		c.KeywordHit = h.coverage
+		result = append(result, c)
+	}
+	return result
+}
+
+var keywordStopwords = map[string]bool{
+	"a": true, "an": true, "the": true, "is": true, "are": true, "was": true, "be": true,
+	"to": true, "of": true, "in": true, "on": true, "for": true, "and": true, "or": true,
+	"do": true, "does": true, "you": true, "your": true, "i": true, "me": true, "my": true,
+	"we": true, "it": true, "this": true, "that": true, "what": true, "how": true,
+	"can": true, "with": true, "have": true, "has": true, "about": true, "please": true,
+}
+
+// tokenize lowercases and splits on anything that isn't a letter, digit or
+// combining mark (so Bengali words stay whole).
+func tokenize(text string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && !unicode.IsMark(r)
+	})
+	tokens := fields[:0]
+	for _, f := range fields {
+		if keywordStopwords[f] {
+			continue
+		}
+		tokens = append(tokens, f)
+	}
+	return tokens
+}
+
+func uniqueTerms(tokens []string) []string {
+	seen := make(map[string]bool, len(tokens))
+	out := make([]string, 0, len(tokens))
+	for _, t := range tokens {
+		if !seen[t] {
+			seen[t] = true
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// ── Qdrant scroll (keyword corpus) ────────────────────────────────────────────
+
+type qdrantScrollRequest struct {
+	Limit       int         `json:"limit"`
+	Offset      interface{} `json:"offset,omitempty"`
+	WithPayload bool        `json:"with_payload"`
+	WithVector  bool        `json:"with_vector"`
+}
+
+type qdrantScrollResponse struct {
+	Result struct {
+		Points         []qdrantPoint `json:"points"`
+		NextPageOffset interface{}   `json:"next_page_offset"`
+	} `json:"result"`
+	Status string `json:"status"`
+}
+
+// scrollQdrant pages through a company collection and returns up to maxPoints chunks.
+func scrollQdrant(ctx context.Context, companyID string, maxPoints int) ([]RetrievedChunk, error) {
+	url := fmt.Sprintf("%s/collections/%s/points/scroll", qdrantURL, collectionName(companyID))
+	httpClient := &http.Client{Timeout: 15 * time.Second}
+
+	var chunks []RetrievedChunk
+	var offset interface{}
+	for len(chunks) < maxPoints {
+		body, err := json.Marshal(qdrantScrollRequest{
+			Limit:       min(256, maxPoints-len(chunks)),
+			Offset:      offset,
+			WithPayload: true,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if qdrantAPIKey != "" {
+			req.Header.Set("api-key", qdrantAPIKey)
+		}
+
+		res, err := httpClient.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("qdrant scroll failed: %w", err)
+		}
+		if res.StatusCode == http.StatusNotFound {
+			res.Body.Close()
+			return nil, ErrCollectionNotFound
+		}
+		if res.StatusCode != http.StatusOK {
+			b, _ := io.ReadAll(res.Body)
+			res.Body.Close()
+			return nil, fmt.Errorf("qdrant scroll error %d: %s", res.StatusCode, string(b))
+		}
+
+		var page qdrantScrollResponse
+		err = json.NewDecoder(res.Body).Decode(&page)
+		res.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		chunks = append(chunks, parseChunks(page.Result.Points)...)
+		if page.Result.NextPageOffset == nil || len(page.Result.Points) == 0 {
+			break
+		}
+		offset = page.Result.NextPageOffset
+	}
+	return chunks, nil
+}
+
+// ── Optional rerank ───────────────────────────────────────────────────────────
+
+// rerankChunks asks a small model to grade each fused passage against the
+// query and reorders by that grade, keeping fusion order as the tie-break.
+func rerankChunks(ctx context.Context, query string, chunks []RetrievedChunk) ([]RetrievedChunk, error) {
+	var sb strings.Builder
+	sb.WriteString("Rate how well each passage answers the customer question, from 0 (unrelated) to 10 (answers it directly).\n")
+	sb.WriteString("Reply with ONLY a JSON array of numbers, one per passage, in the same order.\n\n")
+	sb.WriteString(fmt.Sprintf("Question: %s\n\n", query))
+	for i, c := range chunks {
+		text := strings.TrimSpace(c.Text)
+		if runes := []rune(text); len(runes) > 600 {
+			text = string(runes[:600])
+		}
+		sb.WriteString(fmt.Sprintf("Passage %d:\n%s\n\n", i+1, text))
+	}
+
+	text, err := completeText(ctx, openai.ChatModelGPT4oMini, sb.String())
+	if err != nil {
+		return nil, err
+	}
+
+	out := strings.TrimSpace(text)
+	out = strings.TrimPrefix(strings.TrimSuffix(out, "```"), "```json")
+	var grades []float64
+	if err := json.Unmarshal([]byte(strings.TrimSpace(out)), &grades); err != nil {
+		return nil, fmt.Errorf("rerank output not parseable: %w", err)
+	}
+	if len(grades) != len(chunks) {
+		return nil, fmt.Errorf("rerank returned %d grades for %d passages", len(grades), len(chunks))
+	}
+
+	reranked := make([]RetrievedChunk, len(chunks))
+	idx := make([]int, len(chunks))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.SliceStable(idx, func(a, b int) bool { return grades[idx[a]] > grades[idx[b]] })
+	for pos, i := range idx {
+		reranked[pos] = chunks[i]
+	}
+	return reranked, nil
+}
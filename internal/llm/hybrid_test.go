@@ -0,0 +1,116 @@
+package llm
+
+import (
+	"context"
+	"math"
+	"testing"
+)
+
+func TestFuseRRF(t *testing.T) {
+	chunk := func(id string) RetrievedChunk { return RetrievedChunk{ID: id} }
+	ids := func(chunks []RetrievedChunk) []string {
+		out := make([]string, len(chunks))
+		for i, c := range chunks {
+			out[i] = c.ID
+		}
+		return out
+	}
+
+	cases := []struct {
+		name    string
+		vector  []RetrievedChunk
+		keyword []RetrievedChunk
+		cfg     HybridConfig
+		want    []string
+	}{
+		{
+			name:   "vectors only keep their order",
+			vector: []RetrievedChunk{chunk("a"), chunk("b"), chunk("c")},
+			cfg:    HybridConfig{VectorWeight: 1, KeywordWeight: 1, RRFK: 60},
+			want:   []string{"a", "b", "c"},
+		},
+		{
+			name:    "found by both lists beats first place in one",
+			vector:  []RetrievedChunk{chunk("a"), chunk("b")},
+			keyword: []RetrievedChunk{chunk("c"), chunk("b")},
+			cfg:     HybridConfig{VectorWeight: 1, KeywordWeight: 1, RRFK: 60},
+			want:    []string{"b", "a", "c"},
+		},
+		{
+			name:    "keyword weight wins ties for first place",
+			vector:  []RetrievedChunk{chunk("a")},
+			keyword: []RetrievedChunk{chunk("c")},
+			cfg:     HybridConfig{VectorWeight: 1, KeywordWeight: 2, RRFK: 60},
+			want:    []string{"c", "a"},
+		},
+		{
+			name:    "zero keyword weight ranks keyword-only hits last",
+			vector:  []RetrievedChunk{chunk("a"), chunk("b")},
+			keyword: []RetrievedChunk{chunk("c"), chunk("b")},
+			cfg:     HybridConfig{VectorWeight: 1, KeywordWeight: 0, RRFK: 60},
+			want:    []string{"a", "b", "c"},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := ids(fuseRRF(c.vector, c.keyword, c.cfg))
+			if len(got) != len(c.want) {
+				t.Fatalf("fused %v, want %v", got, c.want)
+			}
+			for i := range got {
+				if got[i] != c.want[i] {
+					t.Fatalf("fused %v, want %v", got, c.want)
+				}
+			}
+		})
+	}
+}
+
+func TestFuseRRFScores(t *testing.T) {
+	vector := []RetrievedChunk{{ID: "a", Score: 0.9}, {ID: "b", Score: 0.4}}
+	keyword := []RetrievedChunk{{ID: "b", KeywordHit: 3.5}}
+	fused := fuseRRF(vector, keyword, HybridConfig{VectorWeight: 1, KeywordWeight: 1, RRFK: 60})
+
+	b := fused[0]
+	if b.ID != "b" {
+		t.Fatalf("top chunk %q, want b", b.ID)
+	}
+	if want := 1.0/62 + 1.0/61; math.Abs(b.FusedScore-want) > 1e-12 {
+		t.Errorf("fused score %v, want %v", b.FusedScore, want)
+	}
+	// the original signals survive fusion for the relevance gate
+	if b.Score != 0.4 || b.KeywordHit != 3.5 {
+		t.Errorf("score %v, keyword hit %v", b.Score, b.KeywordHit)
+	}
+}
+
+func TestRetrieveHybridWithFakeProvider(t *testing.T) {
+	const companyID = "hybrid-test"
+	useFakes(t, companyID,
+		"Returns are accepted within 30 days of delivery with the original receipt.",
+		"We ship to every district in Bangladesh; delivery takes three to five days.",
+		"Gift cards can be redeemed online and in our Dhanmondi store.",
+	)
+	pinConfig(t, companyID, AIConfig{})
+
+	cases := []struct {
+		query string
+		want  string
+	}{
+		{"how many days do I have for returns", "a"},
+		{"how long does delivery take to my district", "b"},
+		{"can I redeem gift cards in the store", "c"},
+	}
+	for _, c := range cases {
+		got, err := Retrieve(context.Background(), companyID, c.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got.Chunks) == 0 || got.Chunks[0].ID != c.want {
+			t.Errorf("%q: top chunk %v, want %s", c.query, got.Chunks, c.want)
+		}
+		if got.Chunks[0].FusedScore <= 0 {
+			t.Errorf("%q: no fused score", c.query)
+		}
+	}
+}
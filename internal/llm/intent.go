@@ -0,0 +1,250 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+
+	"github.com/openai/openai-go/v3"
+)
+
+// ── Intent classification ─────────────────────────────────────────────────────
+
+type Intent string
+
+const (
+	IntentGreeting     Intent = "greeting"
+	IntentSmallTalk    Intent = "small_talk"
+	IntentQuestion     Intent = "question"
+	IntentHumanRequest Intent = "human_request"
+	IntentComplaint    Intent = "complaint"
+	IntentOffTopic     Intent = "off_topic"
+)
+
+var allIntents = []Intent{
+	IntentGreeting, IntentSmallTalk, IntentQuestion,
+	IntentHumanRequest, IntentComplaint, IntentOffTopic,
+}
+
+// IntentResult is a classifier's verdict for one message.
+type IntentResult struct {
+	Intent     Intent
+	Confidence float64 // 0..1
+	Classifier string
+}
+
+// IntentClassifier labels a customer message before retrieval.
+type IntentClassifier interface {
+	Classify(ctx context.Context, query string) (IntentResult, error)
+}
+
+var (
+	// below this confidence the message is treated as a question, so a
+	// shaky guess never costs the customer a real answer
+	minIntentConfidence = 0.45
+
+	centroid = &centroidClassifier{temperature: 0.05}
+	llmJudge = &llmClassifier{model: openai.ChatModelGPT4oMini}
+)
+
+// classifierFor picks the company's classifier ("centroid" or "llm").
+func classifierFor(cfg AIConfig) IntentClassifier {
+	if cfg.IntentClassifier == "llm" {
+		return llmJudge
+	}
+	return centroid
+}
+
+// classifyIntent never fails: errors and low confidence fall back to question.
+func classifyIntent(ctx context.Context, cfg AIConfig, query string) IntentResult {
+	classifier := classifierFor(cfg)
+	result, err := classifier.Classify(ctx, query)
+	if err != nil {
+		fmt.Println("intent classifier error:", err)
+		return IntentResult{Intent: IntentQuestion, Classifier: "fallback"}
+	}
+	if result.Confidence < minIntentConfidence && result.Intent != IntentQuestion {
+		return IntentResult{Intent: IntentQuestion, Confidence: result.Confidence, Classifier: result.Classifier}
+	}
+	return result
+}
+
+// ── Embedding nearest-centroid ────────────────────────────────────────────────
+
+// intentExemplars seed one centroid per intent. English and Bengali (script
+// and romanised) side by side, since those are most of our traffic.
+var intentExemplars = map[Intent][]string{
+	IntentGreeting: {
+		"hi", "hello", "hey there", "good morning", "good evening", "assalamu alaikum",
+		"salam", "হ্যালো", "আস্সালামু আলাইকুম", "নমস্কার", "hola", "bonjour",
+	},
+	IntentSmallTalk: {
+		"how are you", "who are you", "are you a bot", "are you human", "thank you so much",
+		"thanks", "ok cool", "bye, take care", "what can you do", "কেমন আছেন", "ধন্যবাদ", "you are funny",
+	},
+	IntentQuestion: {
+		"what are your opening hours", "how much does the premium plan cost", "do you deliver to Chittagong",
+		"how do I reset my password", "what is your refund policy", "is SKU AB-1234 in stock",
+		"can I book a table for four tonight", "what does error code E503 mean", "ডেলিভারি চার্জ কত",
+		"আপনাদের অফিস কোথায়", "which payment methods do you accept", "does the basic plan include support",
+	},
+	IntentHumanRequest: {
+		"I want to talk to a human", "connect me to an agent", "can I speak to a real person",
+		"transfer me to customer service", "let me talk to someone from your team", "call me please",
+		"agent please", "মানুষের সাথে কথা বলতে চাই", "একজন প্রতিনিধির সাথে যোগাযোগ করিয়ে দিন", "human support",
+	},
+	IntentComplaint: {
+		"this is unacceptable", "my order never arrived and nobody answers", "I am very disappointed with your service",
+		"you charged me twice", "the product is broken and I want my money back", "worst experience ever",
+		"I've been waiting for two weeks", "আমি খুবই বিরক্ত", "আমার অর্ডার এখনো আসেনি", "your app keeps crashing",
+	},
+	IntentOffTopic: {
+		"what's the weather today", "write me a poem about cats", "who won the football match yesterday",
+		"solve this math homework", "tell me a joke about politics", "what is the capital of france",
+		"can you write my essay", "recommend a movie", "আজকের আবহাওয়া কেমন", "translate this song for me",
+	},
+}
+
+type centroidClassifier struct {
+	mu          sync.Mutex
+	centroids   map[Intent][]float64
+	temperature float64 // softmax sharpness over cosine similarities
+}
+
+func (c *centroidClassifier) Classify(ctx context.Context, query string) (IntentResult, error) {
+	centroids, err := c.load(ctx)
+	if err != nil {
+		return IntentResult{}, err
+	}
+	vec, err := embedQuery(ctx, query) // cached; retrieval reuses the same vector
+	if err != nil {
+		return IntentResult{}, err
+	}
+
+	sims := make(map[Intent]float64, len(centroids))
+	best, bestSim := IntentQuestion, math.Inf(-1)
+	for intent, ctr := range centroids {
+		sim := cosineSimilarity(vec, ctr)
+		sims[intent] = sim
+		if sim > bestSim {
+			best, bestSim = intent, sim
+		}
+	}
+
+	// softmax over similarities gives a confidence that reflects the margin
+	var total float64
+	for _, sim := range sims {
+		total += math.Exp((sim - bestSim) / c.temperature)
+	}
+	return IntentResult{Intent: best, Confidence: 1 / total, Classifier: "centroid"}, nil
+}
+
+// load embeds the exemplars once; a failed attempt is retried on the next call.
+func (c *centroidClassifier) load(ctx context.Context) (map[Intent][]float64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.centroids != nil {
+		return c.centroids, nil
+	}
+
+	var texts []string
+	var owners []Intent
+	for _, intent := range allIntents {
+		for _, ex := range intentExemplars[intent] {
+			texts = append(texts, ex)
+			owners = append(owners, intent)
+		}
+	}
+	vectors, err := EmbedTexts(ctx, texts)
+	if err != nil {
+		return nil, fmt.Errorf("embedding intent exemplars: %w", err)
+	}
+
+	sums := make(map[Intent][]float64)
+	counts := make(map[Intent]int)
+	for i, v := range vectors {
+		v = normalise(v)
+		sum := sums[owners[i]]
+		if sum == nil {
+			sum = make([]float64, len(v))
+			sums[owners[i]] = sum
+		}
+		for j := range v {
+			sum[j] += v[j]
+		}
+		counts[owners[i]]++
+	}
+	for intent, sum := range sums {
+		for j := range sum {
+			sum[j] /= float64(counts[intent])
+		}
+	}
+
+	c.centroids = sums
+	return c.centroids, nil
+}
+
+func normalise(v []float64) []float64 {
+	var norm float64
+	for _, x := range v {
+		norm += x * x
+	}
+	if norm == 0 {
+		return v
+	}
+	norm = math.Sqrt(norm)
+	out := make([]float64, len(v))
+	for i, x := range v {
+		out[i] = x / norm
+	}
+	return out
+}
+
+// ── LLM-backed ────────────────────────────────────────────────────────────────
+
+type llmClassifier struct {
+	model string
+}
+
+func (c *llmClassifier) Classify(ctx context.Context, query string) (IntentResult, error) {
+	var sb strings.Builder
+	sb.WriteString("Classify the customer's message to a company support chat.\n\n")
+	sb.WriteString("Labels:\n")
+	sb.WriteString("- greeting: only a hello, no request\n")
+	sb.WriteString("- small_talk: chit-chat, thanks, goodbyes, questions about the assistant itself\n")
+	sb.WriteString("- question: asks about the company's products, services, prices, policies, orders or anything it could answer\n")
+	sb.WriteString("- human_request: wants a human agent or a call back\n")
+	sb.WriteString("- complaint: expresses dissatisfaction or reports a problem with the company\n")
+	sb.WriteString("- off_topic: unrelated to the company (weather, homework, trivia, jokes)\n\n")
+	sb.WriteString("Messages may be in Bengali or English. When unsure, choose question.\n")
+	sb.WriteString(`Reply with ONLY JSON: {"intent": "<label>", "confidence": <0..1>}` + "\n\n")
+	sb.WriteString(fmt.Sprintf("Message: %s\n", query))
+
+	text, err := completeText(ctx, c.model, sb.String())
+	if err != nil {
+		return IntentResult{}, err
+	}
+
+	out := strings.TrimSpace(text)
+	out = strings.TrimSpace(strings.TrimPrefix(strings.TrimSuffix(out, "```"), "```json"))
+	var verdict struct {
+		Intent     string  `json:"intent"`
+		Confidence float64 `json:"confidence"`
+	}
+	if err := json.Unmarshal([]byte(out), &verdict); err != nil {
+		return IntentResult{}, fmt.Errorf("classifier output not parseable: %w", err)
+	}
+	for _, intent := range allIntents {
+		if string(intent) == verdict.Intent {
+			return IntentResult{
+				Intent:     intent,
+				Confidence: math.Max(0, math.Min(1, verdict.Confidence)),
+				Classifier: "llm",
+			}, nil
+		}
+	}
+	return IntentResult{}, fmt.Errorf("classifier returned unknown intent %q", verdict.Intent)
+}
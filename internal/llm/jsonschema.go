@@ -0,0 +1,159 @@
+package llm
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"slices"
+)
+
+// ── Tool argument validation ──────────────────────────────────────────────────
+//
+// validateJSONSchema checks decoded JSON (encoding/json types) against the
+// subset of JSON schema tool definitions use: type, properties, required,
+// additionalProperties: false, enum, items, minLength/maxLength,
+// minimum/maximum and pattern. Anything else in the schema is ignored.
+
+func validateJSONSchema(schema map[string]any, value any) error {
+	return validateSchemaAt("arguments", schema, value)
+}
+
+func validateSchemaAt(path string, schema map[string]any, value any) error {
+	if schema == nil {
+		return nil
+	}
+
+	if typ, ok := schema["type"].(string); ok && !schemaTypeMatches(typ, value) {
+		return fmt.Errorf("%s must be %s", path, withArticle(typ))
+	}
+
+	if enum, ok := schema["enum"].([]any); ok {
+		found := false
+		for _, allowed := range enum {
+			if fmt.Sprint(allowed) == fmt.Sprint(value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%s must be one of %v", path, enum)
+		}
+	}
+
+	switch v := value.(type) {
+	case map[string]any:
+		props, _ := schema["properties"].(map[string]any)
+		for _, name := range schemaStrings(schema["required"]) {
+			if _, ok := v[name]; !ok {
+				return fmt.Errorf("%s.%s is required", path, name)
+			}
+		}
+		for name, field := range v {
+			sub, known := props[name].(map[string]any)
+			if !known {
+				if extra, ok := schema["additionalProperties"].(bool); ok && !extra {
+					return fmt.Errorf("%s.%s is not allowed", path, name)
+				}
+				continue
+			}
+			if err := validateSchemaAt(path+"."+name, sub, field); err != nil {
+				return err
+			}
+		}
+
+	case []any:
+		if items, ok := schema["items"].(map[string]any); ok {
+			for i, item := range v {
+				if err := validateSchemaAt(fmt.Sprintf("%s[%d]", path, i), items, item); err != nil {
+					return err
+				}
+			}
+		}
+
+	case string:
+		length := len([]rune(v))
+		if n, ok := schemaNumber(schema["minLength"]); ok && float64(length) < n {
+			return fmt.Errorf("%s must be at least %v characters", path, n)
+		}
+		if n, ok := schemaNumber(schema["maxLength"]); ok && float64(length) > n {
+			return fmt.Errorf("%s must be at most %v characters", path, n)
+		}
+		if pattern, ok := schema["pattern"].(string); ok {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return fmt.Errorf("%s: bad pattern in schema: %w", path, err)
+			}
+			if !re.MatchString(v) {
+				return fmt.Errorf("%s does not match %s", path, pattern)
+			}
+		}
+
+	case float64:
+		if n, ok := schemaNumber(schema["minimum"]); ok && v < n {
+			return fmt.Errorf("%s must be at least %v", path, n)
+		}
+		if n, ok := schemaNumber(schema["maximum"]); ok && v > n {
+			return fmt.Errorf("%s must be at most %v", path, n)
+		}
+	}
+	return nil
+}
+
+func schemaTypeMatches(typ string, value any) bool {
+	switch typ {
+	case "object":
+		_, ok := value.(map[string]any)
+		return ok
+	case "array":
+		_, ok := value.([]any)
+		return ok
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	case "integer":
+		n, ok := value.(float64)
+		return ok && n == math.Trunc(n)
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "null":
+		return value == nil
+	}
+	return true // unknown type keyword: don't block the call
+}
+
+func schemaNumber(v any) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case int:
+		return float64(n), true
+	}
+	return 0, false
+}
+
+func schemaStrings(v any) []string {
+	switch list := v.(type) {
+	case []string:
+		return list
+	case []any:
+		out := make([]string, 0, len(list))
+		for _, item := range list {
+			if s, ok := item.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+func withArticle(typ string) string {
+	if slices.Contains([]string{"object", "array", "integer"}, typ) {
+		return "an " + typ
+	}
+	return "a " + typ
+}
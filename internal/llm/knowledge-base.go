@@ -0,0 +1,204 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// ── Knowledge base writes (ingestion) ─────────────────────────────────────────
+
+// embeddingDimensions matches text-embedding-3-large, the model used for queries.
+const embeddingDimensions = 3072
+
+// embedBatchSize keeps each embeddings request well under the API input limit.
+const embedBatchSize = 64
+
+// KnowledgeChunk is one chunk to store. The payload keys are the ones
+// parseChunks reads back at query time.
+type KnowledgeChunk struct {
+	ID          string
+	Vector      []float64
+	Text        string
+	SectionPath string
+	Intent      string
+	SourceType  string
+	SourceURL   string
+	PageTitle   string
+	Language    string
+	FileName    string
+	Domain      string
+	SourceKey   string // identifies the upload; see SourceRef
+}
+
+func (c KnowledgeChunk) payload() map[string]interface{} {
+	p := map[string]interface{}{
+		"text":         c.Text,
+		"section_path": c.SectionPath,
+		"intent":       c.Intent,
+		"source_type":  c.SourceType,
+		"source_url":   c.SourceURL,
+		"page_title":   c.PageTitle,
+		"language":     c.Language,
+		"file_name":    c.FileName,
+	}
+	if c.Domain != "" {
+		p["domain"] = c.Domain
+	}
+	if c.SourceKey != "" {
+		p["source_key"] = c.SourceKey
+	}
+	return p
+}
+
+// EmbedTexts embeds documents in batches. Unlike embedQuery it bypasses the
+// query LRU — ingested chunks are rarely embedded twice.
+func EmbedTexts(ctx context.Context, texts []string) ([][]float64, error) {
+	vectors := make([][]float64, 0, len(texts))
+
+	for start := 0; start < len(texts); start += embedBatchSize {
+		batch := texts[start:min(start+embedBatchSize, len(texts))]
+		out, err := createEmbeddings(ctx, batch)
+		if err != nil {
+			return nil, err
+		}
+		vectors = append(vectors, out...)
+	}
+	return vectors, nil
+}
+
+// EnsureCollection creates the company's collection if it doesn't exist yet.
+func EnsureCollection(ctx context.Context, companyID string) error {
+	return store.EnsureCollection(ctx, companyID)
+}
+
+// DeleteSource removes the points of one source (URL or file) that aren't in
+// keep. Upsert the new copy first, then drop what it didn't overwrite, so a
+// failed re-upload never leaves the company without the document.
+func DeleteSource(ctx context.Context, companyID string, source SourceRef, keep []string) error {
+	if err := store.DeleteSource(ctx, companyID, source, keep); err != nil {
+		return err
+	}
+	InvalidateCompany(companyID)
+	return nil
+}
+
+// UpsertChunks writes chunks into the company collection and drops the
+// company's cached profile and keyword index.
+func UpsertChunks(ctx context.Context, companyID string, chunks []KnowledgeChunk) error {
+	if len(chunks) == 0 {
+		return nil
+	}
+	if err := store.Upsert(ctx, companyID, chunks); err != nil {
+		return err
+	}
+	InvalidateCompany(companyID)
+	return nil
+}
+
+// ── Qdrant writes ─────────────────────────────────────────────────────────────
+
+// EnsureCollection creates company_<id> if it doesn't exist yet.
+func (qdrantStore) EnsureCollection(ctx context.Context, companyID string) error {
+	url := fmt.Sprintf("%s/collections/%s", qdrantURL, collectionName(companyID))
+
+	res, err := qdrantDo(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	if res.StatusCode == http.StatusOK {
+		return nil
+	}
+	if res.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("qdrant collection lookup error %d", res.StatusCode)
+	}
+
+	body := map[string]interface{}{
+		"vectors": map[string]interface{}{
+			"size":     embeddingDimensions,
+			"distance": "Cosine",
+		},
+	}
+	return qdrantExpectOK(ctx, http.MethodPut, url, body)
+}
+
+func (qdrantStore) DeleteSource(ctx context.Context, companyID string, source SourceRef, keep []string) error {
+	url := fmt.Sprintf("%s/collections/%s/points/delete?wait=true", qdrantURL, collectionName(companyID))
+	match := func(key, value string) map[string]interface{} {
+		return map[string]interface{}{"key": key, "match": map[string]interface{}{"value": value}}
+	}
+	should := []map[string]interface{}{match("source_key", source.Key)}
+	if source.LegacyField != "" {
+		should = append(should, map[string]interface{}{
+			"must": []map[string]interface{}{
+				match(source.LegacyField, source.LegacyValue),
+				{"is_empty": map[string]interface{}{"key": "source_key"}},
+			},
+		})
+	}
+	filter := map[string]interface{}{"should": should}
+	if len(keep) > 0 {
+		filter["must_not"] = []map[string]interface{}{{"has_id": keep}}
+	}
+	return qdrantExpectOK(ctx, http.MethodPost, url, map[string]interface{}{"filter": filter})
+}
+
+func (qdrantStore) Upsert(ctx context.Context, companyID string, chunks []KnowledgeChunk) error {
+	url := fmt.Sprintf("%s/collections/%s/points?wait=true", qdrantURL, collectionName(companyID))
+
+	points := make([]map[string]interface{}, 0, len(chunks))
+	for _, c := range chunks {
+		points = append(points, map[string]interface{}{
+			"id":      c.ID,
+			"vector":  c.Vector,
+			"payload": c.payload(),
+		})
+	}
+
+	return qdrantExpectOK(ctx, http.MethodPut, url, map[string]interface{}{"points": points})
+}
+
+func qdrantExpectOK(ctx context.Context, method, url string, body interface{}) error {
+	res, err := qdrantDo(ctx, method, url, body)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		b, _ := io.ReadAll(res.Body)
+		return fmt.Errorf("qdrant error %d: %s", res.StatusCode, string(b))
+	}
+	return nil
+}
+
+func qdrantDo(ctx context.Context, method, url string, body interface{}) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		bodyBytes, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(bodyBytes)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, reader)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if qdrantAPIKey != "" {
+		req.Header.Set("api-key", qdrantAPIKey)
+	}
+
+	httpClient := &http.Client{Timeout: 30 * time.Second}
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("qdrant request failed: %w", err)
+	}
+	return res, nil
+}
@@ -0,0 +1,106 @@
+package llm
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"sync"
+)
+
+// MemoryStore is an in-process VectorStore with brute-force cosine search.
+// Good for offline evaluation and small fixtures, not for production sizes.
+type MemoryStore struct {
+	mu          sync.RWMutex
+	collections map[string][]memoryPoint // company id -> points in insertion order
+}
+
+type memoryPoint struct {
+	id      string
+	vector  []float64
+	payload map[string]interface{}
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{collections: make(map[string][]memoryPoint)}
+}
+
+func (m *MemoryStore) Search(ctx context.Context, companyID string, vector []float64, limit int, threshold float64) ([]RetrievedChunk, error) {
+	m.mu.RLock()
+	points, ok := m.collections[companyID]
+	m.mu.RUnlock()
+	if !ok {
+		return nil, ErrCollectionNotFound
+	}
+
+	hits := make([]qdrantPoint, 0, len(points))
+	for _, p := range points {
+		score := cosineSimilarity(vector, p.vector)
+		if score >= threshold {
+			hits = append(hits, qdrantPoint{ID: p.id, Score: score, Payload: p.payload})
+		}
+	}
+	sort.SliceStable(hits, func(i, j int) bool { return hits[i].Score > hits[j].Score })
+	if len(hits) > limit {
+		hits = hits[:limit]
+	}
+	return parseChunks(hits), nil
+}
+
+func (m *MemoryStore) Scroll(ctx context.Context, companyID string, max int) ([]RetrievedChunk, error) {
+	m.mu.RLock()
+	points, ok := m.collections[companyID]
+	m.mu.RUnlock()
+	if !ok {
+		return nil, ErrCollectionNotFound
+	}
+
+	page := make([]qdrantPoint, 0, min(max, len(points)))
+	for _, p := range points[:min(max, len(points))] {
+		page = append(page, qdrantPoint{ID: p.id, Payload: p.payload})
+	}
+	return parseChunks(page), nil
+}
+
+func (m *MemoryStore) EnsureCollection(ctx context.Context, companyID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.collections[companyID]; !ok {
+		m.collections[companyID] = nil
+	}
+	return nil
+}
+
+func (m *MemoryStore) Upsert(ctx context.Context, companyID string, chunks []KnowledgeChunk) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	points := m.collections[companyID]
+	for _, c := range chunks {
+		p := memoryPoint{id: c.ID, vector: c.Vector, payload: c.payload()}
+		replaced := false
+		for i := range points {
+			if points[i].id == c.ID {
+				points[i], replaced = p, true
+				break
+			}
+		}
+		if !replaced {
+			points = append(points, p)
+		}
+	}
+	m.collections[companyID] = points
+	return nil
+}
+
+func (m *MemoryStore) DeleteSource(ctx context.Context, companyID string, source SourceRef, keep []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	points := m.collections[companyID]
+	kept := points[:0]
+	for _, p := range points {
+		if !source.matches(p.payload) || slices.Contains(keep, p.id) {
+			kept = append(kept, p)
+		}
+	}
+	m.collections[companyID] = kept
+	return nil
+}
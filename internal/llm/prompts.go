@@ -0,0 +1,183 @@
+package llm
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// ── Prompt templates ──────────────────────────────────────────────────────────
+//
+// Prompts live in prompts/<version>/*.tmpl. Built-in versions are embedded in
+// the binary; PROMPT_DIR can point at a directory with the same layout to add
+// or override versions, and its files are re-read when they change. A company
+// picks a version with AIConfig.PromptVersion.
+//
+// A released version is never edited: companies pinned to it keep getting
+// the same prompts. Prompt changes go into a new version directory, which
+// becomes the default.
+
+//go:embed prompts
+var embeddedPrompts embed.FS
+
+var (
+	promptDir            = getEnv("PROMPT_DIR", "")
+	defaultPromptVersion = getEnv("PROMPT_VERSION", "v4")
+
+	// builtinPromptVersion is the embedded fallback when a version, or one of
+	// its templates, is missing or broken (v1 has no handoff prompt).
+	builtinPromptVersion = "v4"
+
+	// how often PROMPT_DIR is checked for edits
+	promptReloadInterval = 5 * time.Second
+)
+
+// promptData is what every template sees.
+type promptData struct {
+	Query    string
+	Profile  CompanyProfile
+	Config   AIConfig
+	Chunks   []RetrievedChunk
+	URLs     []string
+	Relevant bool
+	HasData  bool
+	Intent   Intent
+	Tools    []ToolSpec // offered to the model for this answer
+}
+
+var promptFuncs = template.FuncMap{
+	"trim": strings.TrimSpace,
+	"join": strings.Join,
+}
+
+type promptVersion struct {
+	tmpl      *template.Template
+	fromDisk  bool
+	modTime   time.Time // newest file mtime when loaded from disk
+	checkedAt time.Time
+}
+
+var (
+	promptMu       sync.Mutex
+	promptVersions = make(map[string]*promptVersion)
+)
+
+// renderPrompt executes one named prompt ("greeting", "answer", ...) with the
+// company's prompt version and returns the text plus the version that
+// actually produced it.
+func renderPrompt(cfg AIConfig, name string, data promptData) (string, string) {
+	version := cfg.PromptVersion
+	if version == "" {
+		version = defaultPromptVersion
+	}
+
+	text, err := executePrompt(version, name, data)
+	if err != nil && version != builtinPromptVersion {
+		log.Printf("prompt %s/%s failed, falling back to %s: %v", version, name, builtinPromptVersion, err)
+		version = builtinPromptVersion
+		text, err = executePrompt(version, name, data)
+	}
+	if err != nil {
+		// the embedded templates are broken — still give the model the question
+		log.Printf("builtin prompt %s failed: %v", name, err)
+		return data.Query, "none"
+	}
+	return text, version
+}
+
+func executePrompt(version, name string, data promptData) (string, error) {
+	tmpl, err := promptTemplates(version)
+	if err != nil {
+		return "", err
+	}
+	var sb strings.Builder
+	if err := tmpl.ExecuteTemplate(&sb, name+".tmpl", data); err != nil {
+		return "", err
+	}
+	return strings.TrimRight(sb.String(), "\n"), nil
+}
+
+// promptTemplates returns the parsed templates for a version, reloading
+// PROMPT_DIR/<version> when one of its files has changed.
+func promptTemplates(version string) (*template.Template, error) {
+	if version == "" || strings.ContainsAny(version, `/\.`) {
+		return nil, fmt.Errorf("invalid prompt version %q", version)
+	}
+
+	promptMu.Lock()
+	defer promptMu.Unlock()
+
+	loaded, ok := promptVersions[version]
+	if ok && (promptDir == "" || time.Since(loaded.checkedAt) < promptReloadInterval) {
+		return loaded.tmpl, nil
+	}
+
+	if promptDir != "" {
+		dir := filepath.Join(promptDir, version)
+		if modTime, err := newestModTime(dir); err == nil {
+			if ok && loaded.fromDisk && modTime.Equal(loaded.modTime) {
+				loaded.checkedAt = time.Now()
+				return loaded.tmpl, nil
+			}
+			tmpl, err := template.New(version).Funcs(promptFuncs).ParseGlob(filepath.Join(dir, "*.tmpl"))
+			if err != nil {
+				if ok {
+					// keep serving the last good templates while the edit is fixed
+					log.Printf("prompt reload %s failed: %v", version, err)
+					loaded.checkedAt = time.Now()
+					return loaded.tmpl, nil
+				}
+				return nil, err
+			}
+			if ok {
+				log.Printf("prompt version %s reloaded from %s", version, dir)
+			}
+			promptVersions[version] = &promptVersion{tmpl: tmpl, fromDisk: true, modTime: modTime, checkedAt: time.Now()}
+			return tmpl, nil
+		}
+	}
+
+	if ok && !loaded.fromDisk {
+		loaded.checkedAt = time.Now()
+		return loaded.tmpl, nil
+	}
+
+	sub, err := fs.Sub(embeddedPrompts, "prompts/"+version)
+	if err != nil {
+		return nil, err
+	}
+	tmpl, err := template.New(version).Funcs(promptFuncs).ParseFS(sub, "*.tmpl")
+	if err != nil {
+		return nil, fmt.Errorf("prompt version %s: %w", version, err)
+	}
+	promptVersions[version] = &promptVersion{tmpl: tmpl, checkedAt: time.Now()}
+	return tmpl, nil
+}
+
+func newestModTime(dir string) (time.Time, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.tmpl"))
+	if err != nil {
+		return time.Time{}, err
+	}
+	if len(files) == 0 {
+		return time.Time{}, fs.ErrNotExist
+	}
+	var newest time.Time
+	for _, f := range files {
+		info, err := os.Stat(f)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(newest) {
+			newest = info.ModTime()
+		}
+	}
+	return newest, nil
+}
@@ -0,0 +1,181 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/openai/openai-go/v3"
+	"github.com/openai/openai-go/v3/option"
+	"github.com/openai/openai-go/v3/responses"
+)
+
+// ── Model provider ────────────────────────────────────────────────────────────
+//
+// Provider is the raw model API: one attempt, no retries, no accounting —
+// withRetry and the usage ledger wrap it. The server runs on OpenAI; tests
+// and cmd/rag-eval swap in the offline FakeProvider.
+
+// TokenUsage is what a provider reports for one call.
+type TokenUsage struct {
+	Input  int64
+	Output int64
+}
+
+// ToolSpec is a function the model may call while answering.
+type ToolSpec struct {
+	Name        string
+	Description string
+	Parameters  map[string]any // JSON schema of the arguments
+}
+
+// ToolCall is the model asking for a tool; Arguments is raw JSON.
+type ToolCall struct {
+	CallID    string
+	Name      string
+	Arguments string
+}
+
+// ToolOutput answers one ToolCall.
+type ToolOutput struct {
+	CallID string
+	Output string
+}
+
+// StreamRequest is one model turn: either the first (Prompt) or a
+// continuation that hands back tool results for PreviousResponseID.
+type StreamRequest struct {
+	Model              string
+	Prompt             string
+	Tools              []ToolSpec
+	PreviousResponseID string
+	ToolOutputs        []ToolOutput
+	// OnEvent, if set, is called for every event the provider receives, text
+	// or not, so a turn spent building a tool call doesn't look stalled.
+	OnEvent func()
+}
+
+// StreamResult is how a turn ended. Non-empty ToolCalls means the model is
+// waiting for their outputs before it can finish.
+type StreamResult struct {
+	Usage      TokenUsage
+	ResponseID string
+	ToolCalls  []ToolCall
+}
+
+type Provider interface {
+	Name() string
+	Embed(ctx context.Context, model string, texts []string) ([][]float64, TokenUsage, error)
+	Complete(ctx context.Context, model, prompt string) (string, TokenUsage, error)
+	// Stream sends text deltas to onToken as they arrive.
+	Stream(ctx context.Context, req StreamRequest, onToken func(string)) (StreamResult, error)
+}
+
+var provider Provider = openAIProvider{}
+
+// SetProvider replaces the model provider. Call it once at startup.
+func SetProvider(p Provider) {
+	provider = p
+}
+
+// ── OpenAI ────────────────────────────────────────────────────────────────────
+
+type openAIProvider struct{}
+
+func (openAIProvider) Name() string { return "openai" }
+
+func newOpenAIClient() openai.Client {
+	return openai.NewClient(option.WithAPIKey(LLM_KEY), option.WithMaxRetries(0))
+}
+
+func (openAIProvider) Embed(ctx context.Context, model string, texts []string) ([][]float64, TokenUsage, error) {
+	client := newOpenAIClient()
+	input := openai.EmbeddingNewParamsInputUnion{OfArrayOfStrings: texts}
+	if len(texts) == 1 {
+		input = openai.EmbeddingNewParamsInputUnion{OfString: openai.String(texts[0])}
+	}
+	resp, err := client.Embeddings.New(ctx, openai.EmbeddingNewParams{
+		Model: model,
+		Input: input,
+	})
+	if err != nil {
+		return nil, TokenUsage{}, err
+	}
+	usage := TokenUsage{Input: resp.Usage.PromptTokens}
+	if len(resp.Data) != len(texts) {
+		return nil, usage, fmt.Errorf("embedding returned %d vectors for %d inputs", len(resp.Data), len(texts))
+	}
+
+	vectors := make([][]float64, len(texts))
+	for _, d := range resp.Data {
+		vectors[d.Index] = d.Embedding
+	}
+	return vectors, usage, nil
+}
+
+func (openAIProvider) Complete(ctx context.Context, model, prompt string) (string, TokenUsage, error) {
+	client := newOpenAIClient()
+	resp, err := client.Responses.New(ctx, responses.ResponseNewParams{
+		Model: model,
+		Input: responses.ResponseNewParamsInputUnion{
+			OfString: openai.String(prompt),
+		},
+	})
+	if err != nil {
+		return "", TokenUsage{}, err
+	}
+	return resp.OutputText(), TokenUsage{Input: resp.Usage.InputTokens, Output: resp.Usage.OutputTokens}, nil
+}
+
+func (openAIProvider) Stream(ctx context.Context, req StreamRequest, onToken func(string)) (StreamResult, error) {
+	params := responses.ResponseNewParams{Model: req.Model}
+	if req.PreviousResponseID != "" {
+		params.PreviousResponseID = openai.String(req.PreviousResponseID)
+		items := make(responses.ResponseInputParam, 0, len(req.ToolOutputs))
+		for _, out := range req.ToolOutputs {
+			items = append(items, responses.ResponseInputItemParamOfFunctionCallOutput(out.CallID, out.Output))
+		}
+		params.Input = responses.ResponseNewParamsInputUnion{OfInputItemList: items}
+	} else {
+		params.Input = responses.ResponseNewParamsInputUnion{OfString: openai.String(req.Prompt)}
+	}
+	for _, tool := range req.Tools {
+		fn := responses.ToolParamOfFunction(tool.Name, tool.Parameters, false)
+		fn.OfFunction.Description = openai.String(tool.Description)
+		params.Tools = append(params.Tools, fn)
+	}
+
+	client := newOpenAIClient()
+	stream := client.Responses.NewStreaming(ctx, params)
+	defer stream.Close()
+
+	var result StreamResult
+	var failed error
+	for stream.Next() {
+		event := stream.Current()
+		if req.OnEvent != nil {
+			req.OnEvent()
+		}
+		switch event.Type {
+		case "response.output_text.delta":
+			onToken(event.Delta)
+		case "response.output_item.done":
+			if event.Item.Type == "function_call" {
+				result.ToolCalls = append(result.ToolCalls, ToolCall{
+					CallID:    event.Item.CallID,
+					Name:      event.Item.Name,
+					Arguments: event.Item.Arguments,
+				})
+			}
+		case "response.completed", "response.incomplete":
+			result.ResponseID = event.Response.ID
+			result.Usage = TokenUsage{Input: event.Response.Usage.InputTokens, Output: event.Response.Usage.OutputTokens}
+		case "response.failed":
+			result.Usage = TokenUsage{Input: event.Response.Usage.InputTokens, Output: event.Response.Usage.OutputTokens}
+			failed = fmt.Errorf("response failed: %s", event.Response.Error.Message)
+		}
+	}
+	if err := stream.Err(); err != nil {
+		return result, err
+	}
+	return result, failed
+}
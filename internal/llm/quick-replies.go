@@ -0,0 +1,150 @@
+package llm
+
+import (
+	"butter-time/internal/model"
+	"strings"
+	"unicode/utf8"
+)
+
+// ── Quick replies ─────────────────────────────────────────────────────────────
+//
+// The persona prompt (from prompts v4) lets the model end a reply with one
+// extra line:
+//
+//	QUICK_REPLIES: Track my order | Talk to a human
+//
+// The line is cut out of the stream and comes back as chips in
+// RAGResult.QuickReplies; tapping one sends its title back as a message.
+
+const quickRepliesMarker = "QUICK_REPLIES:"
+
+// HandoffPostback is the payload of the "Talk to a human" chip. The widget
+// asks for a transfer_chat when it comes back.
+const HandoffPostback = "talk_to_human"
+
+const (
+	handoffChipTitle  = "Talk to a human"
+	maxAIQuickReplies = 4
+)
+
+// quickReplyFilter passes the streamed answer through, holding back the start
+// of each line until it's clear it isn't the marker. Everything after the
+// marker is kept for quickReplies.
+type quickReplyFilter struct {
+	emit      func(string)
+	held      string // start of a line that may still become the marker
+	midLine   bool
+	capturing bool
+	captured  strings.Builder
+}
+
+func newQuickReplyFilter(emit func(string)) *quickReplyFilter {
+	return &quickReplyFilter{emit: emit}
+}
+
+func (f *quickReplyFilter) write(text string) {
+	for text != "" {
+		if f.capturing {
+			f.captured.WriteString(text)
+			return
+		}
+		if f.midLine {
+			i := strings.IndexByte(text, '\n')
+			if i < 0 {
+				f.emit(text)
+				return
+			}
+			f.emit(text[:i+1])
+			text = text[i+1:]
+			f.midLine = false
+			continue
+		}
+
+		// at the start of a line: take up to its end
+		chunk := text
+		if i := strings.IndexByte(text, '\n'); i >= 0 {
+			chunk = text[:i+1]
+		}
+		text = text[len(chunk):]
+		f.held += chunk
+
+		line := strings.TrimLeft(f.held, " \t")
+		switch {
+		case strings.HasPrefix(line, quickRepliesMarker):
+			f.capturing = true
+			f.captured.WriteString(line[len(quickRepliesMarker):])
+			f.held = ""
+		case strings.HasSuffix(line, "\n"):
+			f.emit(f.held)
+			f.held = ""
+		case strings.HasPrefix(quickRepliesMarker, line):
+			// could still be the marker, keep holding
+		default:
+			f.emit(f.held)
+			f.held = ""
+			f.midLine = true
+		}
+	}
+}
+
+// flush releases a held line once the stream ends.
+func (f *quickReplyFilter) flush() {
+	if f.held != "" {
+		f.emit(f.held)
+		f.held = ""
+	}
+}
+
+// quickReplies parses what followed the marker: titles split on '|'.
+func (f *quickReplyFilter) quickReplies() []model.QuickReply {
+	var replies []model.QuickReply
+	line, _, _ := strings.Cut(f.captured.String(), "\n")
+	for _, title := range strings.Split(line, "|") {
+		title = strings.Trim(strings.TrimSpace(title), `"'`)
+		if title == "" {
+			continue
+		}
+		if utf8.RuneCountInString(title) > model.MaxQuickReplyTitle {
+			title = string([]rune(title)[:model.MaxQuickReplyTitle])
+		}
+		payload := title
+		if strings.EqualFold(title, handoffChipTitle) {
+			payload = HandoffPostback
+		}
+		replies = addQuickReply(replies, model.QuickReply{Title: title, Payload: payload})
+		if len(replies) == maxAIQuickReplies {
+			break
+		}
+	}
+	return replies
+}
+
+// withHandoffChip adds "Talk to a human" when the customer asked for one or
+// the answer fell short.
+func withHandoffChip(result RAGResult) []model.QuickReply {
+	replies := result.QuickReplies
+	switch {
+	case result.Intent == IntentHumanRequest, result.Intent == IntentComplaint:
+	case result.Relevant && !result.HasData:
+	default:
+		return replies
+	}
+	for _, r := range replies {
+		if r.Payload == HandoffPostback {
+			return replies // the model offered it already
+		}
+	}
+	if len(replies) == maxAIQuickReplies {
+		replies = replies[:maxAIQuickReplies-1]
+	}
+	return append(replies, model.QuickReply{Title: handoffChipTitle, Payload: HandoffPostback})
+}
+
+func addQuickReply(replies []model.QuickReply, reply model.QuickReply) []model.QuickReply {
+	for _, r := range replies {
+		if strings.EqualFold(r.Title, reply.Title) {
+			return replies
+		}
+	}
+	return append(replies, reply)
+}
@@ -0,0 +1,340 @@
+package llm
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ── PII redaction ─────────────────────────────────────────────────────────────
+//
+// Customer text is scrubbed before it is embedded or put into a prompt:
+// detected values become placeholders such as [EMAIL_1]. When the model
+// echoes a placeholder back, the streamed reply gets the value again — in
+// full normally, masked ("**** 4242") when the company runs in strict mode.
+
+// PIIConfig selects the detectors for a company. A nil Detectors list means
+// all of them; an empty list turns redaction off.
+type PIIConfig struct {
+	Detectors []string `json:"detectors"`
+	Strict    bool     `json:"strict"`
+}
+
+const (
+	piiEmail      = "email"
+	piiCard       = "card"
+	piiPhone      = "phone"
+	piiNationalID = "national_id"
+)
+
+// digits in both scripts — customers type Bengali numerals too
+const dg = `[0-9০-৯]`
+
+type piiDetector struct {
+	kind    string
+	label   string
+	pattern *regexp.Regexp
+	digits  bool              // match must not touch other digits
+	valid   func(string) bool // optional extra check
+}
+
+// order matters: cards before phones before national ids, so a card number
+// is never half-eaten by the phone pattern
+var piiDetectors = []piiDetector{
+	{
+		kind:    piiEmail,
+		label:   "EMAIL",
+		pattern: regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`),
+	},
+	{
+		kind:    piiCard,
+		label:   "CARD",
+		pattern: regexp.MustCompile(dg + `(?:[ \-]?` + dg + `){12,18}`),
+		digits:  true,
+		valid:   luhnValid,
+	},
+	{
+		kind:  piiPhone,
+		label: "PHONE",
+		// bangladeshi mobiles (+880 / 0 prefix) and generic international numbers
+		pattern: regexp.MustCompile(`(?:\+?(?:880|৮৮০)[ \-]?|[0০])[1১][3-9৩-৯]` + dg + `{2}[ \-]?` + dg + `{6}|\+` + dg + `{1,3}[ \-]?\(?` + dg + `{1,4}\)?[ \-]?` + dg + `{3,4}[ \-]?` + dg + `{3,4}`),
+		digits:  true,
+	},
+	{
+		kind:  piiNationalID,
+		label: "NATIONAL_ID",
+		// bangladeshi NID: 10 (smart card), 13 or 17 digits
+		pattern: regexp.MustCompile(dg + `{17}|` + dg + `{13}|` + dg + `{10}`),
+		digits:  true,
+	},
+}
+
+func allPIIDetectors() []string {
+	kinds := make([]string, 0, len(piiDetectors))
+	for _, d := range piiDetectors {
+		kinds = append(kinds, d.kind)
+	}
+	return kinds
+}
+
+// piiSet remembers what was replaced in one request, so the same value always
+// maps to the same placeholder and placeholders can be restored.
+type piiSet struct {
+	strict bool
+	values map[string]string // placeholder -> original
+	byText map[string]string // original -> placeholder
+	counts map[string]int
+	kinds  map[string]string // placeholder -> kind
+}
+
+func newPIISet(cfg PIIConfig) *piiSet {
+	return &piiSet{
+		strict: cfg.Strict,
+		values: make(map[string]string),
+		byText: make(map[string]string),
+		counts: make(map[string]int),
+		kinds:  make(map[string]string),
+	}
+}
+
+// redact replaces every enabled detector's matches in text.
+func (p *piiSet) redact(text string, cfg PIIConfig) string {
+	for _, det := range piiDetectors {
+		if !detectorEnabled(cfg, det.kind) {
+			continue
+		}
+		text = p.replace(text, det)
+	}
+	return text
+}
+
+func (p *piiSet) replace(text string, det piiDetector) string {
+	matches := det.pattern.FindAllStringIndex(text, -1)
+	if len(matches) == 0 {
+		return text
+	}
+
+	var sb strings.Builder
+	last := 0
+	for _, m := range matches {
+		value := text[m[0]:m[1]]
+		if det.digits && touchesDigit(text, m[0], m[1]) {
+			continue
+		}
+		if det.valid != nil && !det.valid(value) {
+			continue
+		}
+		sb.WriteString(text[last:m[0]])
+		sb.WriteString(p.placeholder(det, value))
+		last = m[1]
+	}
+	sb.WriteString(text[last:])
+	return sb.String()
+}
+
+func (p *piiSet) placeholder(det piiDetector, value string) string {
+	if ph, ok := p.byText[value]; ok {
+		return ph
+	}
+	p.counts[det.label]++
+	ph := fmt.Sprintf("[%s_%d]", det.label, p.counts[det.label])
+	p.values[ph] = value
+	p.byText[value] = ph
+	p.kinds[ph] = det.kind
+	return ph
+}
+
+// restore returns what a placeholder stands for in the reply.
+func (p *piiSet) restore(placeholder string) (string, bool) {
+	value, ok := p.values[placeholder]
+	if !ok {
+		return "", false
+	}
+	if p.strict {
+		return maskPII(p.kinds[placeholder], value), true
+	}
+	return value, true
+}
+
+// restoreValues puts the real values back even in strict mode — for tool
+// arguments, which go to the company's own system rather than the reply.
+func (p *piiSet) restoreValues(text string) string {
+	if p.empty() {
+		return text
+	}
+	for ph, value := range p.values {
+		text = strings.ReplaceAll(text, ph, value)
+	}
+	return text
+}
+
+func (p *piiSet) empty() bool {
+	return p == nil || len(p.values) == 0
+}
+
+func detectorEnabled(cfg PIIConfig, kind string) bool {
+	for _, d := range cfg.Detectors {
+		if d == kind {
+			return true
+		}
+	}
+	return false
+}
+
+func touchesDigit(text string, start, end int) bool {
+	if start > 0 {
+		r, _ := utf8.DecodeLastRuneInString(text[:start])
+		if unicode.IsDigit(r) {
+			return true
+		}
+	}
+	if end < len(text) {
+		r, _ := utf8.DecodeRuneInString(text[end:])
+		if unicode.IsDigit(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// luhnValid filters random digit runs out of the card detector.
+func luhnValid(s string) bool {
+	var digits []int
+	for _, r := range s {
+		if d, ok := digitValue(r); ok {
+			digits = append(digits, d)
+		}
+	}
+	if len(digits) < 13 {
+		return false
+	}
+	sum := 0
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := digits[i]
+		if (len(digits)-1-i)%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+	}
+	return sum%10 == 0
+}
+
+func digitValue(r rune) (int, bool) {
+	switch {
+	case r >= '0' && r <= '9':
+		return int(r - '0'), true
+	case r >= '০' && r <= '৯':
+		return int(r - '০'), true
+	}
+	return 0, false
+}
+
+// maskPII keeps just enough for the customer to recognise their own value.
+func maskPII(kind, value string) string {
+	switch kind {
+	case piiEmail:
+		at := strings.LastIndex(value, "@")
+		if at <= 0 {
+			return "***"
+		}
+		first, _ := utf8.DecodeRuneInString(value)
+		return string(first) + "***" + value[at:]
+	default:
+		var digits []rune
+		for _, r := range value {
+			if _, ok := digitValue(r); ok {
+				digits = append(digits, r)
+			}
+		}
+		if len(digits) <= 4 {
+			return "****"
+		}
+		return "**** " + string(digits[len(digits)-4:])
+	}
+}
+
+// ── Streaming restore ─────────────────────────────────────────────────────────
+
+// longest placeholder we wait for, e.g. [NATIONAL_ID_12]
+const maxPlaceholderLen = 24
+
+// piiRestorer puts values back into a token stream. A placeholder can be
+// split across tokens ("[EM" + "AIL_1]"), so text from '[' on is held back
+// until it either closes as a known placeholder or clearly isn't one.
+type piiRestorer struct {
+	set     *piiSet
+	emit    func(string)
+	pending strings.Builder
+}
+
+func newPIIRestorer(set *piiSet, emit func(string)) *piiRestorer {
+	return &piiRestorer{set: set, emit: emit}
+}
+
+func (r *piiRestorer) write(token string) {
+	if r.set.empty() {
+		r.emit(token)
+		return
+	}
+
+	var out strings.Builder
+	for _, c := range token {
+		if r.pending.Len() == 0 {
+			if c == '[' {
+				r.pending.WriteRune(c)
+			} else {
+				out.WriteRune(c)
+			}
+			continue
+		}
+
+		r.pending.WriteRune(c)
+		switch {
+		case c == ']':
+			held := r.pending.String()
+			if value, ok := r.set.restore(held); ok {
+				out.WriteString(value)
+			} else {
+				out.WriteString(held)
+			}
+			r.pending.Reset()
+		case c == '[':
+			// a new bracket restarts the candidate
+			held := r.pending.String()
+			out.WriteString(held[:len(held)-1])
+			r.pending.Reset()
+			r.pending.WriteRune('[')
+		case !(c == '_' || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')) || r.pending.Len() > maxPlaceholderLen:
+			out.WriteString(r.pending.String())
+			r.pending.Reset()
+		}
+	}
+	if out.Len() > 0 {
+		r.emit(out.String())
+	}
+}
+
+// flush releases anything still held back once the stream ends.
+func (r *piiRestorer) flush() {
+	if r.pending.Len() > 0 {
+		r.emit(r.pending.String())
+		r.pending.Reset()
+	}
+}
+
+// restoreAll is the non-streaming variant, for drafts built in one piece.
+func (p *piiSet) restoreAll(text string) string {
+	if p.empty() {
+		return text
+	}
+	var sb strings.Builder
+	r := newPIIRestorer(p, func(s string) { sb.WriteString(s) })
+	r.write(text)
+	r.flush()
+	return sb.String()
+}
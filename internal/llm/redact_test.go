@@ -0,0 +1,107 @@
+package llm
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestRedact(t *testing.T) {
+	all := PIIConfig{Detectors: allPIIDetectors()}
+	cases := []struct {
+		name string
+		cfg  PIIConfig
+		in   string
+		want string
+	}{
+		{"email", all, "mail jane.doe@example.com please", "mail [EMAIL_1] please"},
+		{"same value same placeholder", all, "a@b.co or a@b.co", "[EMAIL_1] or [EMAIL_1]"},
+		{"card with luhn", all, "card 4242 4242 4242 4242 ok", "card [CARD_1] ok"},
+		{"card failing luhn stays", all, "ref 1234 5678 9012 3456", "ref 1234 5678 9012 3456"},
+		{"bangladeshi mobile", all, "call 01712345678", "call [PHONE_1]"},
+		{"bengali digits", all, "call ০১৭১২৩৪৫৬৭৮", "call [PHONE_1]"},
+		{"detector disabled", PIIConfig{Detectors: []string{piiPhone}}, "a@b.co 01712345678", "a@b.co [PHONE_1]"},
+		{"redaction off", PIIConfig{Detectors: []string{}}, "a@b.co", "a@b.co"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := newPIISet(c.cfg).redact(c.in, c.cfg); got != c.want {
+				t.Errorf("redact(%q) = %q, want %q", c.in, got, c.want)
+			}
+		})
+	}
+}
+
+func TestPIIRestorerAcrossTokens(t *testing.T) {
+	cfg := PIIConfig{Detectors: allPIIDetectors()}
+	set := newPIISet(cfg)
+	set.redact("I am jane@example.com, card 4242424242424242", cfg)
+
+	reply := "We wrote to [EMAIL_1] about [CARD_1]; see [NOTE] and [EMAIL_9] [EMAIL_[EMAIL_1]"
+	want := "We wrote to jane@example.com about 4242424242424242; see [NOTE] and [EMAIL_9] [EMAIL_jane@example.com"
+
+	// every possible split into two tokens, then one token per byte
+	for i := 0; i <= len(reply); i++ {
+		if got := restoreStream(set, reply[:i], reply[i:]); got != want {
+			t.Fatalf("split at %d: %q, want %q", i, got, want)
+		}
+	}
+	if got := restoreStream(set, strings.Split(reply, "")...); got != want {
+		t.Fatalf("byte tokens: %q, want %q", got, want)
+	}
+
+	// a placeholder the stream never closes is released on flush
+	if got := restoreStream(set, "see [EMA"); got != "see [EMA" {
+		t.Errorf("unclosed placeholder: %q", got)
+	}
+}
+
+func TestPIIRestorerStrictMasks(t *testing.T) {
+	cfg := PIIConfig{Detectors: allPIIDetectors(), Strict: true}
+	set := newPIISet(cfg)
+	set.redact("card 4242424242424242", cfg)
+
+	got := restoreStream(set, "charged [CA", "RD_1] today")
+	if strings.Contains(got, "4242424242424242") || !strings.Contains(got, "4242") {
+		t.Errorf("strict restore = %q, want a masked card", got)
+	}
+	if args := set.restoreValues(`{"card":"[CARD_1]"}`); args != `{"card":"4242424242424242"}` {
+		t.Errorf("tool arguments = %q, want the real value", args)
+	}
+}
+
+// TestPIIRestorerWithFakeStream runs a placeholder through a streamed model
+// reply: the fake provider answers with the context sentence holding it.
+func TestPIIRestorerWithFakeStream(t *testing.T) {
+	useFakes(t, "pii-test")
+	cfg := PIIConfig{Detectors: allPIIDetectors()}
+	set := newPIISet(cfg)
+	question := set.redact("did you send the refund to jane@example.com", cfg)
+
+	prompt := "--- COMPANY INFORMATION ---\n" +
+		"The refund was sent to [EMAIL_1] yesterday.\n" +
+		"Our store opens at nine.\n" +
+		"--- END ---\n" +
+		"Customer question: " + question + "\n"
+
+	var sb strings.Builder
+	restorer := newPIIRestorer(set, func(s string) { sb.WriteString(s) })
+	if _, err := provider.Stream(context.Background(), StreamRequest{Prompt: prompt}, restorer.write); err != nil {
+		t.Fatal(err)
+	}
+	restorer.flush()
+
+	if got, want := sb.String(), "The refund was sent to jane@example.com yesterday."; got != want {
+		t.Errorf("streamed reply = %q, want %q", got, want)
+	}
+}
+
+func restoreStream(set *piiSet, tokens ...string) string {
+	var sb strings.Builder
+	r := newPIIRestorer(set, func(s string) { sb.WriteString(s) })
+	for _, tok := range tokens {
+		r.write(tok)
+	}
+	r.flush()
+	return sb.String()
+}
@@ -0,0 +1,319 @@
+package llm
+
+import (
+	"butter-time/internal/env"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/openai/openai-go/v3"
+)
+
+// ── Resilient model calls ─────────────────────────────────────────────────────
+//
+// Every model call goes through withRetry: a per-call timeout, a few retries
+// with jittered backoff on transient failures (429, 5xx, timeouts, dropped
+// connections) and a circuit breaker per provider so an outage fails fast
+// instead of stacking up waiting customers. The SDK's own retries are off so
+// this is the only retry policy.
+
+var (
+	llmMaxAttempts    = env.Int("LLM_MAX_ATTEMPTS", 3)
+	llmRetryBaseDelay = env.Duration("LLM_RETRY_BASE_DELAY", 300*time.Millisecond)
+	llmRetryMaxDelay  = env.Duration("LLM_RETRY_MAX_DELAY", 4*time.Second)
+
+	embedTimeout      = env.Duration("LLM_EMBED_TIMEOUT", 10*time.Second)
+	completionTimeout = env.Duration("LLM_COMPLETION_TIMEOUT", 30*time.Second)
+	streamTimeout     = env.Duration("LLM_STREAM_TIMEOUT", 2*time.Minute)
+	// no event from the stream for this long = stalled
+	streamIdleTimeout = env.Duration("LLM_STREAM_IDLE_TIMEOUT", 15*time.Second)
+
+	breakerThreshold = env.Int("LLM_BREAKER_THRESHOLD", 5) // consecutive failures
+	breakerCooldown  = env.Duration("LLM_BREAKER_COOLDOWN", 30*time.Second)
+
+	defaultFallbackModel = getEnv("LLM_FALLBACK_MODEL", openai.ChatModelGPT4oMini)
+)
+
+// ErrCircuitOpen is returned without calling the provider while its breaker is open.
+var ErrCircuitOpen = errors.New("llm provider circuit open")
+
+var errStreamStalled = errors.New("llm stream stalled")
+
+// ── Retry ─────────────────────────────────────────────────────────────────────
+
+// noRetry marks a failure that must not be retried, e.g. a stream that broke
+// after the customer already saw part of the answer.
+type noRetry struct{ error }
+
+func (e noRetry) Unwrap() error { return e.error }
+
+// withRetry runs fn with a per-attempt timeout until it succeeds, fails
+// permanently, or runs out of attempts.
+func withRetry(ctx context.Context, op, provider string, timeout time.Duration, fn func(ctx context.Context) error) error {
+	breaker := breakerFor(provider)
+
+	var err error
+	for attempt := 1; attempt <= llmMaxAttempts; attempt++ {
+		if err = breaker.allow(); err != nil {
+			return err
+		}
+
+		callCtx, cancel := context.WithTimeout(ctx, timeout)
+		err = fn(callCtx)
+		cancel()
+		if err == nil {
+			breaker.success()
+			return nil
+		}
+		if ctx.Err() != nil {
+			// the caller gave up (new message, client gone) — not the provider's fault
+			breaker.release()
+			return ctx.Err()
+		}
+		if !providerFailure(err) {
+			// the provider answered, it just didn't like the request
+			breaker.success()
+			return err
+		}
+
+		breaker.failure()
+		var stop noRetry
+		if errors.As(err, &stop) || attempt == llmMaxAttempts {
+			break
+		}
+		delay := backoff(attempt)
+		log.Printf("%s failed (attempt %d/%d), retrying in %s: %v", op, attempt, llmMaxAttempts, delay, err)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return fmt.Errorf("%s: %w", op, err)
+}
+
+// backoff is exponential with full jitter.
+func backoff(attempt int) time.Duration {
+	d := llmRetryBaseDelay << (attempt - 1)
+	if d <= 0 || d > llmRetryMaxDelay {
+		d = llmRetryMaxDelay
+	}
+	return rand.N(d) + time.Millisecond
+}
+
+// providerFailure reports whether err says the provider is struggling rather
+// than that our request was bad.
+func providerFailure(err error) bool {
+	var apiErr *openai.Error
+	if errors.As(err, &apiErr) {
+		switch {
+		case apiErr.StatusCode == http.StatusRequestTimeout,
+			apiErr.StatusCode == http.StatusConflict,
+			apiErr.StatusCode == http.StatusTooManyRequests,
+			apiErr.StatusCode >= 500:
+			return true
+		}
+		return false
+	}
+	// timeouts, resets, EOFs, stalled streams
+	return true
+}
+
+// ── Circuit breaker ───────────────────────────────────────────────────────────
+
+type circuitBreaker struct {
+	mu        sync.Mutex
+	provider  string
+	failures  int
+	openUntil time.Time
+	probing   bool // half-open: one call is testing the provider
+}
+
+var (
+	breakersMu sync.Mutex
+	breakers   = make(map[string]*circuitBreaker)
+)
+
+func breakerFor(provider string) *circuitBreaker {
+	breakersMu.Lock()
+	defer breakersMu.Unlock()
+	b, ok := breakers[provider]
+	if !ok {
+		b = &circuitBreaker{provider: provider}
+		breakers[provider] = b
+	}
+	return b
+}
+
+func (b *circuitBreaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.openUntil.IsZero() {
+		return nil
+	}
+	if time.Now().Before(b.openUntil) || b.probing {
+		return ErrCircuitOpen
+	}
+	b.probing = true
+	return nil
+}
+
+func (b *circuitBreaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.openUntil.IsZero() {
+		log.Printf("llm provider %s recovered, circuit closed", b.provider)
+	}
+	b.failures = 0
+	b.openUntil = time.Time{}
+	b.probing = false
+}
+
+func (b *circuitBreaker) failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	if b.probing || b.failures >= breakerThreshold {
+		if !b.probing {
+			log.Printf("llm provider %s failing (%d in a row), circuit open for %s", b.provider, b.failures, breakerCooldown)
+		}
+		b.openUntil = time.Now().Add(breakerCooldown)
+	}
+	b.probing = false
+}
+
+// release ends a probe that was cancelled by the caller, without a verdict.
+func (b *circuitBreaker) release() {
+	b.mu.Lock()
+	b.probing = false
+	b.mu.Unlock()
+}
+
+// ── Calls ─────────────────────────────────────────────────────────────────────
+
+// completeText runs one non-streaming completion and records its usage.
+func completeText(ctx context.Context, model, prompt string) (string, error) {
+	p := provider
+	var out string
+	err := withRetry(ctx, "completion "+model, p.Name(), completionTimeout, func(callCtx context.Context) error {
+		text, usage, err := p.Complete(callCtx, model, prompt)
+		recordCompletion(ctx, model, usage)
+		out = text
+		return err
+	})
+	return out, err
+}
+
+// createEmbeddings embeds texts in one request and records its usage.
+func createEmbeddings(ctx context.Context, texts []string) ([][]float64, error) {
+	p := provider
+	model := openai.EmbeddingModelTextEmbedding3Large
+	var vectors [][]float64
+	err := withRetry(ctx, "embedding", p.Name(), embedTimeout, func(callCtx context.Context) error {
+		var usage TokenUsage
+		var err error
+		vectors, usage, err = p.Embed(callCtx, model, texts)
+		recordEmbedding(ctx, model, usage.Input)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return vectors, nil
+}
+
+// streamAnswer streams one model turn to onToken. Starting the stream is
+// retried; once a token has reached onToken a failure is final, since the
+// customer has already seen part of the answer.
+func streamAnswer(ctx context.Context, req StreamRequest, onToken func(string)) (StreamResult, error) {
+	p := provider
+	started := false
+	var result StreamResult
+
+	err := withRetry(ctx, "stream "+req.Model, p.Name(), streamTimeout, func(callCtx context.Context) error {
+		streamCtx, cancel := context.WithCancel(callCtx)
+		defer cancel()
+		stalled := time.AfterFunc(streamIdleTimeout, cancel)
+		defer stalled.Stop()
+
+		// any event proves the stream alive, not only text
+		turn := req
+		turn.OnEvent = func() { stalled.Reset(streamIdleTimeout) }
+
+		var err error
+		result, err = p.Stream(streamCtx, turn, func(token string) {
+			stalled.Reset(streamIdleTimeout)
+			started = true
+			if onToken != nil {
+				onToken(token)
+			}
+		})
+		recordCompletion(ctx, req.Model, result.Usage)
+
+		if err != nil && callCtx.Err() == nil && streamCtx.Err() != nil {
+			err = errStreamStalled
+		}
+		if err != nil && started {
+			return noRetry{err}
+		}
+		return err
+	})
+	return result, err
+}
+
+// streamTurns streams an answer, running the tools the model asks for in
+// between turns. The last allowed turn offers no tools, so the model has to
+// answer with what it has; asking for tools anyway ends the answer there.
+func streamTurns(ctx context.Context, model, prompt string, tools *toolRunner, onToken func(string)) error {
+	req := StreamRequest{Model: model, Prompt: prompt, Tools: tools.specs()}
+	for round := 1; ; round++ {
+		if round >= maxToolRounds {
+			req.Tools = nil
+		}
+		result, err := streamAnswer(ctx, req, onToken)
+		if err != nil {
+			return err
+		}
+		if len(result.ToolCalls) == 0 {
+			return nil
+		}
+		if round >= maxToolRounds {
+			return fmt.Errorf("model still asking for tools after %d turns", maxToolRounds)
+		}
+		if result.ResponseID == "" {
+			return fmt.Errorf("model asked for tools without a response id")
+		}
+		req = StreamRequest{
+			Model:              model,
+			Tools:              req.Tools,
+			PreviousResponseID: result.ResponseID,
+			ToolOutputs:        tools.run(ctx, result.ToolCalls),
+		}
+	}
+}
+
+// streamWithFallback streams from the primary model and, if it fails before
+// producing anything, from the fallback model. It returns the model that
+// produced the answer. A tool that already ran is not run again on the
+// fallback — its side effects may not be repeatable.
+func streamWithFallback(ctx context.Context, cfg AIConfig, prompt string, tools *toolRunner, onToken func(string)) (string, error) {
+	started := false
+	emit := func(token string) {
+		started = true
+		if onToken != nil {
+			onToken(token)
+		}
+	}
+
+	err := streamTurns(ctx, cfg.Model, prompt, tools, emit)
+	if err == nil || started || tools.called() || ctx.Err() != nil || cfg.FallbackModel == "" || cfg.FallbackModel == cfg.Model {
+		return cfg.Model, err
+	}
+	log.Printf("model %s failed, falling back to %s: %v", cfg.Model, cfg.FallbackModel, err)
+	return cfg.FallbackModel, streamTurns(ctx, cfg.FallbackModel, prompt, tools, emit)
+}
@@ -522,6 +522,7 @@
 package llm
 
 import (
+	"butter-time/internal/model"
 	"bytes"
 	"context"
 	"encoding/json"
@@ -530,12 +531,9 @@ import (
 	"math"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
 	"time"
-
-	"github.com/openai/openai-go/v3"
-	"github.com/openai/openai-go/v3/option"
-	"github.com/openai/openai-go/v3/responses"
 )
 
 // ── Config ────────────────────────────────────────────────────────────────────
@@ -550,52 +548,6 @@ var (
 // ErrCollectionNotFound is returned when the company has no Qdrant collection yet.
 var ErrCollectionNotFound = fmt.Errorf("knowledge base not found for this company")
 
-// ── Greeting detection ────────────────────────────────────────────────────────
-
-var greetingPhrases = []string{
-	// English
-	"hi", "hello", "hey", "hiya", "howdy", "greetings", "sup", "what's up", "whats up",
-	"good morning", "good afternoon", "good evening", "good night", "good day",
-	// Bengali
-	"salam", "salaam", "assalamu alaikum", "assalamualaikum", "walaikum assalam",
-	"আস্সালামু আলাইকুম", "সালাম", "হ্যালো", "হ্যা", "হেলো",
-	"নমস্কার", "নমস্তে", "কেমন আছেন", "কি খবর", "ভালো আছেন",
-	// Other languages
-	"bonjour", "hola", "ciao", "مرحبا", "السلام عليكم", "shalom", "namaste",
-	"konnichiwa", "ni hao", "merhaba",
-}
-
-// smallTalk catches questions that are conversational but not company-related
-var smallTalkPhrases = []string{
-	"how are you", "how r u", "how are you doing", "what are you", "who are you",
-	"are you a bot", "are you ai", "are you human", "are you real",
-	"what can you do", "can you help me", "help me", "i need help",
-	"thank you", "thanks", "thank u", "thx", "ty",
-	"ok", "okay", "alright", "cool", "great", "nice", "awesome",
-	"bye", "goodbye", "see you", "take care",
-}
-
-func isGreeting(query string) bool {
-	q := strings.ToLower(strings.TrimSpace(query))
-	for _, g := range greetingPhrases {
-		if q == g || strings.HasPrefix(q, g+" ") || strings.HasSuffix(q, " "+g) ||
-			strings.HasPrefix(q, g+"!") || strings.HasPrefix(q, g+",") {
-			return true
-		}
-	}
-	return false
-}
-
-func isSmallTalk(query string) bool {
-	q := strings.ToLower(strings.TrimSpace(query))
-	for _, s := range smallTalkPhrases {
-		if q == s || strings.Contains(q, s) {
-			return true
-		}
-	}
-	return false
-}
-
 func getEnv(key, fallback string) string {
 	if v := os.Getenv(key); v != "" {
 		return v
@@ -613,7 +565,7 @@ type qdrantSearchRequest struct {
 }
 
 type qdrantPoint struct {
-	ID      string                 `json:"id"`
+	ID      interface{}            `json:"id"` // uuid string or unsigned int, depending on the ingester
 	Score   float64                `json:"score"`
 	Payload map[string]interface{} `json:"payload"`
 }
@@ -626,8 +578,11 @@ type qdrantSearchResponse struct {
 // ── RetrievedChunk ────────────────────────────────────────────────────────────
 
 type RetrievedChunk struct {
+	ID          string
 	Text        string
-	Score       float64
+	Score       float64 // vector similarity, 0 for keyword-only hits
+	FusedScore  float64 // reciprocal rank fusion score (hybrid retrieval)
+	KeywordHit  float64 // fraction of query terms found in the chunk text
 	SectionPath string
 	Intent      string
 	SourceType  string
@@ -685,10 +640,17 @@ func inferCompanyProfile(chunks []RetrievedChunk) CompanyProfile {
 // ── RAG Response ──────────────────────────────────────────────────────────────
 
 type RAGResult struct {
-	Answer   string
-	Chunks   []RetrievedChunk
-	Relevant bool
-	HasData  bool
+	AnswerID         string // feedback is filed against this
+	Answer           string
+	QuickReplies     []model.QuickReply // chips to show under the answer
+	Query            string             // as sent to the model, PII redacted
+	Chunks           []RetrievedChunk
+	Relevant         bool
+	HasData          bool
+	PromptVersion    string // template version that produced the prompt
+	Model            string // model that wrote the answer (the fallback, if it took over)
+	Intent           Intent
+	IntentConfidence float64
 }
 
 // ── Public API ────────────────────────────────────────────────────────────────
@@ -700,96 +662,161 @@ func RetrieveAndAnswer(
 	onToken func(token string),
 ) (RAGResult, error) {
 
-	// 1. Handle greetings immediately — no Qdrant needed
-	if isGreeting(userQuery) {
-		// Still search Qdrant to get company profile for a personalised greeting
-		embedding, _ := embedQuery(ctx, "company overview products services")
-		chunks, _ := searchQdrant(ctx, companyID, embedding)
-		profile := inferCompanyProfile(chunks)
-
-		prompt := buildGreetingPrompt(userQuery, profile)
-		var fullAnswer strings.Builder
-		err := streamAnswer(ctx, prompt, func(token string) {
-			fullAnswer.WriteString(token)
-			if onToken != nil {
-				onToken(token)
-			}
-		})
-		if err != nil {
-			return RAGResult{}, fmt.Errorf("streaming greeting: %w", err)
-		}
-		return RAGResult{Answer: fullAnswer.String(), Relevant: true, HasData: true}, nil
+	// 0. Tenant settings: persona, model, retrieval depth, threshold...
+	cfg := LoadAIConfig(companyID)
+	ctx = WithCompany(ctx, companyID)
+	if !toolsAllowed(ctx) {
+		cfg.Tools = nil
 	}
 
-	// 2. Handle small talk
-	if isSmallTalk(userQuery) {
-		embedding, _ := embedQuery(ctx, "company overview products services")
-		chunks, _ := searchQdrant(ctx, companyID, embedding)
-		profile := inferCompanyProfile(chunks)
-
-		prompt := buildSmallTalkPrompt(userQuery, profile)
-		var fullAnswer strings.Builder
-		err := streamAnswer(ctx, prompt, func(token string) {
-			fullAnswer.WriteString(token)
-			if onToken != nil {
-				onToken(token)
-			}
-		})
-		if err != nil {
-			return RAGResult{}, fmt.Errorf("streaming small talk: %w", err)
-		}
-		return RAGResult{Answer: fullAnswer.String(), Relevant: true, HasData: true}, nil
+	// 0a. Quota — out of quota means no model calls at all; close to it
+	// means the cheap path
+	switch checkQuota(companyID, cfg.Quota) {
+	case quotaExceeded:
+		return RAGResult{}, ErrQuotaExceeded
+	case quotaSoftLimit:
+		fmt.Printf("company %s past soft quota limit, using %s\n", companyID, cfg.Quota.SoftLimitModel)
+		cfg = applySoftLimit(cfg)
 	}
 
-	// 3. Embed the actual user query
-	embedding, err := embedQuery(ctx, userQuery)
-	if err != nil {
-		return RAGResult{}, fmt.Errorf("embedding query: %w", err)
+	// 0b. Scrub PII — nothing below sees the raw customer text
+	pii := newPIISet(cfg.PII)
+	userQuery = pii.redact(userQuery, cfg.PII)
+
+	// 1. Classify the message, then branch on the intent
+	intent := classifyIntent(ctx, cfg, userQuery)
+
+	// 2. Conversational intents — no retrieval, just the (cached) company profile
+	switch intent.Intent {
+	case IntentGreeting, IntentSmallTalk, IntentHumanRequest, IntentOffTopic:
+		profile := companyProfile(ctx, cfg, companyID)
+
+		var prompt, promptVersion string
+		relevant := true
+		switch intent.Intent {
+		case IntentGreeting:
+			prompt, promptVersion = buildGreetingPrompt(userQuery, profile, cfg)
+		case IntentSmallTalk:
+			prompt, promptVersion = buildSmallTalkPrompt(userQuery, profile, cfg)
+		case IntentHumanRequest:
+			prompt, promptVersion = buildHandoffPrompt(userQuery, profile, cfg)
+		case IntentOffTopic:
+			relevant = false
+			prompt, promptVersion = buildPrompt(userQuery, nil, profile, false, false, intent.Intent, cfg)
+		}
+
+		answer, quickReplies, usedModel, err := streamReply(ctx, cfg, prompt, pii, nil, onToken)
+		if err != nil {
+			return RAGResult{}, fmt.Errorf("streaming %s: %w", intent.Intent, err)
+		}
+		result := RAGResult{
+			Answer:           answer,
+			QuickReplies:     quickReplies,
+			Query:            userQuery,
+			Relevant:         relevant,
+			HasData:          relevant,
+			PromptVersion:    promptVersion,
+			Model:            usedModel,
+			Intent:           intent.Intent,
+			IntentConfidence: intent.Confidence,
+		}
+		result.QuickReplies = withHandoffChip(result)
+		rememberAnswer(companyID, conversationFrom(ctx), cfg, &result)
+		return result, nil
 	}
 
-	// 4. Search Qdrant
-	chunks, err := searchQdrant(ctx, companyID, embedding)
+	// 3-5. Embed, hybrid search, relevance gate (questions and complaints)
+	retrieval, err := retrieve(ctx, cfg, companyID, userQuery)
 	if err != nil {
 		if err == ErrCollectionNotFound {
-			prompt := buildNoKnowledgeBasePrompt(userQuery)
-			var fullAnswer strings.Builder
-			_ = streamAnswer(ctx, prompt, func(token string) {
-				fullAnswer.WriteString(token)
-				if onToken != nil {
-					onToken(token)
-				}
-			})
-			return RAGResult{Answer: fullAnswer.String(), Relevant: false, HasData: false}, nil
+			prompt, promptVersion := buildNoKnowledgeBasePrompt(userQuery, cfg)
+			answer, quickReplies, usedModel, _ := streamReply(ctx, cfg, prompt, pii, nil, onToken)
+			result := RAGResult{
+				Answer:           answer,
+				QuickReplies:     quickReplies,
+				Query:            userQuery,
+				Relevant:         false,
+				HasData:          false,
+				PromptVersion:    promptVersion,
+				Model:            usedModel,
+				Intent:           intent.Intent,
+				IntentConfidence: intent.Confidence,
+			}
+			result.QuickReplies = withHandoffChip(result)
+			rememberAnswer(companyID, conversationFrom(ctx), cfg, &result)
+			return result, nil
 		}
-		return RAGResult{}, fmt.Errorf("qdrant search: %w", err)
+		return RAGResult{}, err
 	}
+	chunks, relevant, hasData := retrieval.Chunks, retrieval.Relevant, retrieval.HasData
 
-	// 5. Infer company profile from retrieved chunks
+	// 6. Infer company profile from retrieved chunks
 	profile := inferCompanyProfile(chunks)
 
-	// 6. Evaluate relevance
-	relevant, hasData := evaluateRelevance(chunks)
-
 	// 7. Build prompt and stream
-	prompt := buildPrompt(userQuery, chunks, profile, relevant, hasData)
+	prompt, promptVersion := buildPrompt(userQuery, chunks, profile, relevant, hasData, intent.Intent, cfg)
 
-	var fullAnswer strings.Builder
-	err = streamAnswer(ctx, prompt, func(token string) {
-		fullAnswer.WriteString(token)
-		if onToken != nil {
-			onToken(token)
-		}
-	})
+	// the company's tools can fill in what the knowledge base doesn't know
+	// (order status, bookings...)
+	tools := newToolRunner(ctx, cfg, companyID, intent.Intent, pii)
+	answer, quickReplies, usedModel, err := streamReply(ctx, cfg, prompt, pii, tools, onToken)
 	if err != nil {
 		return RAGResult{}, fmt.Errorf("streaming answer: %w", err)
 	}
 
-	return RAGResult{
-		Answer:   fullAnswer.String(),
-		Chunks:   chunks,
-		Relevant: relevant,
-		HasData:  hasData,
-	}, nil
+	result := RAGResult{
+		Answer:           answer,
+		QuickReplies:     quickReplies,
+		Query:            userQuery,
+		Chunks:           chunks,
+		Relevant:         relevant,
+		HasData:          hasData,
+		PromptVersion:    promptVersion,
+		Model:            usedModel,
+		Intent:           intent.Intent,
+		IntentConfidence: intent.Confidence,
+	}
+	result.QuickReplies = withHandoffChip(result)
+	rememberAnswer(companyID, conversationFrom(ctx), cfg, &result)
+	return result, nil
+}
+
+// Retrieval is the retrieval half of RetrieveAndAnswer on its own.
+type Retrieval struct {
+	Query    string // PII redacted
+	Chunks   []RetrievedChunk
+	Relevant bool
+	HasData  bool
+}
+
+// Retrieve runs only the retrieval steps of RetrieveAndAnswer — redaction,
+// embedding, hybrid search and the relevance gate — without classifying the
+// intent or calling the model. Used by offline evaluation.
+func Retrieve(ctx context.Context, companyID string, userQuery string) (Retrieval, error) {
+	cfg := LoadAIConfig(companyID)
+	ctx = WithCompany(ctx, companyID)
+	userQuery = newPIISet(cfg.PII).redact(userQuery, cfg.PII)
+	return retrieve(ctx, cfg, companyID, userQuery)
+}
+
+// retrieve embeds an already redacted query, searches and gates the result.
+func retrieve(ctx context.Context, cfg AIConfig, companyID, query string) (Retrieval, error) {
+	embedding, err := embedQuery(ctx, query)
+	if err != nil {
+		return Retrieval{}, fmt.Errorf("embedding query: %w", err)
+	}
+
+	// Hybrid search: vectors + BM25 keywords, fused with RRF
+	chunks, err := hybridSearch(ctx, cfg, companyID, query, embedding)
+	if err != nil {
+		if err == ErrCollectionNotFound {
+			return Retrieval{}, err
+		}
+		return Retrieval{}, fmt.Errorf("vector search: %w", err)
+	}
+
+	relevant, hasData := evaluateRelevance(chunks, cfg.MinScore)
+	return Retrieval{Query: query, Chunks: chunks, Relevant: relevant, HasData: hasData}, nil
 }
 
 func RetrieveAndAnswerSync(ctx context.Context, companyID string, userQuery string) (RAGResult, error) {
@@ -798,28 +825,33 @@ func RetrieveAndAnswerSync(ctx context.Context, companyID string, userQuery stri
 
 // ── Step 1: Embed query ───────────────────────────────────────────────────────
 
+// embedQuery serves repeated queries from the LRU and only calls the
+// embeddings API on a miss.
 func embedQuery(ctx context.Context, query string) ([]float64, error) {
-	client := openai.NewClient(option.WithAPIKey(LLM_KEY))
+	key := normaliseQuery(query)
+	if vec, ok := embeddings.get(key); ok {
+		embeddingHits.Add(1)
+		return vec, nil
+	}
+	embeddingMisses.Add(1)
 
-	resp, err := client.Embeddings.New(ctx, openai.EmbeddingNewParams{
-		Model: openai.EmbeddingModelTextEmbedding3Large,
-		Input: openai.EmbeddingNewParamsInputUnion{
-			OfString: openai.String(query),
-		},
-	})
+	vec, err := embedText(ctx, query)
 	if err != nil {
 		return nil, err
 	}
-	if len(resp.Data) == 0 {
-		return nil, fmt.Errorf("no embedding returned")
-	}
+	embeddings.put(key, vec)
+	return vec, nil
+}
 
-	raw := resp.Data[0].Embedding
-	vec := make([]float64, len(raw))
-	for i, v := range raw {
-		vec[i] = v
+func embedText(ctx context.Context, query string) ([]float64, error) {
+	vectors, err := createEmbeddings(ctx, []string{query})
+	if err != nil {
+		return nil, err
 	}
-	return vec, nil
+	if len(vectors) == 0 {
+		return nil, fmt.Errorf("no embedding returned")
+	}
+	return vectors[0], nil
 }
 
 // ── Step 2: Search Qdrant ────────────────────────────────────────────────────
@@ -829,15 +861,15 @@ func collectionName(companyID string) string {
 	return "company_" + strings.ReplaceAll(companyID, "-", "_")
 }
 
-func searchQdrant(ctx context.Context, companyID string, vector []float64) ([]RetrievedChunk, error) {
+func searchQdrant(ctx context.Context, companyID string, vector []float64, limit int, threshold float64) ([]RetrievedChunk, error) {
 	collection := collectionName(companyID)
 	url := fmt.Sprintf("%s/collections/%s/points/search", qdrantURL, collection)
 
 	body := qdrantSearchRequest{
 		Vector:         vector,
-		Limit:          topK,
+		Limit:          limit,
 		WithPayload:    true,
-		ScoreThreshold: minScore,
+		ScoreThreshold: threshold,
 	}
 
 	bodyBytes, err := json.Marshal(body)
@@ -877,10 +909,27 @@ func searchQdrant(ctx context.Context, companyID string, vector []float64) ([]Re
 	return parseChunks(searchResp.Result), nil
 }
 
+// pointID renders a point id the way it was stored: json numbers decode
+// to float64, which fmt would print as 1e+06.
+func pointID(id interface{}) string {
+	switch v := id.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatInt(int64(v), 10)
+	case json.Number:
+		return v.String()
+	}
+	return fmt.Sprint(id)
+}
+
 func parseChunks(points []qdrantPoint) []RetrievedChunk {
 	chunks := make([]RetrievedChunk, 0, len(points))
 	for _, p := range points {
 		chunk := RetrievedChunk{Score: p.Score}
+		if p.ID != nil {
+			chunk.ID = pointID(p.ID)
+		}
 		if v, ok := p.Payload["text"].(string); ok {
 			chunk.Text = v
 		}
@@ -918,197 +967,68 @@ func parseChunks(points []qdrantPoint) []RetrievedChunk {
 
 // ── Step 3: Evaluate relevance ────────────────────────────────────────────────
 
-func evaluateRelevance(chunks []RetrievedChunk) (relevant bool, hasData bool) {
+func evaluateRelevance(chunks []RetrievedChunk, minScore float64) (relevant bool, hasData bool) {
 	if len(chunks) == 0 {
 		return false, false
 	}
 
-	topScore := chunks[0].Score
+	// chunks may be in fused order, so look at the best signal of each kind
+	// rather than at chunks[0]: an exact keyword hit (SKU, plan name, error
+	// code) counts as relevant even when the embedding score is weak.
+	topScore, topKeyword := 0.0, 0.0
 	totalText := 0
 	for _, c := range chunks {
+		topScore = math.Max(topScore, c.Score)
+		topKeyword = math.Max(topKeyword, c.KeywordHit)
 		totalText += len(strings.TrimSpace(c.Text))
 	}
 
-	relevant = topScore >= minScore
+	relevant = topScore >= minScore || topKeyword >= keywordRelevantCoverage
 	hasData = totalText > 150
 	return relevant, hasData
 }
 
 // ── Step 4: Prompt builders ───────────────────────────────────────────────────
+//
+// The wording lives in prompts/<version>/*.tmpl (see prompts.go). Each
+// builder returns the prompt and the template version that produced it.
 
-// systemPersona builds a dynamic company persona based on the inferred profile.
-func systemPersona(profile CompanyProfile) string {
-	var sb strings.Builder
-
-	sb.WriteString("You are the official AI assistant representing this company")
-	if profile.Domain != "" {
-		sb.WriteString(fmt.Sprintf(" (%s)", profile.Domain))
-	}
-	sb.WriteString(".\n\n")
-
-	sb.WriteString("YOUR ROLE:\n")
-	sb.WriteString("- You speak AS the company, not about it. You are the company's voice.\n")
-	sb.WriteString("- You are warm, professional, knowledgeable, and genuinely helpful.\n")
-	sb.WriteString("- You feel like a human customer service representative who deeply knows the company.\n")
-	sb.WriteString("- You never say 'according to our data' or 'based on the context' — just answer naturally.\n")
-	sb.WriteString("- You never expose internal system terms like 'chunks', 'vectors', 'RAG', or 'knowledge base'.\n\n")
-
-	sb.WriteString("LANGUAGE RULES:\n")
-	sb.WriteString("- Detect the language of the user's message and respond in the SAME language.\n")
-	sb.WriteString("- If the user writes in Bengali, respond in Bengali. If English, respond in English.\n")
-	sb.WriteString("- Never mix languages unless the user does.\n\n")
-
-	sb.WriteString("TONE:\n")
-	sb.WriteString("- Warm and approachable, never robotic.\n")
-	sb.WriteString("- Confident and accurate — if you know it, say it clearly.\n")
-	sb.WriteString("- Concise but complete — don't pad with filler words.\n\n")
-
-	return sb.String()
+func buildGreetingPrompt(userQuery string, profile CompanyProfile, cfg AIConfig) (string, string) {
+	return renderPrompt(cfg, "greeting", promptData{Query: userQuery, Profile: profile, Config: cfg})
 }
 
-func buildGreetingPrompt(userQuery string, profile CompanyProfile) string {
-	var sb strings.Builder
-	sb.WriteString(systemPersona(profile))
-
-	sb.WriteString("SITUATION: The customer has greeted you.\n\n")
-	sb.WriteString("INSTRUCTIONS:\n")
-	sb.WriteString("- Greet them back warmly and naturally — like a friendly company rep would.\n")
-	sb.WriteString("- Briefly mention what you can help with based on what the company offers.\n")
-	sb.WriteString("- Keep it short (2-3 sentences max). Don't be overly formal.\n")
-	sb.WriteString("- Make it feel human, not like a chatbot auto-response.\n\n")
-
-	if profile.Domain != "" {
-		sb.WriteString(fmt.Sprintf("Company domain: %s\n", profile.Domain))
-	}
-	if profile.HasProducts {
-		sb.WriteString("The company offers products/services you can ask about.\n")
-	}
-
-	sb.WriteString(fmt.Sprintf("\nCustomer message: %s\n", userQuery))
-	sb.WriteString("\nRespond naturally as the company's representative:")
-	return sb.String()
+func buildSmallTalkPrompt(userQuery string, profile CompanyProfile, cfg AIConfig) (string, string) {
+	return renderPrompt(cfg, "small_talk", promptData{Query: userQuery, Profile: profile, Config: cfg})
 }
 
-func buildSmallTalkPrompt(userQuery string, profile CompanyProfile) string {
-	var sb strings.Builder
-	sb.WriteString(systemPersona(profile))
-
-	sb.WriteString("SITUATION: The customer is making small talk or asking a general conversational question.\n\n")
-	sb.WriteString("INSTRUCTIONS:\n")
-	sb.WriteString("- Respond in a friendly, natural way — like a real person would.\n")
-	sb.WriteString("- Keep it brief and light.\n")
-	sb.WriteString("- Gently steer the conversation toward how you can help them with the company's offerings.\n")
-	sb.WriteString("- Don't lecture them or be overly promotional.\n\n")
-
-	sb.WriteString(fmt.Sprintf("Customer message: %s\n", userQuery))
-	sb.WriteString("\nRespond naturally:")
-	return sb.String()
+func buildHandoffPrompt(userQuery string, profile CompanyProfile, cfg AIConfig) (string, string) {
+	return renderPrompt(cfg, "handoff", promptData{Query: userQuery, Profile: profile, Config: cfg, Intent: IntentHumanRequest})
 }
 
-func buildNoKnowledgeBasePrompt(userQuery string) string {
-	return fmt.Sprintf(`You are a professional and empathetic company AI assistant.
-
-The company's knowledge base has not been set up yet, so you cannot answer specific questions.
-
-INSTRUCTIONS:
-- Apologise briefly and sincerely — one sentence.
-- Let the customer know they can reach a human agent for help.
-- Ask: "Would you like me to connect you with one of our team members?"
-- Keep it warm and reassuring. Do not make up any information.
-
-Detect and respond in the same language as the customer.
-
-Customer question: %s
-
-Respond naturally:`, userQuery)
+func buildNoKnowledgeBasePrompt(userQuery string, cfg AIConfig) (string, string) {
+	return renderPrompt(cfg, "no_knowledge_base", promptData{Query: userQuery, Config: cfg})
 }
 
-func buildPrompt(userQuery string, chunks []RetrievedChunk, profile CompanyProfile, relevant, hasData bool) string {
-	var sb strings.Builder
-
-	sb.WriteString(systemPersona(profile))
-
-	// ── Irrelevant query ──────────────────────────────────────────────────────
-	if !relevant {
-		sb.WriteString("SITUATION: The customer asked something unrelated to this company.\n\n")
-		sb.WriteString("INSTRUCTIONS:\n")
-		sb.WriteString("- Politely let them know you can only help with questions about this company.\n")
-		sb.WriteString("- Don't be dismissive — be warm and offer to help with something you CAN answer.\n")
-		sb.WriteString("- Give one example of what you CAN help with, based on the company's focus.\n")
-		sb.WriteString("- Keep it to 2-3 sentences.\n\n")
-		sb.WriteString(fmt.Sprintf("Customer question: %s\n", userQuery))
-		sb.WriteString("\nRespond naturally:")
-		return sb.String()
-	}
-
-	// ── Relevant but insufficient data ────────────────────────────────────────
-	if !hasData {
-		sb.WriteString("SITUATION: The customer asked something relevant, but we don't have enough detail to fully answer.\n\n")
-		sb.WriteString("INSTRUCTIONS:\n")
-		sb.WriteString("- Share any relevant information you do have from the context below.\n")
-		sb.WriteString("- Be honest that you don't have complete details on this specific topic.\n")
-		sb.WriteString("- Offer to connect them with a team member who can help further.\n")
-		sb.WriteString("- Ask: 'Would you like me to connect you with one of our team members for more details?'\n\n")
-
-		if len(chunks) > 0 {
-			sb.WriteString("PARTIAL CONTEXT:\n")
-			for _, c := range chunks {
-				if strings.TrimSpace(c.Text) != "" {
-					sb.WriteString(c.Text + "\n\n")
-				}
-			}
-		}
-
-		sb.WriteString(fmt.Sprintf("Customer question: %s\n", userQuery))
-		sb.WriteString("\nRespond naturally:")
-		return sb.String()
-	}
-
-	// ── Full answer with context ──────────────────────────────────────────────
-	sb.WriteString("SITUATION: The customer has asked a question you can fully answer from the company's information.\n\n")
-	sb.WriteString("INSTRUCTIONS:\n")
-	sb.WriteString("- Answer naturally and confidently, as if you personally know the answer.\n")
-	sb.WriteString("- Synthesize information from multiple context sections if needed — don't list them separately.\n")
-	sb.WriteString("- Include relevant URLs or links at the END only if directly useful (format: 'You can find more at: <url>').\n")
-	sb.WriteString("- If the question has multiple parts, address each one.\n")
-	sb.WriteString("- Do NOT start with 'Based on...' or 'According to...' — just answer.\n")
-	sb.WriteString("- Do NOT mention 'context', 'data', 'knowledge base', or any internal terms.\n\n")
-
-	// ── Context injection ─────────────────────────────────────────────────────
-	sb.WriteString("--- COMPANY INFORMATION ---\n")
+func buildPrompt(userQuery string, chunks []RetrievedChunk, profile CompanyProfile, relevant, hasData bool, intent Intent, cfg AIConfig) (string, string) {
+	// Collect unique source URLs
 	urls := []string{}
-
 	for _, chunk := range chunks {
-		text := strings.TrimSpace(chunk.Text)
-		if text == "" {
-			continue
-		}
-		// Add section context if available
-		if chunk.SectionPath != "" {
-			sb.WriteString(fmt.Sprintf("[%s]\n", chunk.SectionPath))
-		}
-		sb.WriteString(text)
-		sb.WriteString("\n\n")
-
-		// Collect unique source URLs
-		if chunk.SourceURL != "" {
+		if strings.TrimSpace(chunk.Text) != "" && chunk.SourceURL != "" {
 			urls = appendUnique(urls, chunk.SourceURL)
 		}
 	}
-	sb.WriteString("--- END ---\n\n")
-
-	if len(urls) > 0 {
-		sb.WriteString("Available page links (include only if directly relevant):\n")
-		for _, u := range urls {
-			sb.WriteString("- " + u + "\n")
-		}
-		sb.WriteString("\n")
-	}
-
-	sb.WriteString(fmt.Sprintf("Customer question: %s\n", userQuery))
-	sb.WriteString("\nAnswer naturally and helpfully:")
 
-	return sb.String()
+	return renderPrompt(cfg, "answer", promptData{
+		Query:    userQuery,
+		Profile:  profile,
+		Config:   cfg,
+		Chunks:   chunks,
+		URLs:     urls,
+		Relevant: relevant,
+		HasData:  hasData,
+		Intent:   intent,
+		Tools:    toolsFor(cfg, intent),
+	})
 }
 
 // ── Helpers ───────────────────────────────────────────────────────────────────
@@ -1161,23 +1081,19 @@ func cosineSimilarity(a, b []float64) float64 {
 
 // ── Step 5: Stream answer ─────────────────────────────────────────────────────
 
-func streamAnswer(ctx context.Context, prompt string, onToken func(string)) error {
-	client := openai.NewClient(option.WithAPIKey(LLM_KEY))
-
-	stream := client.Responses.NewStreaming(ctx, responses.ResponseNewParams{
-		Model: openai.ChatModelGPT4o,
-		Input: responses.ResponseNewParamsInputUnion{
-			OfString: openai.String(prompt),
-		},
-	})
-	defer stream.Close()
-
-	for stream.Next() {
-		event := stream.Current()
-		if event.Type == "response.output_text.delta" && onToken != nil {
-			onToken(event.Delta)
+// streamReply streams the model's answer to onToken with redacted values put
+// back, and returns the full (restored) reply and the model that wrote it.
+func streamReply(ctx context.Context, cfg AIConfig, prompt string, pii *piiSet, tools *toolRunner, onToken func(string)) (string, []model.QuickReply, string, error) {
+	var fullAnswer strings.Builder
+	chips := newQuickReplyFilter(func(text string) {
+		fullAnswer.WriteString(text)
+		if onToken != nil {
+			onToken(text)
 		}
-	}
-
-	return stream.Err()
+	})
+	restorer := newPIIRestorer(pii, chips.write)
+	modelName, err := streamWithFallback(ctx, cfg, prompt, tools, restorer.write)
+	restorer.flush()
+	chips.flush()
+	return strings.TrimRight(fullAnswer.String(), " \n"), chips.quickReplies(), modelName, err
 }
@@ -0,0 +1,402 @@
+package llm
+
+import (
+	"butter-time/internal/env"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// ── Company tools ─────────────────────────────────────────────────────────────
+//
+// A company registers tools in its AI config: a name, a description for the
+// model, a JSON schema for the arguments and an HTTP webhook. While answering
+// a question the model may call them; we validate the arguments, POST
+//
+//	{"tool": "<name>", "company_id": "...", "conversation_id": "...", "arguments": {...}}
+//
+// to the webhook and hand the response body back to the model. Every call is
+// appended to TOOL_AUDIT_LOG.
+//
+// Webhooks must be public https endpoints. The address is checked again when
+// connecting, after DNS, so a company's config can't reach our own network
+// (cloud metadata, qdrant, internal admin ports). TOOL_ALLOW_PRIVATE=true
+// lifts both checks for local development against cmd/tool-stub; never set
+// it in production.
+
+// ToolConfig is one webhook tool in a company's AI config.
+type ToolConfig struct {
+	Name        string            `json:"name"`
+	Description string            `json:"description"`
+	URL         string            `json:"url"`
+	Headers     map[string]string `json:"headers"`    // e.g. Authorization for the company's api
+	Parameters  map[string]any    `json:"parameters"` // JSON schema, type object
+	TimeoutMs   int               `json:"timeout_ms"`
+}
+
+var (
+	toolAuditLogPath = getEnv("TOOL_AUDIT_LOG", "tool-audit.jsonl")
+	toolAllowPrivate = env.Bool("TOOL_ALLOW_PRIVATE", false)
+
+	defaultToolTimeout = 5 * time.Second
+	maxToolTimeout     = 30 * time.Second
+
+	// model turns that may ask for tools before it has to answer
+	maxToolRounds = 3
+	// tool calls honoured per turn
+	maxToolCallsPerTurn = 4
+	// webhook response bytes read / passed to the model
+	maxToolResponse = 64 << 10
+	maxToolOutput   = 8000
+)
+
+var toolNamePattern = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
+func init() {
+	if toolAllowPrivate {
+		log.Println("WARNING: TOOL_ALLOW_PRIVATE is set: tool webhooks may use http and reach localhost and private networks. Development only.")
+	}
+}
+
+// normaliseTools drops tools that can't work and fills defaults.
+func normaliseTools(tools []ToolConfig) []ToolConfig {
+	kept := make([]ToolConfig, 0, len(tools))
+	seen := make(map[string]bool)
+	for _, t := range tools {
+		if !toolNamePattern.MatchString(t.Name) || seen[t.Name] {
+			log.Printf("ai config: tool %q skipped: bad or duplicate name", t.Name)
+			continue
+		}
+		if err := checkToolURL(t.URL); err != nil {
+			log.Printf("ai config: tool %q skipped: %v", t.Name, err)
+			continue
+		}
+		if t.Parameters == nil {
+			t.Parameters = map[string]any{"type": "object", "properties": map[string]any{}}
+		}
+		if typ, _ := t.Parameters["type"].(string); typ != "object" {
+			log.Printf("ai config: tool %q skipped: parameters must be an object schema", t.Name)
+			continue
+		}
+		seen[t.Name] = true
+		kept = append(kept, t)
+	}
+	return kept
+}
+
+type noToolsKey struct{}
+
+// withoutTools marks a run that must not call the company's tools: drafts
+// no human has approved yet can't trigger webhooks with side effects.
+func withoutTools(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noToolsKey{}, true)
+}
+
+func toolsAllowed(ctx context.Context) bool {
+	off, _ := ctx.Value(noToolsKey{}).(bool)
+	return !off
+}
+
+func (t ToolConfig) timeout() time.Duration {
+	d := time.Duration(t.TimeoutMs) * time.Millisecond
+	if d <= 0 {
+		return defaultToolTimeout
+	}
+	return min(d, maxToolTimeout)
+}
+
+// toolsFor returns the tools offered for an intent — only questions and
+// complaints can need live data.
+func toolsFor(cfg AIConfig, intent Intent) []ToolSpec {
+	if intent != IntentQuestion && intent != IntentComplaint {
+		return nil
+	}
+	specs := make([]ToolSpec, 0, len(cfg.Tools))
+	for _, t := range cfg.Tools {
+		specs = append(specs, ToolSpec{Name: t.Name, Description: t.Description, Parameters: t.Parameters})
+	}
+	return specs
+}
+
+// ── Running tools ─────────────────────────────────────────────────────────────
+
+// toolRunner executes the tool calls of one answer. A nil runner offers no tools.
+type toolRunner struct {
+	companyID      string
+	conversationID string
+	tools          map[string]ToolConfig
+	offered        []ToolSpec
+	pii            *piiSet
+	piiCfg         PIIConfig
+	calls          int
+}
+
+func newToolRunner(ctx context.Context, cfg AIConfig, companyID string, intent Intent, pii *piiSet) *toolRunner {
+	offered := toolsFor(cfg, intent)
+	if len(offered) == 0 {
+		return nil
+	}
+	r := &toolRunner{
+		companyID:      companyID,
+		conversationID: conversationFrom(ctx),
+		tools:          make(map[string]ToolConfig, len(cfg.Tools)),
+		offered:        offered,
+		pii:            pii,
+		piiCfg:         cfg.PII,
+	}
+	for _, t := range cfg.Tools {
+		r.tools[t.Name] = t
+	}
+	return r
+}
+
+func (r *toolRunner) specs() []ToolSpec {
+	if r == nil {
+		return nil
+	}
+	return r.offered
+}
+
+func (r *toolRunner) called() bool {
+	return r != nil && r.calls > 0
+}
+
+// run executes calls in order. Failures become error outputs the model can
+// read and react to (e.g. by asking the customer for a missing order number).
+func (r *toolRunner) run(ctx context.Context, calls []ToolCall) []ToolOutput {
+	outputs := make([]ToolOutput, 0, len(calls))
+	for i, call := range calls {
+		if r == nil || i >= maxToolCallsPerTurn {
+			outputs = append(outputs, ToolOutput{CallID: call.CallID, Output: toolError("too many tool calls")})
+			continue
+		}
+		r.calls++
+		outputs = append(outputs, ToolOutput{CallID: call.CallID, Output: r.call(ctx, call)})
+	}
+	return outputs
+}
+
+func (r *toolRunner) call(ctx context.Context, call ToolCall) string {
+	audit := toolAuditRecord{
+		Time:           time.Now().UTC(),
+		CompanyID:      r.companyID,
+		ConversationID: r.conversationID,
+		Tool:           call.Name,
+		CallID:         call.CallID,
+		Arguments:      call.Arguments, // as the model wrote them: placeholders, no raw PII
+	}
+	defer func() {
+		audit.DurationMs = time.Since(audit.Time).Milliseconds()
+		writeToolAudit(audit)
+	}()
+
+	tool, ok := r.tools[call.Name]
+	if !ok {
+		audit.Status, audit.Error = "unknown_tool", "no such tool"
+		return toolError("unknown tool " + call.Name)
+	}
+
+	// the model only saw placeholders; the company's system needs the values
+	rawArgs := r.pii.restoreValues(call.Arguments)
+	var args any
+	if err := json.Unmarshal([]byte(rawArgs), &args); err != nil {
+		audit.Status, audit.Error = "invalid_arguments", "arguments are not json"
+		return toolError("arguments must be a JSON object")
+	}
+	if err := validateJSONSchema(tool.Parameters, args); err != nil {
+		audit.Status, audit.Error = "invalid_arguments", err.Error()
+		return toolError("invalid arguments: " + err.Error())
+	}
+
+	status, body, err := callToolWebhook(ctx, tool, r.companyID, r.conversationID, args)
+	audit.HTTPStatus = status
+	audit.OutputBytes = len(body)
+	switch {
+	case errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil:
+		audit.Status, audit.Error = "timeout", err.Error()
+		return toolError("the system did not answer in time")
+	case err != nil:
+		audit.Status, audit.Error = "error", err.Error()
+		return toolError("the system is unavailable")
+	case status < 200 || status > 299:
+		audit.Status, audit.Error = "error", fmt.Sprintf("webhook status %d", status)
+		return toolError(fmt.Sprintf("the system answered with status %d", status))
+	}
+	audit.Status = "ok"
+
+	output := strings.TrimSpace(string(body))
+	if runes := []rune(output); len(runes) > maxToolOutput {
+		output = string(runes[:maxToolOutput])
+	}
+	if output == "" {
+		output = `{"result": null}`
+	}
+	// same placeholders as the question, so the reply restores them
+	return r.pii.redact(output, r.piiCfg)
+}
+
+func callToolWebhook(ctx context.Context, tool ToolConfig, companyID, conversationID string, args any) (int, []byte, error) {
+	body, err := json.Marshal(map[string]any{
+		"tool":            tool.Name,
+		"company_id":      companyID,
+		"conversation_id": conversationID,
+		"arguments":       args,
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, tool.timeout())
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tool.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Butter-Tool", tool.Name)
+	for k, v := range tool.Headers {
+		req.Header.Set(k, v)
+	}
+
+	res, err := toolClient.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer res.Body.Close()
+	out, err := io.ReadAll(io.LimitReader(res.Body, int64(maxToolResponse)))
+	return res.StatusCode, out, err
+}
+
+// ── Webhook addresses ─────────────────────────────────────────────────────────
+
+var errToolHost = errors.New("tool webhook must be a public address")
+
+// toolClient only connects to public addresses and follows redirects only
+// to https. No proxy: the address checked must be the one dialled.
+var toolClient = &http.Client{
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout: maxToolTimeout,
+			Control: checkToolDial,
+		}).DialContext,
+		TLSHandshakeTimeout: 10 * time.Second,
+		MaxIdleConnsPerHost: 4,
+	},
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 3 {
+			return errors.New("too many redirects")
+		}
+		return checkToolURL(req.URL.String())
+	},
+}
+
+// checkToolURL rejects webhook urls that aren't https or that name a
+// non-public host outright. Hostnames are checked once resolved, by
+// checkToolDial.
+func checkToolURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("bad url %q", raw)
+	}
+	if toolAllowPrivate {
+		if u.Scheme != "https" && u.Scheme != "http" {
+			return fmt.Errorf("url %q must be http or https", raw)
+		}
+		return nil
+	}
+	if u.Scheme != "https" {
+		return fmt.Errorf("url %q must be https", raw)
+	}
+	host := strings.ToLower(u.Hostname())
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return errToolHost
+	}
+	if addr, err := netip.ParseAddr(host); err == nil && !publicAddr(addr) {
+		return errToolHost
+	}
+	return nil
+}
+
+// checkToolDial runs for every connection the tool client makes, with the
+// resolved address.
+func checkToolDial(network, address string, _ syscall.RawConn) error {
+	if toolAllowPrivate {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil || !publicAddr(addr) {
+		return errToolHost
+	}
+	return nil
+}
+
+// carrier-grade NAT space, not covered by netip's IsPrivate
+var sharedAddrSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+func publicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsGlobalUnicast() &&
+		!addr.IsPrivate() &&
+		!sharedAddrSpace.Contains(addr)
+}
+
+func toolError(msg string) string {
+	b, _ := json.Marshal(map[string]string{"error": msg})
+	return string(b)
+}
+
+// ── Audit ─────────────────────────────────────────────────────────────────────
+
+type toolAuditRecord struct {
+	Time           time.Time `json:"time"`
+	CompanyID      string    `json:"company_id"`
+	ConversationID string    `json:"conversation_id,omitempty"`
+	Tool           string    `json:"tool"`
+	CallID         string    `json:"call_id"`
+	Arguments      string    `json:"arguments"`
+	Status         string    `json:"status"` // ok | invalid_arguments | unknown_tool | timeout | error
+	HTTPStatus     int       `json:"http_status,omitempty"`
+	DurationMs     int64     `json:"duration_ms"`
+	OutputBytes    int       `json:"output_bytes"`
+	Error          string    `json:"error,omitempty"`
+}
+
+var toolAuditMu sync.Mutex
+
+func writeToolAudit(rec toolAuditRecord) {
+	log.Printf("tool %s for company %s: %s (%dms)", rec.Tool, rec.CompanyID, rec.Status, rec.DurationMs)
+
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return
+	}
+	toolAuditMu.Lock()
+	defer toolAuditMu.Unlock()
+	f, err := os.OpenFile(toolAuditLogPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		log.Println("tool audit open error:", err)
+		return
+	}
+	defer f.Close()
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		log.Println("tool audit write error:", err)
+	}
+}
@@ -0,0 +1,102 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// allowPrivateTools sets TOOL_ALLOW_PRIVATE for the length of the test.
+func allowPrivateTools(t *testing.T, allow bool) {
+	t.Helper()
+	prev := toolAllowPrivate
+	toolAllowPrivate = allow
+	t.Cleanup(func() { toolAllowPrivate = prev })
+}
+
+func TestCheckToolURL(t *testing.T) {
+	cases := []struct {
+		url         string
+		byDefault   bool // accepted without TOOL_ALLOW_PRIVATE
+		withPrivate bool // accepted with it
+	}{
+		{"https://api.example.com/orders", true, true},
+		{"https://93.184.216.34/hook", true, true},
+		{"http://api.example.com/orders", false, true},
+		{"http://localhost:4700/orders/status", false, true},
+		{"https://app.localhost/hook", false, true},
+		{"https://127.0.0.1/hook", false, true},
+		{"https://[::1]/hook", false, true},
+		{"https://10.0.0.5/hook", false, true},
+		{"https://192.168.1.20/hook", false, true},
+		{"https://169.254.169.254/latest/meta-data", false, true},
+		{"https://100.64.0.1/hook", false, true},
+		{"ftp://api.example.com/orders", false, false},
+		{"not a url", false, false},
+	}
+	for _, c := range cases {
+		for _, allow := range []bool{false, true} {
+			allowPrivateTools(t, allow)
+			want := c.byDefault
+			if allow {
+				want = c.withPrivate
+			}
+			if err := checkToolURL(c.url); (err == nil) != want {
+				t.Errorf("TOOL_ALLOW_PRIVATE=%v: checkToolURL(%q) = %v, want accepted=%v", allow, c.url, err, want)
+			}
+		}
+	}
+}
+
+func TestCheckToolDial(t *testing.T) {
+	for _, c := range []struct {
+		address string
+		public  bool
+	}{
+		{"93.184.216.34:443", true},
+		{"127.0.0.1:4700", false},
+		{"[::1]:443", false},
+		{"10.1.2.3:443", false},
+		{"[::ffff:192.168.0.1]:443", false},
+	} {
+		allowPrivateTools(t, false)
+		if err := checkToolDial("tcp", c.address, nil); (err == nil) != c.public {
+			t.Errorf("checkToolDial(%q) = %v by default", c.address, err)
+		}
+		allowPrivateTools(t, true)
+		if err := checkToolDial("tcp", c.address, nil); err != nil {
+			t.Errorf("checkToolDial(%q) = %v with TOOL_ALLOW_PRIVATE", c.address, err)
+		}
+	}
+}
+
+// TestToolWebhookOnLoopback is the cmd/tool-stub setup: an http webhook on
+// localhost is dropped and can't be dialled by default, and works with the
+// dev opt-in.
+func TestToolWebhookOnLoopback(t *testing.T) {
+	stub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status": "shipped"}`))
+	}))
+	defer stub.Close()
+	tool := ToolConfig{Name: "order_status", URL: stub.URL + "/orders/status"}
+
+	allowPrivateTools(t, false)
+	if kept := normaliseTools([]ToolConfig{tool}); len(kept) != 0 {
+		t.Errorf("loopback tool kept by default: %+v", kept)
+	}
+	if _, _, err := callToolWebhook(context.Background(), tool, "c", "conv", map[string]any{}); !errors.Is(err, errToolHost) {
+		t.Errorf("dialling loopback by default: err = %v, want errToolHost", err)
+	}
+
+	allowPrivateTools(t, true)
+	kept := normaliseTools([]ToolConfig{tool})
+	if len(kept) != 1 {
+		t.Fatalf("loopback tool dropped with TOOL_ALLOW_PRIVATE")
+	}
+	status, body, err := callToolWebhook(context.Background(), kept[0], "c", "conv", map[string]any{})
+	if err != nil || status != http.StatusOK || string(body) != `{"status": "shipped"}` {
+		t.Errorf("webhook call = %d %q %v", status, body, err)
+	}
+}
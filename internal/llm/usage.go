@@ -0,0 +1,431 @@
+package llm
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/openai/openai-go/v3"
+)
+
+// ── Usage accounting ──────────────────────────────────────────────────────────
+//
+// Every model call records its tokens against the company (and conversation,
+// when the caller put one on the context). Totals are kept per UTC day and
+// month for the quota checks. With USAGE_LOG set, each record is also
+// appended as a JSON line and the current month is replayed on startup, so a
+// restart doesn't hand a tenant a fresh quota.
+
+var (
+	usageLogPath = getEnv("USAGE_LOG", "")
+
+	// conversations kept per company before the least recently active are dropped
+	maxTrackedConversations = 2000
+)
+
+// ErrQuotaExceeded means the company used up its daily or monthly allowance.
+var ErrQuotaExceeded = errors.New("ai quota exceeded")
+
+// QuotaConfig caps a company's spend. Zero means unlimited. Past SoftLimit
+// (a fraction of any cap) the assistant switches to SoftLimitModel and skips
+// the optional extra calls (rerank, llm intent judge, copilot alternatives).
+type QuotaConfig struct {
+	DailyTokens      int64   `json:"daily_tokens"`
+	MonthlyTokens    int64   `json:"monthly_tokens"`
+	MonthlyBudgetUSD float64 `json:"monthly_budget_usd"`
+	SoftLimit        float64 `json:"soft_limit"`       // default 0.8
+	SoftLimitModel   string  `json:"soft_limit_model"` // default gpt-4o-mini
+	ExhaustedMessage string  `json:"exhausted_message"`
+}
+
+var defaultExhaustedMessage = "Our assistant is taking a short break right now. A member of our team will get back to you as soon as possible."
+
+// USD per 1M tokens: input, output. Embeddings only have input.
+var modelPrices = map[string][2]float64{
+	openai.ChatModelGPT4o:                    {2.50, 10.00},
+	openai.ChatModelGPT4oMini:                {0.15, 0.60},
+	openai.EmbeddingModelTextEmbedding3Large: {0.13, 0},
+	openai.EmbeddingModelTextEmbedding3Small: {0.02, 0},
+	openai.ChatModelGPT4_1:                   {2.00, 8.00},
+	openai.ChatModelGPT4_1Mini:               {0.40, 1.60},
+}
+
+// Usage is a running total of tokens and estimated cost.
+type Usage struct {
+	PromptTokens     int64   `json:"prompt_tokens"`
+	CompletionTokens int64   `json:"completion_tokens"`
+	EmbeddingTokens  int64   `json:"embedding_tokens"`
+	Calls            int64   `json:"calls"`
+	CostUSD          float64 `json:"cost_usd"`
+}
+
+// Tokens is everything billed, embeddings included.
+func (u Usage) Tokens() int64 {
+	return u.PromptTokens + u.CompletionTokens + u.EmbeddingTokens
+}
+
+func (u *Usage) add(o Usage) {
+	u.PromptTokens += o.PromptTokens
+	u.CompletionTokens += o.CompletionTokens
+	u.EmbeddingTokens += o.EmbeddingTokens
+	u.Calls += o.Calls
+	u.CostUSD += o.CostUSD
+}
+
+// ConversationUsage is one conversation's share of the month.
+type ConversationUsage struct {
+	ConversationID string    `json:"conversation_id"`
+	Usage          Usage     `json:"usage"`
+	LastSeen       time.Time `json:"last_seen"`
+}
+
+// CompanyUsage is what the admin endpoint reports for a company.
+type CompanyUsage struct {
+	CompanyID     string              `json:"company_id"`
+	Day           string              `json:"day"`
+	Month         string              `json:"month"`
+	Today         Usage               `json:"today"`
+	ThisMonth     Usage               `json:"this_month"`
+	ByModel       map[string]Usage    `json:"by_model"`
+	Conversations []ConversationUsage `json:"conversations,omitempty"`
+	Quota         QuotaConfig         `json:"quota"`
+	State         string              `json:"state"` // ok | soft_limit | exceeded
+}
+
+type companyLedger struct {
+	day, month    string
+	today         Usage
+	thisMonth     Usage
+	byModel       map[string]Usage
+	conversations map[string]*ConversationUsage
+}
+
+// usageRecord is one line of USAGE_LOG.
+type usageRecord struct {
+	Time           time.Time `json:"time"`
+	CompanyID      string    `json:"company_id"`
+	ConversationID string    `json:"conversation_id,omitempty"`
+	Model          string    `json:"model"`
+	Usage          Usage     `json:"usage"`
+}
+
+var (
+	usageMu     sync.Mutex
+	ledgers     = make(map[string]*companyLedger)
+	usageLog    *os.File
+	usageLoaded bool
+)
+
+// ── Context scope ─────────────────────────────────────────────────────────────
+
+type usageScopeKey struct{}
+
+type usageScope struct {
+	companyID      string
+	conversationID string
+}
+
+// WithCompany bills model calls made with ctx to companyID.
+func WithCompany(ctx context.Context, companyID string) context.Context {
+	scope, _ := ctx.Value(usageScopeKey{}).(usageScope)
+	scope.companyID = companyID
+	return context.WithValue(ctx, usageScopeKey{}, scope)
+}
+
+// WithConversation also attributes model calls to a conversation.
+func WithConversation(ctx context.Context, conversationID string) context.Context {
+	scope, _ := ctx.Value(usageScopeKey{}).(usageScope)
+	scope.conversationID = conversationID
+	return context.WithValue(ctx, usageScopeKey{}, scope)
+}
+
+func conversationFrom(ctx context.Context) string {
+	scope, _ := ctx.Value(usageScopeKey{}).(usageScope)
+	return scope.conversationID
+}
+
+// ── Recording ─────────────────────────────────────────────────────────────────
+
+// recordCompletion books a completion call. Calls that failed before the
+// provider counted anything are skipped.
+func recordCompletion(ctx context.Context, model string, usage TokenUsage) {
+	if usage == (TokenUsage{}) {
+		return
+	}
+	price := modelPrices[model]
+	recordUsage(ctx, model, Usage{
+		PromptTokens:     usage.Input,
+		CompletionTokens: usage.Output,
+		Calls:            1,
+		CostUSD:          (float64(usage.Input)*price[0] + float64(usage.Output)*price[1]) / 1e6,
+	})
+}
+
+// recordEmbedding books an embeddings call.
+func recordEmbedding(ctx context.Context, model string, tokens int64) {
+	if tokens == 0 {
+		return
+	}
+	recordUsage(ctx, model, Usage{
+		EmbeddingTokens: tokens,
+		Calls:           1,
+		CostUSD:         float64(tokens) * modelPrices[model][0] / 1e6,
+	})
+}
+
+func recordUsage(ctx context.Context, model string, u Usage) {
+	if _, ok := modelPrices[model]; !ok {
+		log.Printf("usage: no price for model %s, cost not counted", model)
+	}
+	scope, _ := ctx.Value(usageScopeKey{}).(usageScope)
+	companyID := scope.companyID
+	if companyID == "" {
+		// shared work such as embedding the intent exemplars
+		companyID = "_system"
+	}
+	rec := usageRecord{
+		Time:           time.Now().UTC(),
+		CompanyID:      companyID,
+		ConversationID: scope.conversationID,
+		Model:          model,
+		Usage:          u,
+	}
+
+	usageMu.Lock()
+	defer usageMu.Unlock()
+	loadUsageLog()
+	applyRecord(rec)
+	if usageLog != nil {
+		line, _ := json.Marshal(rec)
+		if _, err := usageLog.Write(append(line, '\n')); err != nil {
+			log.Println("usage log write error:", err)
+		}
+	}
+}
+
+// applyRecord adds a record to the in-memory ledgers. usageMu must be held.
+func applyRecord(rec usageRecord) {
+	t := rec.Time.UTC()
+	day, month := t.Format("2006-01-02"), t.Format("2006-01")
+	l := ledgerFor(rec.CompanyID, t)
+	if day == l.day {
+		l.today.add(rec.Usage)
+	}
+	if month != l.month {
+		return
+	}
+	l.thisMonth.add(rec.Usage)
+	m := l.byModel[rec.Model]
+	m.add(rec.Usage)
+	l.byModel[rec.Model] = m
+
+	if rec.ConversationID == "" {
+		return
+	}
+	c, ok := l.conversations[rec.ConversationID]
+	if !ok {
+		if len(l.conversations) >= maxTrackedConversations {
+			dropOldestConversation(l)
+		}
+		c = &ConversationUsage{ConversationID: rec.ConversationID}
+		l.conversations[rec.ConversationID] = c
+	}
+	c.Usage.add(rec.Usage)
+	if rec.Time.After(c.LastSeen) {
+		c.LastSeen = rec.Time
+	}
+}
+
+// ledgerFor returns the company's ledger, rolling the day and month buckets
+// over when now has moved past them. usageMu must be held.
+func ledgerFor(companyID string, now time.Time) *companyLedger {
+	now = now.UTC()
+	day, month := now.Format("2006-01-02"), now.Format("2006-01")
+	l, ok := ledgers[companyID]
+	if !ok {
+		l = &companyLedger{day: day, month: month, byModel: make(map[string]Usage), conversations: make(map[string]*ConversationUsage)}
+		ledgers[companyID] = l
+	}
+	if day > l.day {
+		l.day, l.today = day, Usage{}
+	}
+	if month > l.month {
+		l.month, l.thisMonth = month, Usage{}
+		l.byModel = make(map[string]Usage)
+		l.conversations = make(map[string]*ConversationUsage)
+	}
+	return l
+}
+
+func dropOldestConversation(l *companyLedger) {
+	var oldest *ConversationUsage
+	for _, c := range l.conversations {
+		if oldest == nil || c.LastSeen.Before(oldest.LastSeen) {
+			oldest = c
+		}
+	}
+	if oldest != nil {
+		delete(l.conversations, oldest.ConversationID)
+	}
+}
+
+// loadUsageLog replays this month's USAGE_LOG once and opens it for
+// appending. usageMu must be held.
+func loadUsageLog() {
+	if usageLoaded || usageLogPath == "" {
+		return
+	}
+	usageLoaded = true
+
+	month := time.Now().UTC().Format("2006-01")
+	if f, err := os.Open(usageLogPath); err == nil {
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			var rec usageRecord
+			if json.Unmarshal(scanner.Bytes(), &rec) != nil {
+				continue
+			}
+			if rec.Time.UTC().Format("2006-01") == month {
+				applyRecord(rec)
+			}
+		}
+		f.Close()
+	}
+
+	f, err := os.OpenFile(usageLogPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		log.Println("usage log open error:", err)
+		return
+	}
+	usageLog = f
+}
+
+// ── Quotas ────────────────────────────────────────────────────────────────────
+
+type quotaState int
+
+const (
+	quotaOK quotaState = iota
+	quotaSoftLimit
+	quotaExceeded
+)
+
+func (s quotaState) String() string {
+	switch s {
+	case quotaSoftLimit:
+		return "soft_limit"
+	case quotaExceeded:
+		return "exceeded"
+	}
+	return "ok"
+}
+
+// checkQuota compares the company's usage with its caps.
+func checkQuota(companyID string, q QuotaConfig) quotaState {
+	usageMu.Lock()
+	loadUsageLog()
+	l := ledgerFor(companyID, time.Now())
+	today, month := l.today, l.thisMonth
+	usageMu.Unlock()
+	return quotaStateFor(q, today, month)
+}
+
+func quotaStateFor(q QuotaConfig, today, month Usage) quotaState {
+	used := []float64{}
+	if q.DailyTokens > 0 {
+		used = append(used, float64(today.Tokens())/float64(q.DailyTokens))
+	}
+	if q.MonthlyTokens > 0 {
+		used = append(used, float64(month.Tokens())/float64(q.MonthlyTokens))
+	}
+	if q.MonthlyBudgetUSD > 0 {
+		used = append(used, month.CostUSD/q.MonthlyBudgetUSD)
+	}
+
+	state := quotaOK
+	for _, u := range used {
+		switch {
+		case u >= 1:
+			return quotaExceeded
+		case u >= q.SoftLimit:
+			state = quotaSoftLimit
+		}
+	}
+	return state
+}
+
+// applySoftLimit trims a config down to the cheap path.
+func applySoftLimit(cfg AIConfig) AIConfig {
+	cfg.Model = cfg.Quota.SoftLimitModel
+	cfg.Hybrid.Rerank = false
+	cfg.IntentClassifier = "centroid"
+	return cfg
+}
+
+// QuotaExceededMessage is what customers see instead of an answer once the
+// company is out of quota.
+func QuotaExceededMessage(companyID string) string {
+	return LoadAIConfig(companyID).Quota.ExhaustedMessage
+}
+
+// ── Reporting ─────────────────────────────────────────────────────────────────
+
+// GetCompanyUsage reports a company's usage, with its busiest conversations
+// first (at most maxConversations of them).
+func GetCompanyUsage(companyID string, maxConversations int) CompanyUsage {
+	cfg := LoadAIConfig(companyID)
+
+	usageMu.Lock()
+	loadUsageLog()
+	l := ledgerFor(companyID, time.Now())
+	report := CompanyUsage{
+		CompanyID: companyID,
+		Day:       l.day,
+		Month:     l.month,
+		Today:     l.today,
+		ThisMonth: l.thisMonth,
+		ByModel:   make(map[string]Usage, len(l.byModel)),
+		Quota:     cfg.Quota,
+	}
+	for m, u := range l.byModel {
+		report.ByModel[m] = u
+	}
+	for _, c := range l.conversations {
+		report.Conversations = append(report.Conversations, *c)
+	}
+	usageMu.Unlock()
+
+	sort.Slice(report.Conversations, func(i, j int) bool {
+		return report.Conversations[i].Usage.CostUSD > report.Conversations[j].Usage.CostUSD
+	})
+	if len(report.Conversations) > maxConversations {
+		report.Conversations = report.Conversations[:maxConversations]
+	}
+	report.State = quotaStateFor(cfg.Quota, report.Today, report.ThisMonth).String()
+	return report
+}
+
+// GetAllUsage reports every company seen this month, without conversations.
+func GetAllUsage() []CompanyUsage {
+	usageMu.Lock()
+	loadUsageLog()
+	ids := make([]string, 0, len(ledgers))
+	for id := range ledgers {
+		ids = append(ids, id)
+	}
+	usageMu.Unlock()
+
+	sort.Strings(ids)
+	all := make([]CompanyUsage, 0, len(ids))
+	for _, id := range ids {
+		all = append(all, GetCompanyUsage(id, 0))
+	}
+	return all
+}
@@ -0,0 +1,78 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestQuotaStateFor(t *testing.T) {
+	used := func(tokens int64, cost float64) Usage { return Usage{PromptTokens: tokens, CostUSD: cost} }
+	cases := []struct {
+		name         string
+		quota        QuotaConfig
+		today, month Usage
+		want         quotaState
+	}{
+		{"no caps", QuotaConfig{SoftLimit: 0.8}, used(1e9, 1e4), used(1e9, 1e4), quotaOK},
+		{"under daily", QuotaConfig{DailyTokens: 100, SoftLimit: 0.8}, used(79, 0), used(79, 0), quotaOK},
+		{"daily soft limit", QuotaConfig{DailyTokens: 100, SoftLimit: 0.8}, used(80, 0), used(80, 0), quotaSoftLimit},
+		{"daily exceeded", QuotaConfig{DailyTokens: 100, SoftLimit: 0.8}, used(100, 0), used(100, 0), quotaExceeded},
+		{"monthly tokens", QuotaConfig{DailyTokens: 100, MonthlyTokens: 1000, SoftLimit: 0.8}, used(10, 0), used(1000, 0), quotaExceeded},
+		{"monthly budget soft", QuotaConfig{MonthlyBudgetUSD: 10, SoftLimit: 0.5}, used(0, 0), used(0, 6), quotaSoftLimit},
+		{"any cap over wins", QuotaConfig{DailyTokens: 100, MonthlyBudgetUSD: 10, SoftLimit: 0.8}, used(90, 0), used(90, 10), quotaExceeded},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := quotaStateFor(c.quota, c.today, c.month); got != c.want {
+				t.Errorf("state = %s, want %s", got, c.want)
+			}
+		})
+	}
+}
+
+// TestQuotaWithFakeProvider answers through the full pipeline and tightens the
+// daily cap around what was billed: soft limit first, then no answer at all.
+func TestQuotaWithFakeProvider(t *testing.T) {
+	const companyID = "quota-test"
+	useFakes(t, companyID, "Returns are accepted within 30 days of delivery with the original receipt.")
+	t.Cleanup(func() {
+		usageMu.Lock()
+		delete(ledgers, companyID)
+		usageMu.Unlock()
+	})
+	ctx := context.Background()
+	question := "how many days do I have for returns"
+
+	pinConfig(t, companyID, AIConfig{Quota: QuotaConfig{DailyTokens: 1 << 40}})
+	res, err := RetrieveAndAnswerSync(ctx, companyID, question)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := LoadAIConfig(companyID)
+	if res.Model != cfg.Model {
+		t.Errorf("model under quota = %s, want %s", res.Model, cfg.Model)
+	}
+	billed := GetCompanyUsage(companyID, 0).Today.Tokens()
+	if billed == 0 {
+		t.Fatal("answer was not billed to the company")
+	}
+
+	// ~90% used: the cheap model answers
+	pinConfig(t, companyID, AIConfig{Quota: QuotaConfig{DailyTokens: billed + billed/9}})
+	res, err = RetrieveAndAnswerSync(ctx, companyID, question)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := LoadAIConfig(companyID).Quota.SoftLimitModel; res.Model != want {
+		t.Errorf("model past soft limit = %s, want %s", res.Model, want)
+	}
+
+	pinConfig(t, companyID, AIConfig{Quota: QuotaConfig{DailyTokens: billed}})
+	if _, err := RetrieveAndAnswerSync(ctx, companyID, question); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("over quota: err = %v, want ErrQuotaExceeded", err)
+	}
+	if state := GetCompanyUsage(companyID, 0).State; state != quotaExceeded.String() {
+		t.Errorf("reported state = %s", state)
+	}
+}
@@ -0,0 +1,55 @@
+package llm
+
+import "context"
+
+// ── Vector store ──────────────────────────────────────────────────────────────
+//
+// VectorStore holds each company's knowledge base chunks. Production uses
+// Qdrant (one company_<id> collection per tenant); cmd/rag-eval and tests use
+// MemoryStore.
+
+type VectorStore interface {
+	// Search returns up to limit chunks scoring at least threshold, best
+	// first, or ErrCollectionNotFound.
+	Search(ctx context.Context, companyID string, vector []float64, limit int, threshold float64) ([]RetrievedChunk, error)
+	// Scroll returns up to max chunks in storage order (keyword index input).
+	Scroll(ctx context.Context, companyID string, max int) ([]RetrievedChunk, error)
+	EnsureCollection(ctx context.Context, companyID string) error
+	Upsert(ctx context.Context, companyID string, chunks []KnowledgeChunk) error
+	// DeleteSource removes the chunks of one source except the ids in keep.
+	DeleteSource(ctx context.Context, companyID string, source SourceRef, keep []string) error
+}
+
+// SourceRef picks the chunks of one uploaded source: by source_key, or for
+// chunks written before source_key existed, by LegacyField == LegacyValue.
+type SourceRef struct {
+	Key         string
+	LegacyField string
+	LegacyValue string
+}
+
+// matches reports whether a chunk payload belongs to the source.
+func (s SourceRef) matches(payload map[string]interface{}) bool {
+	if key, _ := payload["source_key"].(string); key != "" {
+		return key == s.Key
+	}
+	v, _ := payload[s.LegacyField].(string)
+	return s.LegacyField != "" && v == s.LegacyValue
+}
+
+var store VectorStore = qdrantStore{}
+
+// SetVectorStore replaces the vector store. Call it once at startup.
+func SetVectorStore(s VectorStore) {
+	store = s
+}
+
+type qdrantStore struct{}
+
+func (qdrantStore) Search(ctx context.Context, companyID string, vector []float64, limit int, threshold float64) ([]RetrievedChunk, error) {
+	return searchQdrant(ctx, companyID, vector, limit, threshold)
+}
+
+func (qdrantStore) Scroll(ctx context.Context, companyID string, max int) ([]RetrievedChunk, error) {
+	return scrollQdrant(ctx, companyID, max)
+}
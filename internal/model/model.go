@@ -1,5 +1,13 @@
 package model
 
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+)
+
 type MetaData struct {
 	CreatedAt   string `json:"created_at"`
 	LastUpdated string `json:"last_updated"`
@@ -66,20 +74,248 @@ type Department struct {
 
 // WebSocket message types
 type WSMessage struct {
-	Type    string `json:"type"`
-	Payload any    `json:"payload"` //msg in out
+	Type      string `json:"type"`
+	RequestId string `json:"request_id,omitempty"` // set by the client, echoed in its ack or error
+	Payload   any    `json:"payload"`              //msg in out
 }
 
 // payload for -> trigger: message
 type MsgInOut struct {
-	SenderId       string `json:"sender_id"`
-	SenderType     string `json:"sender_type"`
-	ReceiverId     string `json:"receiver_id,omitempty"`
-	ConversationId string `json:"conversation_id,omitempty"`
-	Typing         string `json:"typing,omitempty"`
-	Content        string `json:"content"`
-	ContentType    string `json:"content_type"`
-	CreatedAt      string `json:"created_at,omitempty"`
+	Id             int64        `json:"id,omitempty"`     // set by the server, increasing per conversation
+	Status         string       `json:"status,omitempty"` // sent | delivered | read (as of sending)
+	SenderId       string       `json:"sender_id"`
+	SenderType     string       `json:"sender_type"`
+	ReceiverId     string       `json:"receiver_id,omitempty"`
+	ConversationId string       `json:"conversation_id,omitempty"`
+	Content        string       `json:"content"`      // text, the caption of an attachment, or the text above buttons
+	ContentType    string       `json:"content_type"` // text (default) | image | file | audio | buttons | card | carousel
+	Attachment     *Attachment  `json:"attachment,omitempty"`
+	QuickReplies   []QuickReply `json:"quick_replies,omitempty"` // chips under any message, agents and ai only
+	Buttons        []Button     `json:"buttons,omitempty"`       // content_type buttons
+	Cards          []Card       `json:"cards,omitempty"`         // content_type card (one) or carousel (several)
+	Postback       *Postback    `json:"postback,omitempty"`      // set when a customer tapped a chip or button
+	CreatedAt      string       `json:"created_at,omitempty"`
+	EditedAt       string       `json:"edited_at,omitempty"`
+	Deleted        bool         `json:"deleted,omitempty"` // content and attachment removed by the sender
+}
+
+func (m MsgInOut) Validate() error {
+	switch m.ContentType {
+	case "", "text":
+		// a tapped chip may come back with just the postback
+		if strings.TrimSpace(m.Content) == "" && m.Postback == nil {
+			return errors.New("content is required")
+		}
+	case "image", "file", "audio":
+		if m.Attachment == nil || m.Attachment.Key == "" {
+			return errors.New("attachment.key is required for " + m.ContentType)
+		}
+	case "buttons":
+		if strings.TrimSpace(m.Content) == "" {
+			return errors.New("content is required")
+		}
+		if len(m.Buttons) == 0 || len(m.Buttons) > MaxButtons {
+			return fmt.Errorf("buttons needs 1 to %d buttons", MaxButtons)
+		}
+	case "card":
+		if len(m.Cards) != 1 {
+			return errors.New("card needs exactly one card")
+		}
+	case "carousel":
+		if len(m.Cards) < 2 || len(m.Cards) > MaxCarouselCards {
+			return fmt.Errorf("carousel needs 2 to %d cards", MaxCarouselCards)
+		}
+	default:
+		return errors.New("content_type must be text, image, file, audio, buttons, card or carousel")
+	}
+	if len(m.Buttons) > 0 && m.ContentType != "buttons" {
+		return errors.New("buttons need content_type buttons")
+	}
+	if len(m.Cards) > 0 && m.ContentType != "card" && m.ContentType != "carousel" {
+		return errors.New("cards need content_type card or carousel")
+	}
+	for i, b := range m.Buttons {
+		if err := b.validate(); err != nil {
+			return fmt.Errorf("buttons[%d]: %w", i, err)
+		}
+	}
+	for i, c := range m.Cards {
+		if err := c.validate(); err != nil {
+			return fmt.Errorf("cards[%d]: %w", i, err)
+		}
+	}
+	if len(m.QuickReplies) > MaxQuickReplies {
+		return fmt.Errorf("at most %d quick_replies", MaxQuickReplies)
+	}
+	for i, q := range m.QuickReplies {
+		if err := q.validate(); err != nil {
+			return fmt.Errorf("quick_replies[%d]: %w", i, err)
+		}
+	}
+	if m.Postback != nil && (m.Postback.MessageId <= 0 || m.Postback.Payload == "") {
+		return errors.New("postback needs message_id and payload")
+	}
+	return nil
+}
+
+// ── Rich content ──────────────────────────────────────────────────────────────
+//
+// Agents (and the ai) can send chips, buttons and cards. When the customer
+// taps a chip or a postback button, the widget sends a normal message:
+//
+//	{"type":"message","payload":{"content":"Track my order","postback":{"message_id":42,"payload":"TRACK_ORDER"}}}
+//
+// and the server checks the payload was really offered in message 42.
+
+const (
+	MaxQuickReplies    = 11
+	MaxQuickReplyTitle = 20
+	MaxButtons         = 3
+	MaxButtonTitle     = 20
+	MaxCarouselCards   = 10
+	MaxCardText        = 80
+	MaxPostbackPayload = 1000
+)
+
+// a chip under a message; tapping it sends the title back with payload
+type QuickReply struct {
+	Title   string `json:"title"`
+	Payload string `json:"payload"`
+}
+
+type Button struct {
+	Type    string `json:"type"` // postback (default) | url
+	Title   string `json:"title"`
+	Payload string `json:"payload,omitempty"` // postback: what comes back when tapped
+	Url     string `json:"url,omitempty"`     // url: opened in the browser
+}
+
+// a product card: image, title, link and up to MaxButtons buttons
+type Card struct {
+	Title    string   `json:"title"`
+	Subtitle string   `json:"subtitle,omitempty"`
+	ImageUrl string   `json:"image_url,omitempty"`
+	Url      string   `json:"url,omitempty"` // where tapping the card goes
+	Buttons  []Button `json:"buttons,omitempty"`
+}
+
+type Postback struct {
+	MessageId int64  `json:"message_id"` // the message the chip or button was on
+	Payload   string `json:"payload"`
+}
+
+func (q QuickReply) validate() error {
+	if err := checkTitle(q.Title, MaxQuickReplyTitle); err != nil {
+		return err
+	}
+	if q.Payload == "" || len(q.Payload) > MaxPostbackPayload {
+		return fmt.Errorf("payload is required, at most %d bytes", MaxPostbackPayload)
+	}
+	return nil
+}
+
+func (b Button) validate() error {
+	if err := checkTitle(b.Title, MaxButtonTitle); err != nil {
+		return err
+	}
+	switch b.Type {
+	case "", "postback":
+		if b.Payload == "" || len(b.Payload) > MaxPostbackPayload {
+			return fmt.Errorf("payload is required, at most %d bytes", MaxPostbackPayload)
+		}
+	case "url":
+		if !isWebURL(b.Url) {
+			return errors.New("url must be an http(s) link")
+		}
+	default:
+		return errors.New("type must be postback or url")
+	}
+	return nil
+}
+
+func (c Card) validate() error {
+	if err := checkTitle(c.Title, MaxCardText); err != nil {
+		return err
+	}
+	if utf8.RuneCountInString(c.Subtitle) > MaxCardText {
+		return fmt.Errorf("subtitle is longer than %d characters", MaxCardText)
+	}
+	if c.ImageUrl != "" && !isWebURL(c.ImageUrl) {
+		return errors.New("image_url must be an http(s) link")
+	}
+	if c.Url != "" && !isWebURL(c.Url) {
+		return errors.New("url must be an http(s) link")
+	}
+	if len(c.Buttons) > MaxButtons {
+		return fmt.Errorf("at most %d buttons", MaxButtons)
+	}
+	for i, b := range c.Buttons {
+		if err := b.validate(); err != nil {
+			return fmt.Errorf("buttons[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// Offers reports whether the message has a chip or postback button with
+// payload, and returns its title.
+func (m MsgInOut) Offers(payload string) (string, bool) {
+	for _, q := range m.QuickReplies {
+		if q.Payload == payload {
+			return q.Title, true
+		}
+	}
+	if title, ok := postbackTitle(m.Buttons, payload); ok {
+		return title, true
+	}
+	for _, c := range m.Cards {
+		if title, ok := postbackTitle(c.Buttons, payload); ok {
+			return title, true
+		}
+	}
+	return "", false
+}
+
+func postbackTitle(buttons []Button, payload string) (string, bool) {
+	for _, b := range buttons {
+		if (b.Type == "" || b.Type == "postback") && b.Payload == payload {
+			return b.Title, true
+		}
+	}
+	return "", false
+}
+
+// IsRich reports whether the message carries chips, buttons or cards.
+func (m MsgInOut) IsRich() bool {
+	return len(m.QuickReplies) > 0 || len(m.Buttons) > 0 || len(m.Cards) > 0
+}
+
+func checkTitle(title string, limit int) error {
+	if strings.TrimSpace(title) == "" {
+		return errors.New("title is required")
+	}
+	if utf8.RuneCountInString(title) > limit {
+		return fmt.Errorf("title is longer than %d characters", limit)
+	}
+	return nil
+}
+
+func isWebURL(raw string) bool {
+	u, err := url.Parse(raw)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// an uploaded object referenced by a message (POST /uploads returns one).
+// Clients send just the key; the server fills in the rest with a fresh
+// signed url.
+type Attachment struct {
+	Key          string `json:"key"`
+	FileName     string `json:"file_name,omitempty"`
+	MimeType     string `json:"mime_type,omitempty"`
+	Size         int64  `json:"size,omitempty"`
+	Url          string `json:"url,omitempty"`
+	ThumbnailUrl string `json:"thumbnail_url,omitempty"`
+	ExpiresAt    string `json:"expires_at,omitempty"` // when url stops working
 }
 
 // payload for -> trigger: transfer_chat ////payload for -> trigger: accept_chat//payload for -> trigger: accept_chat
@@ -104,15 +340,165 @@ type ConversationPayload struct {
 	*Department   `json:"department"`
 }
 
+// body for -> api: POST /api/conversation/{accept,reassign,close}
+// agent_id is only read by reassign (the agent taking over)
+type ConversationActionPayload struct {
+	ConversationId string `json:"conversation_id"`
+	AgentId        string `json:"agent_id,omitempty"`
+}
+
+func (c ConversationActionPayload) Validate() error {
+	if strings.TrimSpace(c.ConversationId) == "" {
+		return errors.New("conversation_id is required")
+	}
+	return nil
+}
+
+// answer of -> api: GET /api/conversation
+type ConversationDetail struct {
+	Conversation ConversationPayload `json:"conversation"`
+	State        string              `json:"state"` // pending | active
+	AgentId      string              `json:"agent_id,omitempty"`
+	Messages     []MsgInOut          `json:"messages"`
+}
+
+// payload for -> event: error (codes are listed in handler/error-codes.go)
+type ErrorPayload struct {
+	Code    string         `json:"code"`
+	Message string         `json:"message"`
+	Details map[string]any `json:"details,omitempty"`
+	Error   string         `json:"error"` // same as message, for older clients
+}
+
+// payload for -> event: ack (an event with a request_id went through)
+type AckPayload struct {
+	Type string `json:"type"`
+}
+
 type ExceptionPayload struct {
 	Type    string `json:"type"`
 	Message string `json:"message"`
 }
 
+// payload for -> trigger: edit_message (sender only, within the company's edit window)
+// customers may omit conversation_id; the change goes out as message_edited
+type EditMessagePayload struct {
+	ConversationId string `json:"conversation_id,omitempty"`
+	MessageId      int64  `json:"message_id"`
+	Content        string `json:"content"`
+}
+
+func (e EditMessagePayload) Validate() error {
+	if e.MessageId <= 0 {
+		return errors.New("message_id is required")
+	}
+	if strings.TrimSpace(e.Content) == "" {
+		return errors.New("content is required")
+	}
+	return nil
+}
+
+// payload for -> trigger: delete_message (same rules as edit), goes out as message_deleted
+type DeleteMessagePayload struct {
+	ConversationId string `json:"conversation_id,omitempty"`
+	MessageId      int64  `json:"message_id"`
+}
+
+func (d DeleteMessagePayload) Validate() error {
+	if d.MessageId <= 0 {
+		return errors.New("message_id is required")
+	}
+	return nil
+}
+
+// one edit or delete, with what the message said before (supervisor history)
+type MessageRevision struct {
+	ConversationId     string      `json:"conversation_id"`
+	MessageId          int64       `json:"message_id"`
+	Action             string      `json:"action"` // edit | delete
+	PreviousContent    string      `json:"previous_content"`
+	PreviousAttachment *Attachment `json:"previous_attachment,omitempty"`
+	NewContent         string      `json:"new_content,omitempty"`
+	EditorId           string      `json:"editor_id"`
+	EditorType         string      `json:"editor_type"`
+	At                 string      `json:"at"`
+}
+
+// payload for -> trigger: read (client -> server)
+// everything up to message_id in the conversation has been seen
+type ReadPayload struct {
+	ConversationId string `json:"conversation_id,omitempty"` // customers may omit it
+	MessageId      int64  `json:"message_id"`
+}
+
+func (r ReadPayload) Validate() error {
+	if r.MessageId <= 0 {
+		return errors.New("message_id is required")
+	}
+	return nil
+}
+
+// payload for -> trigger: message_status (to the sender's devices)
+type MessageStatusPayload struct {
+	ConversationId string  `json:"conversation_id"`
+	MessageIds     []int64 `json:"message_ids"`
+	Status         string  `json:"status"` // delivered | read
+}
+
+// payload for -> trigger: unread_count (to the reader's devices)
+type UnreadCountPayload struct {
+	ConversationId string `json:"conversation_id"`
+	Unread         int    `json:"unread"`
+}
+
+// payload for -> trigger: typing_start / typing_stop (both directions, live only)
+// agents set receiver_id to the customer; customers type to their assigned agent
 type TypingPayload struct {
-	SenderId   string `json:"sender_id"`
-	ReceiverId string `json:"receiver_id,omitempty"`
-	Typing     bool   `json:"typing"`
+	SenderId       string `json:"sender_id"`
+	SenderType     string `json:"sender_type"`
+	ReceiverId     string `json:"receiver_id,omitempty"`
+	ConversationId string `json:"conversation_id,omitempty"`
+	Typing         bool   `json:"typing"`
+}
+
+// payload for -> trigger: butter_sources (sent after an ai answer stream)
+type SourcesPayload struct {
+	AnswerId string     `json:"answer_id"` // rate the answer with a feedback event
+	Sources  []Citation `json:"sources"`
+}
+
+// payload for -> trigger: feedback (thumbs up/down on an ai answer or suggestion)
+type FeedbackPayload struct {
+	AnswerId string `json:"answer_id"`
+	Rating   string `json:"rating"`           // up | down
+	Reason   string `json:"reason,omitempty"` // incorrect | incomplete | irrelevant | outdated | too_long | tone | other
+	Comment  string `json:"comment,omitempty"`
+}
+
+func (f FeedbackPayload) Validate() error {
+	if f.AnswerId == "" {
+		return errors.New("answer_id is required")
+	}
+	return nil
+}
+
+// payload for -> trigger: suggested_reply (agent copilot, agent devices only)
+type SuggestedReplyPayload struct {
+	AnswerId       string     `json:"answer_id"`
+	ConversationId string     `json:"conversation_id"`
+	CustomerId     string     `json:"customer_id"`
+	InReplyTo      string     `json:"in_reply_to"`
+	Drafts         []string   `json:"drafts"`
+	Sources        []Citation `json:"sources"`
+}
+
+type Citation struct {
+	Title       string  `json:"title,omitempty"`
+	URL         string  `json:"url,omitempty"`
+	FileName    string  `json:"file_name,omitempty"`
+	Page        any     `json:"page,omitempty"`
+	SectionPath string  `json:"section_path,omitempty"`
+	Score       float64 `json:"score"`
 }
 
 // human agent
@@ -0,0 +1,154 @@
+package storage
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+// ── Upload limits and thumbnails ──────────────────────────────────────────────
+
+var (
+	MaxUploadBytes = getEnvInt64("MAX_UPLOAD_BYTES", 10<<20) // 10MB
+
+	// images wider or taller than this get a jpeg thumbnail
+	thumbnailSize = 320
+	// don't decode images bigger than this many pixels (decompression bombs)
+	maxDecodePixels = 40_000_000
+)
+
+// allowed types by what the bytes sniff as -> kind and the type we store
+var allowedTypes = map[string]struct{ kind, mimeType string }{
+	"image/png":                 {"image", "image/png"},
+	"image/jpeg":                {"image", "image/jpeg"},
+	"image/gif":                 {"image", "image/gif"},
+	"image/webp":                {"image", "image/webp"},
+	"application/pdf":           {"file", "application/pdf"},
+	"text/plain; charset=utf-8": {"file", "text/plain; charset=utf-8"},
+	"audio/mpeg":                {"audio", "audio/mpeg"},
+	"audio/wave":                {"audio", "audio/wav"},
+	"application/ogg":           {"audio", "audio/ogg"},
+	"audio/aiff":                {"audio", "audio/aiff"},
+	"video/webm":                {"audio", "audio/webm"}, // browser voice notes
+	"video/mp4":                 {"audio", "audio/mp4"},  // m4a
+}
+
+// Classify sniffs the first bytes of an upload and returns its kind and the
+// mime type to store it under. The client's declared type is not trusted.
+func Classify(head []byte, declared string) (kind, mimeType string, err error) {
+	sniffed := http.DetectContentType(head)
+	if t, ok := allowedTypes[sniffed]; ok {
+		// webm/mp4 containers are audio only if the client says so; we don't take video
+		if strings.HasPrefix(sniffed, "video/") && !strings.HasPrefix(declared, "audio/") {
+			return "", "", ErrTypeForbidden
+		}
+		return t.kind, t.mimeType, nil
+	}
+	// mp3s without an id3 tag sniff as octet-stream; take the client's word
+	// for those only
+	if sniffed == "application/octet-stream" {
+		if base, _, _ := mime.ParseMediaType(declared); base == "audio/mpeg" {
+			return "audio", base, nil
+		}
+	}
+	return "", "", ErrTypeForbidden
+}
+
+// Extension picks the file extension for a stored mime type.
+func Extension(mimeType, fileName string) string {
+	if ext := strings.ToLower(filepath.Ext(fileName)); ext != "" && len(ext) <= 6 {
+		if t := mime.TypeByExtension(ext); t != "" && strings.SplitN(t, ";", 2)[0] == strings.SplitN(mimeType, ";", 2)[0] {
+			return ext
+		}
+	}
+	switch strings.SplitN(mimeType, ";", 2)[0] {
+	case "image/jpeg":
+		return ".jpg"
+	case "text/plain":
+		return ".txt"
+	case "audio/mpeg":
+		return ".mp3"
+	case "audio/mp4", "audio/x-m4a":
+		return ".m4a"
+	}
+	if exts, _ := mime.ExtensionsByType(mimeType); len(exts) > 0 {
+		return exts[0]
+	}
+	return ""
+}
+
+// Thumbnail returns a jpeg no larger than thumbnailSize on either side, or
+// nil when the image is small enough, undecodable (webp) or too big to decode.
+func Thumbnail(data []byte) []byte {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || cfg.Width*cfg.Height > maxDecodePixels {
+		return nil
+	}
+	if cfg.Width <= thumbnailSize && cfg.Height <= thumbnailSize {
+		return nil
+	}
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, downscale(src, thumbnailSize), &jpeg.Options{Quality: 80}); err != nil {
+		return nil
+	}
+	return buf.Bytes()
+}
+
+// downscale shrinks src to fit size x size by averaging each target pixel's
+// source box. Transparent areas become white (jpeg has no alpha).
+func downscale(src image.Image, size int) image.Image {
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	tw, th := size, h*size/w
+	if h > w {
+		tw, th = w*size/h, size
+	}
+	tw, th = max(tw, 1), max(th, 1)
+
+	dst := image.NewRGBA(image.Rect(0, 0, tw, th))
+	for y := 0; y < th; y++ {
+		y0, y1 := b.Min.Y+y*h/th, b.Min.Y+(y+1)*h/th
+		for x := 0; x < tw; x++ {
+			x0, x1 := b.Min.X+x*w/tw, b.Min.X+(x+1)*w/tw
+			var r, g, bl, n uint64
+			for sy := y0; sy < max(y1, y0+1); sy++ {
+				for sx := x0; sx < max(x1, x0+1); sx++ {
+					cr, cg, cb, ca := src.At(sx, sy).RGBA()
+					// composite over white
+					white := 0xffff - ca
+					r += uint64(cr + white)
+					g += uint64(cg + white)
+					bl += uint64(cb + white)
+					n++
+				}
+			}
+			dst.Set(x, y, color.RGBA64{uint16(r / n), uint16(g / n), uint16(bl / n), 0xffff})
+		}
+	}
+	return dst
+}
+
+// ReadLimited reads r up to MaxUploadBytes, failing with ErrTooLarge beyond it.
+func ReadLimited(r io.Reader) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, MaxUploadBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > MaxUploadBytes {
+		return nil, ErrTooLarge
+	}
+	return data, nil
+}
@@ -0,0 +1,82 @@
+// Package storage keeps uploaded chat attachments: the blobs themselves, the
+// limits on what may be uploaded, and the signed urls they are served from.
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"strconv"
+	"time"
+)
+
+var (
+	ErrNotFound      = errors.New("object not found")
+	ErrTooLarge      = errors.New("file too large")
+	ErrTypeForbidden = errors.New("file type not allowed")
+)
+
+// Object is what we know about a stored blob.
+type Object struct {
+	Key          string    `json:"key"`
+	FileName     string    `json:"file_name"`
+	MimeType     string    `json:"mime_type"`
+	Kind         string    `json:"kind"` // image | file | audio
+	Size         int64     `json:"size"`
+	ThumbnailKey string    `json:"thumbnail_key,omitempty"`
+	Owner        string    `json:"owner"` // uploader id
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// Store is a blob backend. Keys are slash-separated and never start with "/".
+type Store interface {
+	Put(ctx context.Context, obj Object, r io.Reader) error
+	Stat(ctx context.Context, key string) (Object, error)
+	Open(ctx context.Context, key string) (io.ReadCloser, Object, error)
+	Delete(ctx context.Context, key string) error
+}
+
+var store Store = NewLocalStore(getEnv("STORAGE_DIR", "uploads"))
+
+// SetStore replaces the blob backend (s3, gcs...). Call it once at startup.
+func SetStore(s Store) {
+	store = s
+}
+
+func Put(ctx context.Context, obj Object, r io.Reader) error {
+	return store.Put(ctx, obj, r)
+}
+
+func Stat(ctx context.Context, key string) (Object, error) {
+	return store.Stat(ctx, key)
+}
+
+func Open(ctx context.Context, key string) (io.ReadCloser, Object, error) {
+	return store.Open(ctx, key)
+}
+
+func Delete(ctx context.Context, key string) error {
+	return store.Delete(ctx, key)
+}
+
+func getEnv(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+func getEnvInt64(key string, fallback int64) int64 {
+	if n, err := strconv.ParseInt(os.Getenv(key), 10, 64); err == nil && n > 0 {
+		return n
+	}
+	return fallback
+}
+
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	if d, err := time.ParseDuration(os.Getenv(key)); err == nil && d > 0 {
+		return d
+	}
+	return fallback
+}